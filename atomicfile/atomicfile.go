@@ -0,0 +1,37 @@
+/*
+atomicfile:
+
+Replace files atomically: the text is written to a temporary file in
+the directory of the target and renamed over it, so a reader sees the
+old or the new file, never a partly written one.
+*/
+
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes text to a temporary file in the same directory,
+// with mode perm, and renames it over filename
+func WriteFile(filename string, text []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = tmp.Chmod(perm); err == nil {
+		if _, err = tmp.Write(text); err == nil {
+			err = tmp.Sync()
+		}
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
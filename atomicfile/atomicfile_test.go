@@ -0,0 +1,38 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	tests := []struct {
+		perm os.FileMode
+	}{
+		{0600},
+		{0644},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "file")
+		if err := ioutil.WriteFile(filename, []byte("old"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(filename, []byte("new"), test.perm); err != nil {
+			t.Fatal(err)
+		}
+		text, _ := ioutil.ReadFile(filename)
+		info, _ := os.Stat(filename)
+		if string(text) != "new" || info.Mode().Perm() != test.perm {
+			t.Errorf("WriteFile %v wrote %q mode %v", test.perm, text, info.Mode().Perm())
+		}
+		if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+			t.Errorf("WriteFile left %d files", len(files))
+		}
+	}
+	if err := WriteFile(filepath.Join(t.TempDir(), "missing", "file"), []byte("x"), 0644); err == nil {
+		t.Error("WriteFile into a missing directory succeeded")
+	}
+}
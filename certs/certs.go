@@ -0,0 +1,330 @@
+/*
+certs:
+
+Generate certificate authorities and certificates signed by them or
+self signed, for kubernetes.io/tls secrets and webhook ca bundles.
+
+A Certificate carries the PEM encoded certificate and private key in
+the Cert and Key fields so templates can write
+
+    {{ $ca := genCA "my-ca" 365 }}
+    ca.crt: {{ $ca.Cert | base64Encode }}
+
+Private keys are PKCS#8 encoded for every key type.
+*/
+
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key types
+const (
+	RSA     = "rsa"
+	ECDSA   = "ecdsa"
+	Ed25519 = "ed25519"
+)
+
+// Options for key generation
+type Options struct {
+	// KeyType one of RSA, ECDSA, Ed25519
+	KeyType string
+	// KeySize rsa modulus bits or ecdsa curve size 256, 384, 521
+	KeySize int
+}
+
+// DefaultOptions rsa 2048 is accepted by every client
+var DefaultOptions = Options{KeyType: RSA, KeySize: 2048}
+
+// RenewFraction a certificate is renewed once less than this fraction
+// of its lifetime remains, the last third
+const RenewFraction = 3
+
+// ParseKeyType parses a key description: rsa, rsa:4096, ecdsa,
+// ecdsa:384, ed25519
+func ParseKeyType(text string) (opts Options, err error) {
+	parts := strings.SplitN(strings.ToLower(strings.TrimSpace(text)), ":", 2)
+	opts.KeyType = parts[0]
+	switch opts.KeyType {
+	case RSA:
+		opts.KeySize = 2048
+	case ECDSA:
+		opts.KeySize = 256
+	case Ed25519:
+	default:
+		return opts, fmt.Errorf("unknown key type %q, expected rsa, ecdsa or ed25519", text)
+	}
+	if len(parts) == 2 {
+		if opts.KeyType == Ed25519 {
+			return opts, fmt.Errorf("key type %q: ed25519 keys have no size", text)
+		}
+		if opts.KeySize, err = strconv.Atoi(strings.TrimPrefix(parts[1], "p")); err != nil {
+			return opts, fmt.Errorf("key type %q: %v", text, err)
+		}
+	}
+	return
+}
+
+// Certificate PEM encoded certificate and key
+type Certificate struct {
+	Cert string
+	Key  string
+
+	certificate *x509.Certificate
+	signer      crypto.Signer
+}
+
+// NewCA creates a self signed certificate authority valid for days
+func NewCA(cn string, days int, opts Options) (*Certificate, error) {
+	template, err := newTemplate(cn, nil, nil, days)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	return create(template, nil, opts)
+}
+
+// NewSelfSigned creates a self signed serving certificate for the ips
+// and dns names
+func NewSelfSigned(cn string, ips, dnsNames []string, days int, opts Options) (*Certificate, error) {
+	template, err := newTemplate(cn, ips, dnsNames, days)
+	if err != nil {
+		return nil, err
+	}
+	leaf(template, opts)
+	return create(template, nil, opts)
+}
+
+// NewSigned creates a certificate for the ips and dns names signed by ca
+func NewSigned(cn string, ips, dnsNames []string, days int, ca *Certificate, opts Options) (*Certificate, error) {
+	if ca == nil || ca.certificate == nil || ca.signer == nil {
+		return nil, errors.New("signing certificate authority has no certificate or key")
+	}
+	if !ca.certificate.IsCA {
+		return nil, fmt.Errorf("certificate %s is not a certificate authority", ca.certificate.Subject.CommonName)
+	}
+	template, err := newTemplate(cn, ips, dnsNames, days)
+	if err != nil {
+		return nil, err
+	}
+	leaf(template, opts)
+	return create(template, ca, opts)
+}
+
+// Parse a certificate followed by its private key, the String form
+func Parse(text string) (*Certificate, error) {
+	var c Certificate
+	rest := []byte(text)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			c.certificate = certificate
+			c.Cert = string(pem.EncodeToMemory(block))
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			signer, ok := key.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("unsupported private key %T", key)
+			}
+			c.signer = signer
+			c.Key = string(pem.EncodeToMemory(block))
+		}
+	}
+	if c.certificate == nil || c.signer == nil {
+		return nil, errors.New("expected a PEM CERTIFICATE and PRIVATE KEY")
+	}
+	return &c, nil
+}
+
+// String the certificate followed by the key, readable by Parse
+func (c *Certificate) String() string {
+	return c.Cert + c.Key
+}
+
+// SignedBy reports if ca issued c
+func (c *Certificate) SignedBy(ca *Certificate) bool {
+	return c.certificate != nil && ca != nil && ca.certificate != nil &&
+		c.certificate.CheckSignatureFrom(ca.certificate) == nil
+}
+
+// Matches reports if c was created for cn, ips and dnsNames
+func (c *Certificate) Matches(cn string, ips, dnsNames []string) bool {
+	if c.certificate == nil || c.certificate.Subject.CommonName != cn ||
+		len(c.certificate.IPAddresses) != len(ips) || len(c.certificate.DNSNames) != len(dnsNames) {
+		return false
+	}
+	for i, ip := range ips {
+		if !c.certificate.IPAddresses[i].Equal(net.ParseIP(ip)) {
+			return false
+		}
+	}
+	for i, name := range dnsNames {
+		if c.certificate.DNSNames[i] != name {
+			return false
+		}
+	}
+	return true
+}
+
+// Current reports if c has a key of opts, was issued for days and is
+// not yet in the last 1/RenewFraction of its lifetime at now
+func (c *Certificate) Current(days int, opts Options, now time.Time) bool {
+	if c.certificate == nil || !c.HasKey(opts) {
+		return false
+	}
+	lifetime := c.certificate.NotAfter.Sub(c.certificate.NotBefore)
+	// newTemplate backdates NotBefore a minute
+	issued := time.Duration(days)*24*time.Hour + time.Minute
+	if lifetime < issued-time.Minute || lifetime > issued+time.Minute {
+		return false
+	}
+	return c.certificate.NotAfter.Sub(now) > lifetime/RenewFraction
+}
+
+// HasKey reports if the key of c is of the type and size of opts
+func (c *Certificate) HasKey(opts Options) bool {
+	switch key := c.signer.(type) {
+	case *rsa.PrivateKey:
+		size := opts.KeySize
+		if size == 0 {
+			size = DefaultOptions.KeySize
+		}
+		return (opts.KeyType == RSA || opts.KeyType == "") && key.N.BitLen() == size
+	case *ecdsa.PrivateKey:
+		size := opts.KeySize
+		if size == 0 {
+			size = 256
+		}
+		return opts.KeyType == ECDSA && key.Curve.Params().BitSize == size
+	case ed25519.PrivateKey:
+		return opts.KeyType == Ed25519
+	}
+	return false
+}
+
+func newTemplate(cn string, ips, dnsNames []string, days int) (*x509.Certificate, error) {
+	if days < 1 {
+		return nil, fmt.Errorf("certificate %s: days must be positive, got %d", cn, days)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(time.Duration(days) * 24 * time.Hour),
+		BasicConstraintsValid: true,
+		DNSNames:              dnsNames,
+	}
+	for _, text := range ips {
+		ip := net.ParseIP(text)
+		if ip == nil {
+			return nil, fmt.Errorf("certificate %s: invalid ip address %q", cn, text)
+		}
+		template.IPAddresses = append(template.IPAddresses, ip)
+	}
+	return template, nil
+}
+
+// leaf marks template as a serving and client certificate
+func leaf(template *x509.Certificate, opts Options) {
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	if opts.KeyType == RSA {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+}
+
+// create signs template with ca, or self signs when ca is nil
+func create(template *x509.Certificate, ca *Certificate, opts Options) (*Certificate, error) {
+	signer, err := GenerateKey(opts)
+	if err != nil {
+		return nil, err
+	}
+	parent, parentSigner := template, signer
+	if ca != nil {
+		parent, parentSigner = ca.certificate, ca.signer
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, signer.Public(), parentSigner)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+	return &Certificate{
+		Cert:        string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		Key:         string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})),
+		certificate: certificate,
+		signer:      signer,
+	}, nil
+}
+
+// GenerateKey creates a private key described by opts
+func GenerateKey(opts Options) (crypto.Signer, error) {
+	switch opts.KeyType {
+	case RSA, "":
+		bits := opts.KeySize
+		if bits == 0 {
+			bits = DefaultOptions.KeySize
+		}
+		if bits < 2048 {
+			return nil, fmt.Errorf("rsa keys must be at least 2048 bits, got %d", bits)
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	case ECDSA:
+		var curve elliptic.Curve
+		switch opts.KeySize {
+		case 256, 0:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported ecdsa curve size %d, expected 256, 384 or 521", opts.KeySize)
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case Ed25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unknown key type %q", opts.KeyType)
+}
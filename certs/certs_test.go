@@ -0,0 +1,156 @@
+package certs
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestParseKeyType(t *testing.T) {
+	tests := []struct {
+		text string
+		want Options
+		err  bool
+	}{
+		{text: "rsa", want: Options{RSA, 2048}},
+		{text: "RSA:4096", want: Options{RSA, 4096}},
+		{text: "ecdsa", want: Options{ECDSA, 256}},
+		{text: "ecdsa:p384", want: Options{ECDSA, 384}},
+		{text: "ed25519", want: Options{Ed25519, 0}},
+		{text: "ed25519:256", err: true},
+		{text: "dsa", err: true},
+		{text: "rsa:big", err: true},
+	}
+	for _, test := range tests {
+		opts, err := ParseKeyType(test.text)
+		if (err != nil) != test.err || (!test.err && opts != test.want) {
+			t.Errorf("ParseKeyType(%q) = %+v, %v, want %+v", test.text, opts, err, test.want)
+		}
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	tests := []struct {
+		opts Options
+		err  bool
+	}{
+		{opts: Options{RSA, 2048}},
+		{opts: Options{ECDSA, 256}},
+		{opts: Options{ECDSA, 384}},
+		{opts: Options{ECDSA, 521}},
+		{opts: Options{Ed25519, 0}},
+		{opts: Options{RSA, 1024}, err: true},
+		{opts: Options{ECDSA, 224}, err: true},
+		{opts: Options{"dsa", 0}, err: true},
+	}
+	for _, test := range tests {
+		if _, err := GenerateKey(test.opts); (err != nil) != test.err {
+			t.Errorf("GenerateKey(%+v) error %v", test.opts, err)
+		}
+	}
+}
+
+func TestCertificates(t *testing.T) {
+	ca, err := NewCA("test-ca", 10, Options{ECDSA, 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewCA("other-ca", 10, Options{Ed25519, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		create   func() (*Certificate, error)
+		ips      []string
+		dnsNames []string
+		signer   *Certificate
+		isCA     bool
+	}{
+		{name: "ca", create: func() (*Certificate, error) { return NewCA("ca", 10, DefaultOptions) }, isCA: true},
+		{name: "self signed", ips: []string{"10.0.0.1"}, dnsNames: []string{"svc", "svc.ns.svc"},
+			create: func() (*Certificate, error) {
+				return NewSelfSigned("self signed", []string{"10.0.0.1"}, []string{"svc", "svc.ns.svc"}, 10, Options{ECDSA, 384})
+			}},
+		{name: "signed", dnsNames: []string{"webhook.default.svc"}, signer: ca,
+			create: func() (*Certificate, error) {
+				return NewSigned("signed", nil, []string{"webhook.default.svc"}, 10, ca, Options{Ed25519, 0})
+			}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := test.create()
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := Parse(c.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Cert != c.Cert || parsed.Key != c.Key {
+				t.Error("Parse does not round trip String")
+			}
+			if parsed.certificate.IsCA != test.isCA {
+				t.Errorf("IsCA = %v", parsed.certificate.IsCA)
+			}
+			if !parsed.Matches(test.name, test.ips, test.dnsNames) {
+				t.Error("Matches rejects the names the certificate was created for")
+			}
+			if parsed.Matches(test.name, test.ips, append(test.dnsNames, "extra")) {
+				t.Error("Matches accepts other names")
+			}
+			if test.signer != nil {
+				if !parsed.SignedBy(test.signer) {
+					t.Error("SignedBy rejects the signing ca")
+				}
+				if parsed.SignedBy(other) {
+					t.Error("SignedBy accepts another ca")
+				}
+				pool := x509.NewCertPool()
+				pool.AddCert(test.signer.certificate)
+				if _, err = parsed.certificate.Verify(x509.VerifyOptions{Roots: pool, DNSName: test.dnsNames[0]}); err != nil {
+					t.Errorf("Verify: %v", err)
+				}
+			}
+		})
+	}
+	if _, err = NewSigned("leaf", nil, nil, 10, &Certificate{}, DefaultOptions); err == nil {
+		t.Error("NewSigned accepts a ca without a key")
+	}
+	leaf, _ := NewSelfSigned("leaf", nil, nil, 10, Options{Ed25519, 0})
+	if _, err = NewSigned("leaf", nil, nil, 10, leaf, DefaultOptions); err == nil {
+		t.Error("NewSigned accepts a certificate that is not a ca")
+	}
+	if _, err = NewCA("ca", 0, DefaultOptions); err == nil {
+		t.Error("NewCA accepts 0 days")
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	c, err := NewSelfSigned("svc", nil, []string{"svc"}, 30, Options{ECDSA, 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tests := []struct {
+		name string
+		days int
+		opts Options
+		now  time.Time
+		want bool
+	}{
+		{name: "unchanged", days: 30, opts: Options{ECDSA, 256}, now: now, want: true},
+		{name: "unchanged default size", days: 30, opts: Options{ECDSA, 0}, now: now, want: true},
+		{name: "other days", days: 365, opts: Options{ECDSA, 256}, now: now},
+		{name: "other curve", days: 30, opts: Options{ECDSA, 384}, now: now},
+		{name: "other key type", days: 30, opts: DefaultOptions, now: now},
+		{name: "before the last third", days: 30, opts: Options{ECDSA, 256}, now: now.Add(19 * 24 * time.Hour), want: true},
+		{name: "in the last third", days: 30, opts: Options{ECDSA, 256}, now: now.Add(21 * 24 * time.Hour)},
+		{name: "expired", days: 30, opts: Options{ECDSA, 256}, now: now.Add(31 * 24 * time.Hour)},
+	}
+	for _, test := range tests {
+		if got := c.Current(test.days, test.opts, test.now); got != test.want {
+			t.Errorf("%s: Current = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -46,11 +46,24 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/davidwalter0/k8s-template/certs"
+	"github.com/davidwalter0/k8s-template/kube"
 	"github.com/davidwalter0/k8s-template/logger"
+	"github.com/davidwalter0/k8s-template/manifest"
+	"github.com/davidwalter0/k8s-template/naming"
+	"github.com/davidwalter0/k8s-template/profiles"
+	"github.com/davidwalter0/k8s-template/quantity"
+	"github.com/davidwalter0/k8s-template/redact"
+	"github.com/davidwalter0/k8s-template/registry"
+	"github.com/davidwalter0/k8s-template/schema"
+	"github.com/davidwalter0/k8s-template/sshkey"
+	"github.com/davidwalter0/k8s-template/state"
 	"github.com/davidwalter0/transform"
 	yaml "gopkg.in/yaml.v2"
+	"io"
 	"io/ioutil"
 	"math"
+	"math/big"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -60,14 +73,50 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 )
 
 var TemplateFile = flag.String("template", "", "file with templates to replace, or if not set, act as a filter.")
 var MappingsFile = flag.String("mappings", "", "describe the replacement values")
 var preprocess = flag.Bool("preprocess", false, "dump to standard output the preprocessed, template replacements of a mapping skipping file inclusion")
 var version = flag.Bool("version", false, "print build and git commit as a version string")
-var debug = flag.Bool("debug", false, "dump additional debugging information on template apply failure")
+var debug = flag.Bool("debug", false, "log at debug level and dump additional debugging information on template apply failure")
+var logFile = flag.String("log-file", "", "append log messages to this file, created readable by its owner alone, instead of standard error; errors are also written to standard error")
+var logLevel = flag.String("log-level", "info", "lowest level of the messages logged: "+strings.Join(logger.Levels, "|"))
+var logFormat = flag.String("log-format", "text", "format of the log messages: "+strings.Join(logger.Formats, "|"))
 var InplaceTemplatesOnly = flag.Bool("inplace", false, "Use inplace commands only, don't use a yaml formatted mappings file at all.")
+var verify = flag.Bool("verify", false, "check the rendered output is a stream of yaml documents each with apiVersion, kind and metadata.name")
+var validate = flag.Bool("validate", false, "validate the rendered resources against the OpenAPI schemas in --schema-dir, implies --verify")
+var schemaDir = flag.String("schema-dir", "~/.k8s-template/schemas", "directory of OpenAPI v3 json documents, one subdirectory per kubernetes version, v1.29")
+var kubeVersion = flag.String("kube-version", "", "kubernetes version X.Y to check removed and deprecated apiVersions and --validate against, default for --validate the highest in --schema-dir")
+var convert = flag.Bool("convert", false, "rewrite ReplicationControllers as apps/v1 Deployments and resources of replaced beta apiVersions to their replacement")
+var validateStrict = flag.Bool("validate-strict", false, "with --validate, fail on a resource whose kind has no schema instead of warning")
+var crdFiles = flag.String("crd", "", "comma separated yaml files of CustomResourceDefinitions to validate custom resources with")
+var generators = flag.String("generators", "", "yaml file of ConfigMap and Secret generators whose names get a content hash suffix")
+var namespace = flag.String("namespace", "", "set metadata.namespace of every namespaced resource")
+var commonLabels = flag.String("common-labels", "", "comma separated k=v labels to add to every resource, pod template and mutable selector")
+var commonAnnotations = flag.String("common-annotations", "", "comma separated k=v annotations to add to every resource")
+var kubeconfig = flag.String("kubeconfig", "", "kubeconfig files of the cluster diff and apply talk to, default $KUBECONFIG or ~/.kube/config")
+var kubeContext = flag.String("context", "", "kubeconfig context, default the current context")
+var inventory = flag.String("inventory", "", "add an inventory ConfigMap of this name listing every rendered resource and label the resources with its id")
+var inventoryID = flag.String("inventory-id", "", "inventory id label value, default <namespace>-<inventory>")
+var pinImages = flag.Bool("pin-images", false, "resolve every container image to the digest its registry serves, image:tag@sha256:...")
+var imageOverrides = flag.String("image-override", "", "comma separated old=new image rewrites, old is an image or a repository matching all its tags")
+var insecureRegistries = flag.String("insecure-registries", "", "comma separated registries, host:port, reached without tls verification or over http")
+var dockerConfigFile = flag.String("docker-config", "~/.docker/config.json", "docker client configuration holding the registry credentials used by --pin-images")
+var fixData = flag.Bool("fix-data", false, "move Secret data values that are not base64 to stringData and quote ConfigMap data numbers and bools")
+var outputFormat = flag.String("output-format", manifest.FormatYAML, "format of the output: "+strings.Join(manifest.Formats, "|"))
+var outputDir = flag.String("output-dir", "", "write each rendered resource to its own file under this directory instead of stdout")
+var outputPattern = flag.String("output-pattern", manifest.DefaultPathPattern, "text/template naming the --output-dir file of a resource from .Namespace, .Kind, .Name, .APIVersion, .Group and .Index")
+var pruneOutput = flag.Bool("prune-output", false, "remove files of the previous --output-dir write that were not written again")
+var sortOutput = flag.Bool("sort-output", false, "order the output for install, Namespaces, CRDs, ServiceAccounts, RBAC, Secrets, ConfigMaps, PVCs, Services, workloads, Ingresses then webhooks")
+var patches = flag.String("patch", "", "comma separated files of json 6902 and strategic merge patches applied to the rendered resources")
+var checksums = flag.Bool("checksum-annotations", false, "annotate pod templates with checksum/<name> of the ConfigMaps and Secrets in the output they reference")
+var StateFile = flag.String("state", "~/.k8s-template/state", "encrypted store of generated values, passwords, keys and certificates")
+var StateKeyFile = flag.String("state-key", "", "key file for the state store, default is the state file name with a .key suffix; $K8S_TEMPLATE_STATE_PASSPHRASE overrides the key file")
+var regenerate = flag.String("regenerate", "", "comma separated names of generated values to replace with new ones on this run")
+var clusterDomain = flag.String("cluster-domain", "cluster.local", "cluster dns domain used by svcFQDN")
+var profile = flag.String("profile", profiles.Default, "profile selecting mapping values from the mappings profiles, extending default, and the profile generated values are stored under")
 
 var TemplateText []byte
 var ReplacementMappingSourceText []byte
@@ -77,6 +126,12 @@ var Elog = logger.Error
 var Debug = logger.Debug
 var Plain = logger.Plain
 
+// Secrets the secret mapping and generated values masked in every
+// diagnostic, fingerprinted with the $K8S_TEMPLATE_REDACT_KEY key or
+// one random per run, Stderr the masked standard error
+var Secrets = redact.New([]byte(os.Getenv("K8S_TEMPLATE_REDACT_KEY")))
+var Stderr io.Writer = Secrets.Writer(os.Stderr)
+
 var Build string  // from the build ldflag options
 var Commit string // from the build ldflag options
 
@@ -109,38 +164,29 @@ type TemplateMapping struct {
 	File   bool   `json:"file,omitempty"`
 	Env    bool   `json:"env,omitempty"`
 	Uri    bool   `json:"uri,omitempty"`
+	// Required mappings must have a value in the selected profile
+	Required bool `json:"required,omitempty"`
+	// Secret values are masked in diagnostics, file and base64
+	// mappings are secret unless secret: false
+	Secret bool `json:"secret,omitempty"`
 }
 
 // HttpGet return text for uri
 func HttpGet(uri string) (text []byte, err error) {
 	defer RecoverWithMessage("HttpGet", false, 5)
 	var response *http.Response
-	if *debug {
-		Debug.Printf("uri: %v\n>%v\n", uri, err)
-	}
+	Debug.Printf("uri: %v\n", uri)
 	response, err = http.Get(uri)
-	if response != nil && (response.StatusCode < 200 || response.StatusCode > 399) {
-		if *debug {
-			Debug.Fatalf("uri: %v\n>%v %v %v %v\n", uri, response.Status, response.StatusCode, err)
-		}
-		Elog.Fatalf("uri: %v\n>%v %v %v %v\n", uri, response.Status, response.StatusCode, err)
+	if err != nil {
+		Elog.Fatalf("uri: %v\n>%v\n", uri, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 399 {
+		Elog.Fatalf("uri: %v\n>%v\n", uri, response.Status)
 	}
+	text, err = ioutil.ReadAll(response.Body)
 	if err != nil {
-		if *debug {
-			Debug.Fatalf("uri: %v\n>%v\n", uri, err)
-		}
 		Elog.Fatalf("uri: %v\n>%v\n", uri, err)
-		os.Exit(1)
-	} else {
-		defer response.Body.Close()
-		text, err = ioutil.ReadAll(response.Body)
-		if err != nil {
-			if *debug {
-				Debug.Fatalf("uri: %v\n>%v\n", uri, err)
-			}
-			Elog.Fatalf("uri: %v\n>%v\n", uri, err)
-			os.Exit(1)
-		}
 	}
 	return
 }
@@ -154,7 +200,7 @@ func Base64Encode(text string) string {
 func Base64Decode(text string) string {
 	lhs, err := base64.StdEncoding.DecodeString(text)
 	if err != nil {
-		Debug.Fatalf("base64 decode error: %v\n>%v\n", text, err)
+		Elog.Fatalf("base64 decode error: %v\n>%v\n", text, err)
 	}
 	return string(lhs)
 }
@@ -289,6 +335,14 @@ func Cat(in ...string) string {
 	return text
 }
 
+// ExpandHome replaces a leading ~/ with the $HOME directory
+func ExpandHome(path string) string {
+	if len(path) > 2 && path[:2] == "~/" {
+		path = strings.Replace(path, "~/", os.Getenv("HOME")+"/", 1)
+	}
+	return path
+}
+
 // Env lookup name return value
 func Env(name string) string {
 	return os.Getenv(name)
@@ -332,7 +386,7 @@ func Curl(name string) string {
 	defer RecoverWithMessage("Curl", false, 4)
 	bytes, err := HttpGet(name)
 	if err != nil {
-		fmt.Println(err)
+		Elog.Printf("%v\n", err)
 		panic(fmt.Sprintf("%v", err))
 	}
 	return string(bytes)
@@ -387,6 +441,182 @@ func In(find string, in []string) string {
 	return ""
 }
 
+// Quantity canonical form of a kubernetes quantity
+// {{ quantity "1.5Gi" }} -> 1536Mi
+func Quantity(text string) (string, error) {
+	q, err := quantity.Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return q.String(), nil
+}
+
+// QuantityAdd sums quantities in the format of the first
+// {{ quantityAdd "512Mi" "1Gi" }} -> 1536Mi
+func QuantityAdd(text string, more ...string) (string, error) {
+	q, err := quantity.Parse(text)
+	if err != nil {
+		return "", err
+	}
+	for _, x := range more {
+		o, err := quantity.Parse(x)
+		if err != nil {
+			return "", err
+		}
+		q = q.Add(o)
+	}
+	return q.String(), nil
+}
+
+// QuantitySub subtracts quantities from the first
+func QuantitySub(text string, more ...string) (string, error) {
+	q, err := quantity.Parse(text)
+	if err != nil {
+		return "", err
+	}
+	for _, x := range more {
+		o, err := quantity.Parse(x)
+		if err != nil {
+			return "", err
+		}
+		q = q.Sub(o)
+	}
+	return q.String(), nil
+}
+
+// Rational converts a template number or numeric string exactly, 1.1
+// is eleven tenths not the nearest float64
+func Rational(in interface{}) (*big.Rat, error) {
+	var text string
+	switch v := in.(type) {
+	case float64:
+		text = strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		text = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case int, int64, int32, uint, uint64, uint32:
+		text = fmt.Sprintf("%d", v)
+	case string:
+		text = Trim(v)
+	default:
+		return nil, fmt.Errorf("expected a number, got %T", in)
+	}
+	r, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return nil, fmt.Errorf("expected a number, got %q", text)
+	}
+	return r, nil
+}
+
+// QuantityMul multiplies a quantity by a factor, rounding up
+// {{ quantityMul .MemRequest 1.5 }}
+func QuantityMul(text string, factor interface{}) (string, error) {
+	q, err := quantity.Parse(text)
+	if err != nil {
+		return "", err
+	}
+	r, err := Rational(factor)
+	if err != nil {
+		return "", err
+	}
+	return q.Mul(r).String(), nil
+}
+
+// QuantityCmp returns -1, 0 or 1 when lhs is less, equal or greater
+// {{ if gt (quantityCmp .MemLimit "1Gi") 0 }}
+func QuantityCmp(lhs, rhs string) (int, error) {
+	l, err := quantity.Parse(lhs)
+	if err != nil {
+		return 0, err
+	}
+	r, err := quantity.Parse(rhs)
+	if err != nil {
+		return 0, err
+	}
+	return l.Cmp(r), nil
+}
+
+// QuantityValue integer bytes or cores, rounded up
+func QuantityValue(text string) (int64, error) {
+	q, err := quantity.Parse(text)
+	return q.Value(), err
+}
+
+// QuantityMilli integer thousandths, rounded up: "500m" -> 500
+func QuantityMilli(text string) (int64, error) {
+	q, err := quantity.Parse(text)
+	return q.MilliValue(), err
+}
+
+// Duration canonical form of a duration as kubernetes writes it
+// {{ duration "90m" }} -> 1h30m0s
+func Duration(text string) (string, error) {
+	d, err := time.ParseDuration(Trim(text))
+	return d.String(), err
+}
+
+// DurationAdd sums durations
+func DurationAdd(text string, more ...string) (string, error) {
+	d, err := time.ParseDuration(Trim(text))
+	if err != nil {
+		return "", err
+	}
+	for _, x := range more {
+		o, err := time.ParseDuration(Trim(x))
+		if err != nil {
+			return "", err
+		}
+		d += o
+	}
+	return d.String(), nil
+}
+
+// DurationMul multiplies a duration by a factor, truncating to
+// nanoseconds
+func DurationMul(text string, factor interface{}) (string, error) {
+	d, err := time.ParseDuration(Trim(text))
+	if err != nil {
+		return "", err
+	}
+	r, err := Rational(factor)
+	if err != nil {
+		return "", err
+	}
+	n := new(big.Int).Mul(big.NewInt(int64(d)), r.Num())
+	return time.Duration(n.Quo(n, r.Denom()).Int64()).String(), nil
+}
+
+// DurationSeconds whole seconds, for fields like
+// terminationGracePeriodSeconds
+func DurationSeconds(text string) (int64, error) {
+	d, err := time.ParseDuration(Trim(text))
+	return int64(d / time.Second), err
+}
+
+// DurationCmp returns -1, 0 or 1 when lhs is shorter, equal or longer
+func DurationCmp(lhs, rhs string) (int, error) {
+	l, err := time.ParseDuration(Trim(lhs))
+	if err != nil {
+		return 0, err
+	}
+	r, err := time.ParseDuration(Trim(rhs))
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case l < r:
+		return -1, nil
+	case l > r:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// SvcFQDN the cluster dns name of a service in namespace
+// {{ svcFQDN "db" .K8sNs }} -> db.smoke.svc.cluster.local
+func SvcFQDN(name, namespace string) string {
+	return naming.ServiceFQDN(name, namespace, *clusterDomain)
+}
+
 var fmap = template.FuncMap{
 	"cat":          Cat,
 	"nth":          Nth,
@@ -413,6 +643,36 @@ var fmap = template.FuncMap{
 	"upper":        Upper,
 	"lower":        Lower,
 	"in":           In,
+
+	"generatePassword":  GeneratePassword,
+	"genCA":             GenCA,
+	"genSelfSignedCert": GenSelfSignedCert,
+	"genSignedCert":     GenSignedCert,
+	"genSSHKey":         GenSSHKey,
+	"sshPublicKey":      sshkey.PublicKey,
+	"sshFingerprint":    sshkey.Fingerprint,
+
+	"quantity":        Quantity,
+	"quantityAdd":     QuantityAdd,
+	"quantitySub":     QuantitySub,
+	"quantityMul":     QuantityMul,
+	"quantityCmp":     QuantityCmp,
+	"quantityValue":   QuantityValue,
+	"quantityMilli":   QuantityMilli,
+	"duration":        Duration,
+	"durationAdd":     DurationAdd,
+	"durationMul":     DurationMul,
+	"durationSeconds": DurationSeconds,
+	"durationCmp":     DurationCmp,
+
+	"dnsLabel":     naming.DNSLabel,
+	"dnsSubdomain": naming.DNSSubdomain,
+	"truncName":    naming.Truncate,
+	"labelValue":   naming.LabelValue,
+	"svcFQDN":      SvcFQDN,
+
+	"dockerConfigJson":      manifest.DockerConfigJson,
+	"dockerConfigJsonMerge": manifest.DockerConfigJsonMerge,
 }
 
 // var debugFile *os.File = os.Stdout
@@ -427,10 +687,50 @@ func init() {
 	}
 
 	templateRegex, _ = regexp.Compile("{{.*}}")
+	if err := ConfigureLogging(); err != nil {
+		Elog.Fatalf("%v\n", err)
+	}
+}
+
+// logOutput the --log-file the loggers write to, closed when they are
+// configured again
+var logOutput *os.File
+
+// ConfigureLogging directs the loggers to --log-file or standard error
+// at --log-level, masking secret values
+func ConfigureLogging() error {
+	level, err := logger.ParseLevel(*logLevel)
+	if err != nil {
+		return fmt.Errorf("--log-level: %v", err)
+	}
+	if *debug && level > logger.DebugLevel {
+		level = logger.DebugLevel
+	}
+	*debug = level <= logger.DebugLevel
+	format, err := logger.ParseFormat(*logFormat)
+	if err != nil {
+		return fmt.Errorf("--log-format: %v", err)
+	}
+	options := logger.Options{Output: os.Stderr, Level: level, Format: format, Filter: Secrets.String}
+	var f *os.File
+	if len(*logFile) > 0 {
+		if f, err = logger.OpenFile(ExpandHome(*logFile)); err != nil {
+			return fmt.Errorf("--log-file: %v", err)
+		}
+		options.Output, options.Errors = f, os.Stderr
+	}
+	if err = logger.Configure(options); err != nil {
+		return err
+	}
+	if logOutput != nil {
+		logOutput.Close()
+	}
+	logOutput = f
+	return nil
 }
 
 func Usage() {
-	fmt.Printf("Usage of %s:\n", os.Args[0])
+	fmt.Fprintf(Stderr, "Usage of %s:\n", os.Args[0])
 	flag.PrintDefaults()
 	os.Exit(3)
 }
@@ -445,20 +745,20 @@ func Trace() {
 		f := runtime.FuncForPC(pc[i])
 		file, line := f.FileLine(pc[i])
 		// Info.Printf("%s:%d %s\n", file, line, f.Name())
-		fmt.Printf("error: %s:%d: %s\n", file, line, f.Name())
+		fmt.Fprintf(Stderr, "error: %s:%d: %s\n", file, line, f.Name())
 	}
 }
 
 func RecoverWithMessage(step string, exitOnException bool, failureExitCode int) {
 	if r := recover(); r != nil {
-		fmt.Printf("error: Recovered step[%s] with info\n-----\n%v\n-----\n", step, r)
+		fmt.Fprintf(Stderr, "error: Recovered step[%s] with info\n-----\n%v\n-----\n", step, r)
 		Trace()
 		pc := make([]uintptr, 10)
 		runtime.Callers(5, pc)
 		f := runtime.FuncForPC(pc[1])
 		file, line := f.FileLine(pc[1])
 		// Info.Printf("call failed at or near %s:%d %s\n", file, line, f.Name())
-		fmt.Printf("error: %s:%d: %s call failed at or near\n", file, line, f.Name())
+		fmt.Fprintf(Stderr, "error: %s:%d: %s call failed at or near\n", file, line, f.Name())
 		if exitOnException {
 			os.Exit(failureExitCode)
 		}
@@ -482,8 +782,15 @@ func (tm *TemplateMapping) Parse(InData map[string]interface{}) {
 			tm.Env = value.(bool)
 		case "uri":
 			tm.Uri = value.(bool)
+		case "required":
+			tm.Required = value.(bool)
+		case "secret":
+			tm.Secret = value.(bool)
 		}
 	}
+	if _, ok := InData["secret"]; !ok {
+		tm.Secret = tm.File || tm.Base64
+	}
 
 	if tm.File && tm.Uri {
 		Elog.Fatalf("Field: name: [%s]: A mapping may either be a file or uri, not both\n", tm.Name)
@@ -495,13 +802,12 @@ func (tm *TemplateMapping) Parse(InData map[string]interface{}) {
 		tm.Value = TemplateApplyString(Mapping, tm.Value)
 	}
 
+	// file and uri values are names until their content is read
+	loaded := !tm.File && !tm.Uri
 	if tm.File {
 		if !templateRegex.MatchString(tm.Value) && !*preprocess {
-			path := tm.Value
-			if len(path) > 2 && path[:2] == "~/" {
-				path = strings.Replace(path, "~/", os.Getenv("HOME")+"/", 1)
-			}
-			tm.Value = string(Load(path))
+			tm.Value = string(Load(ExpandHome(tm.Value)))
+			loaded = true
 		}
 
 		if *preprocess {
@@ -519,6 +825,7 @@ func (tm *TemplateMapping) Parse(InData map[string]interface{}) {
 				return
 			}
 			tm.Value = string(text)
+			loaded = true
 		}
 
 		if *preprocess {
@@ -526,17 +833,20 @@ func (tm *TemplateMapping) Parse(InData map[string]interface{}) {
 		}
 	}
 
+	if tm.Secret && loaded {
+		Secrets.Add(tm.Name, tm.Value)
+	}
+
 	if tm.Base64 {
-		if *preprocess {
-			base64Mapped[tm.Name] = true
-		} else {
+		base64Mapped[tm.Name] = true
+		if !*preprocess {
 			tm.Value = Base64Encode(tm.Value)
 		}
 	}
 
 	if *debug {
-		debugText += fmt.Sprintf("name: %s len(value): %d base64: %v file: %v env: %v\n",
-			tm.Name, len(tm.Value), tm.Base64, tm.File, tm.Env)
+		debugText += fmt.Sprintf("name: %s len(value): %d base64: %v file: %v env: %v secret: %v\n",
+			tm.Name, len(tm.Value), tm.Base64, tm.File, tm.Env, tm.Secret)
 	}
 }
 
@@ -561,6 +871,532 @@ func Load(filename string) []byte {
 	return text
 }
 
+var store *state.Store
+var regenerated = make(map[string]bool)
+
+// OpenState opens and locks the generated value store on first use,
+// the lock is held until CloseState
+func OpenState() (*state.Store, error) {
+	if store == nil {
+		var err error
+		filename := ExpandHome(*StateFile)
+		keyFile := ExpandHome(*StateKeyFile)
+		if len(keyFile) == 0 {
+			keyFile = filename + ".key"
+		}
+		store, err = state.Open(filename, keyFile, os.Getenv("K8S_TEMPLATE_STATE_PASSPHRASE"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// CloseState releases the generated value store if it was opened
+func CloseState() {
+	if store != nil {
+		store.Close()
+		store = nil
+	}
+}
+
+// Regenerate reports if name was listed in --regenerate
+func Regenerate(name string) bool {
+	for _, x := range strings.Split(*regenerate, ",") {
+		if Trim(x) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Generated returns the value stored for name in the current profile,
+// calling create to make and store it on first use, or once per run
+// when name is listed in --regenerate
+func Generated(kind, name string, create func() (string, error)) (string, error) {
+	return GeneratedValid(kind, name, nil, create)
+}
+
+// GeneratedValid is Generated, but also replaces a stored value that
+// valid rejects, for example a certificate for other dns names
+func GeneratedValid(kind, name string, valid func(string) bool, create func() (string, error)) (string, error) {
+	s, err := OpenState()
+	if err != nil {
+		return "", err
+	}
+	entry, ok := s.Get(*profile, name)
+	if ok && entry.Kind != kind {
+		return "", fmt.Errorf("generated value %s is a %s not a %s", name, entry.Kind, kind)
+	}
+	if ok && !(Regenerate(name) && !regenerated[name]) && (valid == nil || valid(entry.Value)) {
+		Secrets.Add(name, entry.Value)
+		return entry.Value, nil
+	}
+	value, err := create()
+	if err != nil {
+		return "", err
+	}
+	if err = s.Put(state.Entry{Profile: *profile, Name: name, Kind: kind, Value: value}); err != nil {
+		return "", err
+	}
+	regenerated[name] = true
+	Secrets.Add(name, value)
+	return value, nil
+}
+
+// GeneratePassword returns a random password of length characters for
+// name, stable across runs
+// {{ generatePassword "db-admin" 32 }}
+func GeneratePassword(name string, length int) (string, error) {
+	text, err := Generated("password", name, func() (string, error) {
+		return state.Password(length)
+	})
+	if err == nil && len(text) != length {
+		err = fmt.Errorf("generated password %s has length %d, use --regenerate=%s to change it to %d",
+			name, len(text), name, length)
+	}
+	return text, err
+}
+
+// List converts a space separated string or an array to a string
+// array, dropping empty items
+func List(in interface{}) (list []string, err error) {
+	switch v := in.(type) {
+	case nil:
+	case string:
+		for _, x := range strings.Split(v, " ") {
+			if len(x) > 0 {
+				list = append(list, x)
+			}
+		}
+	case []string:
+		list = v
+	case []interface{}:
+		for _, x := range v {
+			list = append(list, fmt.Sprintf("%v", x))
+		}
+	default:
+		err = fmt.Errorf("expected a space separated string or a list, got %T", in)
+	}
+	return
+}
+
+// CertOptions parses trailing certificate function options
+// key=rsa|rsa:4096|ecdsa|ecdsa:384|ed25519 and persist=name
+func CertOptions(options []string) (opts certs.Options, persist string, err error) {
+	opts = certs.DefaultOptions
+	for _, option := range options {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 {
+			return opts, persist, fmt.Errorf("certificate option %q is not key=value", option)
+		}
+		switch parts[0] {
+		case "key":
+			if opts, err = certs.ParseKeyType(parts[1]); err != nil {
+				return
+			}
+		case "persist":
+			persist = parts[1]
+		default:
+			return opts, persist, fmt.Errorf("unknown certificate option %q, expected key= or persist=", option)
+		}
+	}
+	return
+}
+
+// Certificate creates a certificate with create, or when persisted
+// loads it from the state store, recreating it when valid rejects the
+// stored one
+func Certificate(persist string, valid func(*certs.Certificate) bool,
+	create func() (*certs.Certificate, error)) (*certs.Certificate, error) {
+	if len(persist) == 0 {
+		return create()
+	}
+	text, err := GeneratedValid("certificate", persist,
+		func(text string) bool {
+			c, err := certs.Parse(text)
+			return err == nil && valid(c)
+		},
+		func() (string, error) {
+			c, err := create()
+			if err != nil {
+				return "", err
+			}
+			return c.String(), nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return certs.Parse(text)
+}
+
+// GenCA creates a certificate authority valid for days
+// {{ $ca := genCA "webhook-ca" 3650 "key=ecdsa" "persist=webhook-ca" }}
+func GenCA(cn string, days int, options ...string) (*certs.Certificate, error) {
+	opts, persist, err := CertOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	return Certificate(persist,
+		func(c *certs.Certificate) bool { return c.Matches(cn, nil, nil) && c.Current(days, opts, time.Now()) },
+		func() (*certs.Certificate, error) { return certs.NewCA(cn, days, opts) })
+}
+
+// GenSelfSignedCert creates a self signed certificate for the space
+// separated, or list of, ips and dnsNames
+// {{ $c := genSelfSignedCert "svc" "" "svc svc.ns.svc" 365 }}
+func GenSelfSignedCert(cn string, ips, dnsNames interface{}, days int, options ...string) (*certs.Certificate, error) {
+	opts, persist, err := CertOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	ipList, err := List(ips)
+	if err != nil {
+		return nil, err
+	}
+	dnsList, err := List(dnsNames)
+	if err != nil {
+		return nil, err
+	}
+	return Certificate(persist,
+		func(c *certs.Certificate) bool {
+			return c.Matches(cn, ipList, dnsList) && c.Current(days, opts, time.Now())
+		},
+		func() (*certs.Certificate, error) { return certs.NewSelfSigned(cn, ipList, dnsList, days, opts) })
+}
+
+// GenSignedCert creates a certificate for ips and dnsNames signed by ca,
+// a persisted certificate is reissued when ca changes
+// {{ $c := genSignedCert "svc" "10.0.0.1" "svc.ns.svc" 365 $ca }}
+func GenSignedCert(cn string, ips, dnsNames interface{}, days int, ca *certs.Certificate, options ...string) (*certs.Certificate, error) {
+	opts, persist, err := CertOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	ipList, err := List(ips)
+	if err != nil {
+		return nil, err
+	}
+	dnsList, err := List(dnsNames)
+	if err != nil {
+		return nil, err
+	}
+	return Certificate(persist,
+		func(c *certs.Certificate) bool {
+			return c.Matches(cn, ipList, dnsList) && c.SignedBy(ca) && c.Current(days, opts, time.Now())
+		},
+		func() (*certs.Certificate, error) { return certs.NewSigned(cn, ipList, dnsList, days, ca, opts) })
+}
+
+// GenSSHKey creates an ssh key pair with .PrivateKey, .PublicKey and
+// .Fingerprint fields, options comment=text and persist=name
+// {{ $key := genSSHKey "ed25519" "persist=deploy-key" }}
+func GenSSHKey(keyType string, options ...string) (*sshkey.KeyPair, error) {
+	var comment, persist string
+	for _, option := range options {
+		parts := strings.SplitN(option, "=", 2)
+		switch {
+		case len(parts) == 2 && parts[0] == "comment":
+			comment = parts[1]
+		case len(parts) == 2 && parts[0] == "persist":
+			persist = parts[1]
+		default:
+			return nil, fmt.Errorf("unknown ssh key option %q, expected comment= or persist=", option)
+		}
+	}
+	if len(persist) == 0 {
+		return sshkey.Generate(keyType, comment)
+	}
+	private, err := Generated("ssh-key", persist, func() (string, error) {
+		pair, err := sshkey.Generate(keyType, comment)
+		if err != nil {
+			return "", err
+		}
+		return pair.PrivateKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sshkey.NewKeyPair(private, comment)
+}
+
+// ListGenerated prints the names of the generated values, never the
+// values themselves
+func ListGenerated(args []string) {
+	ParseCommand(CommandFlags("list-generated"), args)
+	s, err := OpenState()
+	if err != nil {
+		Elog.Fatalf("%v\n", err)
+	}
+	defer CloseState()
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	fmt.Fprintf(w, "%-12s %-32s %-12s %s\n", "PROFILE", "NAME", "KIND", "CREATED")
+	for _, entry := range s.List() {
+		fmt.Fprintf(w, "%-12s %-32s %-12s %s\n",
+			entry.Profile, entry.Name, entry.Kind, entry.Created.Format(time.RFC3339))
+	}
+}
+
+// CommandFlags a flag set for a subcommand that also accepts the
+// global flags
+func CommandFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flag.VisitAll(func(f *flag.Flag) {
+		flags.Var(f.Value, f.Name, f.Usage)
+	})
+	return flags
+}
+
+// ParseCommand parses the arguments of a subcommand and applies the
+// logging flags given among them
+func ParseCommand(flags *flag.FlagSet, args []string) {
+	flags.Parse(args)
+	if err := ConfigureLogging(); err != nil {
+		Elog.Fatalf("%v\n", err)
+	}
+}
+
+// MappingValues looks up the mapping of each key and mapping name pair
+func MappingValues(sources [][2]string) (values []manifest.SecretValue, err error) {
+	for _, source := range sources {
+		value, ok := Mapping[source[1]]
+		if !ok {
+			return nil, fmt.Errorf("no mapping named %s in %s", source[1], *MappingsFile)
+		}
+		values = append(values, manifest.SecretValue{Key: source[0], Value: value, Encoded: base64Mapped[source[1]]})
+	}
+	return
+}
+
+// SecretCommand writes a Secret holding mapping values, without a
+// template
+// k8s-template secret --mappings=m.yaml --name=x --from-mapping=tls.crt=Cert,tls.key=Key --type=kubernetes.io/tls
+func SecretCommand(args []string) {
+	flags := CommandFlags("secret")
+	name := flags.String("name", "", "name of the secret")
+	from := flags.String("from-mapping", "", "comma separated mapping names to store, key=name stores a mapping under another key")
+	secretType := flags.String("type", "Opaque", "secret type: Opaque, kubernetes.io/tls, kubernetes.io/dockerconfigjson, ...")
+	stringData := flags.Bool("string-data", true, "write text values under stringData, false base64 encodes every value under data")
+	ParseCommand(flags, args)
+	defer CloseState()
+
+	LoadMappings(Load(*MappingsFile))
+	SelfReference(&Mapping)
+
+	values, err := MappingValues(manifest.ParseSources(*from))
+	if err != nil {
+		Elog.Fatalf("secret %s: %v\n", *name, err)
+	}
+	document, err := manifest.NewSecret(*name, *namespace, *secretType, values, *stringData)
+	if err != nil {
+		Elog.Fatalf("%v\n", err)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	w.WriteString(document.Text)
+}
+
+// PrunePlan lists the resources of the inventory of a previous render
+// that the current render no longer holds, in the order to delete them;
+// the current render is read from stdin when not named
+// k8s-template prune-plan previous.yaml current.yaml
+func PrunePlan(args []string) {
+	flags := CommandFlags("prune-plan")
+	ParseCommand(flags, args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		Elog.Fatalf("usage: prune-plan previous.yaml [current.yaml]\n")
+	}
+	previous := InventoryOf(flags.Arg(0))
+	current := InventoryOf(flags.Arg(1))
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for _, entry := range manifest.PrunePlan(previous, current) {
+		fmt.Fprintln(w, entry)
+	}
+}
+
+// InventoryOf the rendered output or inventory ConfigMap in filename,
+// stdin for "" or -
+func InventoryOf(filename string) []manifest.Entry {
+	if filename == "-" {
+		filename = ""
+	}
+	documents := manifest.Split(string(Load(filename)))
+	if errors := manifest.Check(documents); len(errors) > 0 {
+		for _, e := range errors {
+			fmt.Fprintf(Stderr, "%s:%d:%d: %s\n", filename, e.Line, e.Column, e.Describe())
+		}
+		os.Exit(3)
+	}
+	entries, err := manifest.ReadInventory(documents, Namespace())
+	if err != nil {
+		Elog.Fatalf("%s: %v\n", filename, err)
+	}
+	return entries
+}
+
+// RenderDocuments renders --template with --mappings, checked and
+// transformed as the output of a render is, with the map of rendered
+// to template lines
+func RenderDocuments() ([]*manifest.Document, *manifest.LineMap) {
+	if len(*TemplateFile) == 0 {
+		Elog.Fatalf("a --template is required\n")
+	}
+	TemplateText = Load(*TemplateFile)
+	LoadMappings(Load(*MappingsFile))
+	SelfReference(&Mapping)
+	text := Render(Mapping, TemplateText)
+	return Process(TemplateText, text), manifest.NewLineMap(string(TemplateText), text)
+}
+
+// KubeClient of the --kubeconfig --context cluster
+func KubeClient() *kube.Client {
+	config, err := kube.LoadConfig(ExpandHome(*kubeconfig), *kubeContext)
+	if err != nil {
+		Elog.Fatalf("%v\n", err)
+	}
+	client, err := kube.NewClient(config)
+	if err != nil {
+		Elog.Fatalf("%v\n", err)
+	}
+	return client
+}
+
+// DiffCommand renders the template and prints a unified diff of each
+// live object against the result of a server side apply dry run of
+// its resource, Secret data masked; it exits 1 when a resource differs
+// and 3 when one can not be read
+// k8s-template diff --mappings=m.yaml --template=t.yaml
+func DiffCommand(args []string) {
+	flags := CommandFlags("diff")
+	fieldManager := flags.String("field-manager", "k8s-template", "field manager of the dry run apply, that of apply")
+	force := flags.Bool("force-conflicts", false, "take ownership of fields another field manager owns in the dry run")
+	ParseCommand(flags, args)
+	defer CloseState()
+	documents, _ := RenderDocuments()
+	client := KubeClient()
+	options := kube.ApplyOptions{FieldManager: *fieldManager, Force: *force}
+	w := bufio.NewWriter(os.Stdout)
+	changed, failed := false, false
+	for _, document := range documents {
+		if document.Object == nil {
+			continue
+		}
+		if len(document.Name()) == 0 {
+			Elog.Printf("%s: generateName resources are created, not diffed\n", document.Identity())
+			continue
+		}
+		diff, err := client.Diff(document, options)
+		if err != nil {
+			Elog.Printf("%s: %v\n", document.Identity(), err)
+			failed = true
+			continue
+		}
+		if len(diff) > 0 {
+			changed = true
+			w.WriteString(diff)
+		}
+	}
+	w.Flush()
+	switch {
+	case failed:
+		os.Exit(3)
+	case changed:
+		os.Exit(1)
+	}
+}
+
+// ApplyCommand renders the template and server side applies each
+// resource in install order, reporting per resource and template line
+// if it was created, configured, left unchanged or failed; it exits 3
+// when a resource fails
+// k8s-template apply --mappings=m.yaml --template=t.yaml --dry-run=server
+func ApplyCommand(args []string) {
+	flags := CommandFlags("apply")
+	fieldManager := flags.String("field-manager", "k8s-template", "field manager owning the applied fields")
+	force := flags.Bool("force-conflicts", false, "take ownership of fields another field manager owns")
+	dryRun := flags.String("dry-run", "none", "none, or server to have the server validate and default the resources without persisting them")
+	wait := flags.Bool("wait", false, "wait for the rollout of the Deployments, StatefulSets, DaemonSets, ReplicaSets and ReplicationControllers applied")
+	timeout := flags.Duration("timeout", 5*time.Minute, "how long --wait waits for each rollout")
+	ParseCommand(flags, args)
+	if *dryRun != "none" && *dryRun != "server" {
+		Elog.Fatalf("--dry-run %s: expected none or server\n", *dryRun)
+	}
+	defer CloseState()
+	documents, lines := RenderDocuments()
+	documents = manifest.SortInstallOrder(documents)
+	client := KubeClient()
+	options := kube.ApplyOptions{FieldManager: *fieldManager, Force: *force, DryRun: *dryRun == "server"}
+	suffix := ""
+	if options.DryRun {
+		suffix = " (server dry run)"
+	}
+	defined := DefinedKinds(documents)
+	failed := false
+	var rollouts []*manifest.Document
+	for _, document := range documents {
+		if document.Object == nil {
+			continue
+		}
+		where := document.Identity()
+		if document.Line > 0 {
+			where = fmt.Sprintf("%s:%d: %s", *TemplateFile, lines.Template(document.Line), where)
+		}
+		result, err := client.ApplyDocument(document, options, defined)
+		if err != nil {
+			fmt.Printf("%s: failed: %s\n", where, Secrets.String(err.Error()))
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: %s%s\n", where, result, suffix)
+		if *wait && !options.DryRun && kube.RolloutKinds[document.Kind()] {
+			rollouts = append(rollouts, document)
+		}
+	}
+	for _, document := range rollouts {
+		if err := client.WaitRollout(document.APIVersion(), document.Kind(), document.Namespace(), document.Name(), *timeout); err != nil {
+			fmt.Printf("%s: rollout failed: %v\n", document.Identity(), err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: rolled out\n", document.Identity())
+	}
+	os.Stdout.Sync()
+	if failed {
+		os.Exit(3)
+	}
+}
+
+// DefinedKinds the apiVersion and kind pairs the CustomResourceDefinitions
+// of documents define
+func DefinedKinds(documents []*manifest.Document) map[string]bool {
+	defined := make(map[string]bool)
+	for _, document := range documents {
+		if document.Kind() != "CustomResourceDefinition" {
+			continue
+		}
+		group := manifest.GetString(document.Object, "spec", "group")
+		kind := manifest.GetString(document.Object, "spec", "names", "kind")
+		for _, version := range manifest.GetList(document.Object, "spec", "versions") {
+			defined[group+"/"+manifest.GetString(version, "name")+" "+kind] = true
+		}
+		if version := manifest.GetString(document.Object, "spec", "version"); len(version) > 0 {
+			defined[group+"/"+version+" "+kind] = true
+		}
+	}
+	return defined
+}
+
+// Commands are subcommands named by the first non flag argument
+var Commands = map[string]func(args []string){
+	"apply":          ApplyCommand,
+	"diff":           DiffCommand,
+	"list-generated": ListGenerated,
+	"prune-plan":     PrunePlan,
+	"secret":         SecretCommand,
+}
+
 var IOStdin bool = false
 var Environment map[string]string = make(map[string]string, 0)
 
@@ -569,6 +1405,12 @@ func main() {
 	defer os.Stdout.Sync()
 	defer os.Stdout.Close()
 
+	if command, ok := Commands[flag.Arg(0)]; ok {
+		command(flag.Args()[1:])
+		return
+	}
+	defer CloseState()
+
 	env_array := os.Environ()
 	for _, env := range env_array {
 		parts := strings.SplitN(env, "=", 2)
@@ -622,32 +1464,64 @@ func main() {
 		}
 	}
 
-	data, err := transform.Yaml2Json(ReplacementMappingSourceText)
+	LoadMappings(ReplacementMappingSourceText)
+
+	SelfReference(&Mapping)
+	if *preprocess {
+		Preprocess(Mapping, IOStdin)
+	}
+	if !IOStdin && !*preprocess {
+		TemplateApply(Mapping, TemplateText)
+	}
+}
+
+// LoadMappings parses a yaml mappings definition into Mapping
+func LoadMappings(text []byte) {
+	data, err := transform.Yaml2Json(text)
 	if err != nil {
-		fmt.Println(err, "error transforming Yaml2Json")
+		Elog.Printf("%v error transforming Yaml2Json\n", err)
 		os.Exit(3)
 	}
+	// a mapping holds the mappings: list and the profiles: section
+	var definition interface{}
+	_ = json.Unmarshal(data, &definition)
+	var section interface{}
+	if fields, ok := definition.(map[string]interface{}); ok {
+		section = fields["profiles"]
+		data, _ = json.Marshal(fields["mappings"])
+	}
 	_ = json.Unmarshal(data, &MappingDefinition)
+	defined, err := profiles.Parse(section)
+	if err != nil {
+		Elog.Fatalf("mappings: %v\n", err)
+	}
+	chain, err := defined.Chain(*profile, profiles.Names(MappingDefinition))
+	if err != nil {
+		Elog.Fatalf("mappings: %v\n", err)
+	}
+	var unset []string
 	for _, InData := range MappingDefinition {
+		name, _ := InData["name"].(string)
+		value, found, err := defined.Select(chain, name, InData)
+		if err != nil {
+			Elog.Fatalf("mappings: %v\n", err)
+		}
+		_, own := InData["profiles"]
+		if required, _ := InData["required"].(bool); !found && (required || own) {
+			unset = append(unset, name)
+			continue
+		}
+		InData["value"] = value
 		var tm TemplateMapping
 		tm.Parse(InData)
-		Mapping[tm.Name] = tm.Value
-	}
-
-	if *debug {
-		f, err := os.OpenFile("debug.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-		if err != nil {
-			Elog.Fatalf("error opening file: %v", err)
+		if tm.Required && len(tm.Value) == 0 {
+			unset = append(unset, name)
 		}
-		defer f.Close()
-		Plain.SetOutput(f)
+		Mapping[tm.Name] = tm.Value
 	}
-	SelfReference(&Mapping)
-	if *preprocess {
-		Preprocess(Mapping, IOStdin)
-	}
-	if !IOStdin && !*preprocess {
-		TemplateApply(Mapping, TemplateText)
+	if len(unset) > 0 {
+		Elog.Fatalf("mappings: profile %s (%s) leaves required mappings unset: %s\n",
+			*profile, strings.Join(chain, " -> "), strings.Join(unset, ", "))
 	}
 }
 
@@ -689,7 +1563,8 @@ func Preprocess(Mapping ReplacementMapping, dump bool) {
 	for _, key := range keys {
 		var T TemplateMapping
 		T.Name = key
-		T.Value = Mapping[key]
+		T.Value = Secrets.Value(key, Mapping[key])
+		T.Secret = Secrets.Secret(key)
 
 		if fileMapped[key] {
 			T.File = true
@@ -757,11 +1632,11 @@ func TemplateApplyString(mapping ReplacementMapping, text string) string { // st
 	tmpl, err := template.New("TemplateApplyString").Funcs(fmap).Parse(text)
 	err = tmpl.Execute(buffer, mapping)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		fmt.Fprintf(os.Stderr, "Is the template file missing a mapping?\nCheck the line number of the error to see if the mapping file has that argument.")
+		fmt.Fprintln(Stderr, err)
+		fmt.Fprintf(Stderr, "Is the template file missing a mapping?\nCheck the line number of the error to see if the mapping file has that argument.")
 		if len(debugText) > 0 {
-			fmt.Fprintf(os.Stderr, "\nInput debug mappings:\n")
-			fmt.Fprintln(os.Stderr, debugText)
+			fmt.Fprintf(Stderr, "\nInput debug mappings:\n")
+			fmt.Fprintln(Stderr, debugText)
 		}
 	}
 	return buffer.String()
@@ -769,11 +1644,62 @@ func TemplateApplyString(mapping ReplacementMapping, text string) string { // st
 
 func TemplateApply(mapping ReplacementMapping, ttext []byte) { // string {
 	defer RecoverWithMessage("TemplateApply", false, 3)
+	text := Render(mapping, ttext)
+	if len(*outputDir) > 0 {
+		WriteOutputDir(Process(ttext, text))
+		return
+	}
 	w := bufio.NewWriter(os.Stdout)
 	defer w.Flush()
+	text = PostRender(ttext, text)
+
+	o := fmt.Sprintf("%s\n", text)
+	w.Write([]byte(o))
+}
+
+// ValidateSchemas checks parsed documents against the OpenAPI schemas
+// of --kube-version, custom resources against the CustomResourceDefinitions
+// from --crd and those in the rendered stream
+func ValidateSchemas(documents []*manifest.Document) (errors []*manifest.Error) {
+	set, err := schema.Load(ExpandHome(*schemaDir), *kubeVersion)
+	if err != nil {
+		Elog.Fatalf("%v\n", err)
+	}
+	set.Strict = *validateStrict
+	for _, filename := range strings.Split(*crdFiles, ",") {
+		if filename = Trim(filename); len(filename) > 0 {
+			if err = set.AddCRDFile(ExpandHome(filename)); err != nil {
+				Elog.Fatalf("%v\n", err)
+			}
+		}
+	}
+	for _, document := range documents {
+		if document.Kind() == "CustomResourceDefinition" {
+			if err = set.AddCRD(document.Object); err != nil {
+				errors = append(errors, &manifest.Error{Index: document.Index, Identity: document.Identity(),
+					Line: document.Line, Column: 1, Message: err.Error()})
+			}
+		}
+	}
+	for _, document := range documents {
+		if document.Object == nil {
+			continue
+		}
+		for _, e := range set.Validate(document.Object) {
+			line, column := document.PathLine(e.Path)
+			errors = append(errors, &manifest.Error{Index: document.Index, Identity: document.Identity(),
+				Line: line, Column: column, Message: e.Error(), Warning: e.Warning})
+		}
+	}
+	return
+}
+
+// Render applies the mappings to the template text until no more
+// replacements are made
+func Render(mapping ReplacementMapping, ttext []byte) string {
 	text := string(ttext)
 	for templateRegex.MatchString(text) {
-		after := TemplateApplyString(Mapping, text)
+		after := TemplateApplyString(mapping, text)
 		// If there is a mapping without changes, this has been
 		// processed as much as it can be for now.
 		if text == after {
@@ -781,7 +1707,298 @@ func TemplateApply(mapping ReplacementMapping, ttext []byte) { // string {
 		}
 		text = after
 	}
+	return text
+}
 
-	o := fmt.Sprintf("%s\n", text)
-	w.Write([]byte(o))
+// PostRender checks the rendered text, exiting before any output is
+// written when a document is not a well formed resource
+func PostRender(ttext []byte, text string) string {
+	if !*verify && !*validate && len(*kubeVersion) == 0 && !Transforming() {
+		return text
+	}
+	text, err := manifest.Format(Process(ttext, text), *outputFormat)
+	if err != nil {
+		Elog.Fatalf("--output-format: %v\n", err)
+	}
+	if *outputFormat != manifest.FormatYAML {
+		// TemplateApply ends the output with a newline
+		text = strings.TrimSuffix(text, "\n")
+	}
+	return text
+}
+
+// Process splits the rendered text into documents, runs the generators
+// and patches, checks the result, reports the errors against the
+// template lines and exits or applies the transforms
+func Process(ttext []byte, text string) []*manifest.Document {
+	documents := manifest.Split(text)
+	errors := manifest.Check(documents)
+	if len(errors) == 0 && (len(*generators) > 0 || len(*patches) > 0) {
+		documents = ApplyGenerators(documents)
+		errors = manifest.Check(documents)
+	}
+	if len(errors) == 0 {
+		errors = manifest.CheckData(documents, *fixData)
+	}
+	if len(errors) == 0 && *convert {
+		manifest.Convert(documents)
+	}
+	if len(errors) == 0 && (*pinImages || len(*imageOverrides) > 0) {
+		errors = RewriteImages(documents)
+	}
+	if len(errors) == 0 && len(*kubeVersion) > 0 {
+		var err error
+		if errors, err = manifest.CheckAPIVersions(documents, *kubeVersion); err != nil {
+			Elog.Fatalf("--kube-version: %v\n", err)
+		}
+	}
+	if !Failed(errors) && *validate {
+		errors = append(errors, ValidateSchemas(documents)...)
+	}
+	ReportErrors(ttext, text, errors)
+	if Failed(errors) {
+		os.Exit(3)
+	}
+	documents, warnings := Transform(documents)
+	ReportErrors(ttext, text, warnings)
+	return documents
+}
+
+// ReportErrors writes errors to Stderr at the template line that
+// produced them
+func ReportErrors(ttext []byte, text string, errors []*manifest.Error) {
+	if len(errors) == 0 {
+		return
+	}
+	lines := manifest.NewLineMap(string(ttext), text)
+	for _, e := range errors {
+		if e.Line == 0 {
+			fmt.Fprintf(Stderr, "%s: %s (generated)\n", *TemplateFile, e.Describe())
+			continue
+		}
+		fmt.Fprintf(Stderr, "%s:%d:%d: %s (rendered line %d)\n",
+			*TemplateFile, lines.Template(e.Line), e.Column, e.Describe(), e.Line)
+	}
+}
+
+// RewriteImages applies --image-override to the container images and
+// with --pin-images appends the digest each resolves to
+func RewriteImages(documents []*manifest.Document) []*manifest.Error {
+	pairs, err := manifest.ParsePairs(*imageOverrides)
+	if err != nil {
+		Elog.Fatalf("--image-override: %v\n", err)
+	}
+	var overrides [][2]string
+	for _, pair := range pairs {
+		overrides = append(overrides, [2]string{fmt.Sprint(pair.Key), fmt.Sprint(pair.Value)})
+	}
+	var insecure []string
+	for _, host := range strings.Split(*insecureRegistries, ",") {
+		if host = Trim(host); len(host) > 0 {
+			insecure = append(insecure, host)
+		}
+	}
+	client := registry.NewClient(insecure...)
+	client.Credentials = RegistryCredentials
+	return manifest.RewriteImages(documents, func(image string) (string, error) {
+		image, err := registry.Override(image, overrides)
+		if err != nil || !*pinImages {
+			return image, err
+		}
+		return client.Pin(image)
+	})
+}
+
+// RegistryCredentials of a registry in --docker-config, empty when the
+// file or the registry is missing
+func RegistryCredentials(host string) (username, password string) {
+	text, err := ioutil.ReadFile(ExpandHome(*dockerConfigFile))
+	if err != nil {
+		return
+	}
+	var config manifest.DockerConfig
+	if err = json.Unmarshal(text, &config); err != nil {
+		Elog.Printf("%s: %v\n", *dockerConfigFile, err)
+		return
+	}
+	keys := []string{host, "https://" + host, "http://" + host, "https://" + host + "/v1/", "https://" + host + "/v2/"}
+	if host == registry.DockerHub {
+		keys = append(keys, "https://index.docker.io/v1/", "index.docker.io")
+	}
+	for _, key := range keys {
+		auth, ok := config.Auths[key]
+		if !ok {
+			continue
+		}
+		if len(auth.Username) > 0 || len(auth.Password) > 0 {
+			return auth.Username, auth.Password
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if parts := strings.SplitN(string(decoded), ":", 2); err == nil && len(parts) == 2 {
+			return parts[0], parts[1]
+		}
+	}
+	return
+}
+
+// Failed reports an error that is not a warning
+func Failed(errors []*manifest.Error) bool {
+	for _, e := range errors {
+		if !e.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteOutputDir writes the documents to --output-dir, one file per
+// resource named by --output-pattern
+func WriteOutputDir(documents []*manifest.Document) {
+	patternText := *outputPattern
+	switch *outputFormat {
+	case manifest.FormatJSON, manifest.FormatJSONStream:
+		for _, document := range documents {
+			if document.Object == nil {
+				continue
+			}
+			text, err := document.JSON(*outputFormat == manifest.FormatJSON)
+			if err != nil {
+				Elog.Fatalf("document %d (%s): %v\n", document.Index+1, document.Identity(), err)
+			}
+			document.Text = string(text) + "\n"
+		}
+		if patternText == manifest.DefaultPathPattern {
+			patternText = strings.TrimSuffix(patternText, ".yaml") + ".json"
+		}
+	case manifest.FormatYAML:
+	default:
+		Elog.Fatalf("--output-format %s can not be written to --output-dir\n", *outputFormat)
+	}
+	pattern, err := manifest.NewPathPattern(patternText)
+	if err != nil {
+		Elog.Fatalf("--output-pattern: %v\n", err)
+	}
+	if _, err = manifest.WriteDir(ExpandHome(*outputDir), documents, pattern, *pruneOutput); err != nil {
+		Elog.Fatalf("--output-dir %s: %v\n", *outputDir, err)
+	}
+}
+
+// Transforming reports if an option edits the rendered documents
+func Transforming() bool {
+	return len(*generators) > 0 || len(*namespace) > 0 || len(*commonLabels) > 0 || len(*commonAnnotations) > 0 ||
+		len(*inventory) > 0 || len(*patches) > 0 || *checksums || *sortOutput || *fixData || *convert || *pinImages || len(*imageOverrides) > 0 || *outputFormat != manifest.FormatYAML
+}
+
+// Transform applies the options editing the rendered documents,
+// returning the warnings of the edits
+func Transform(documents []*manifest.Document) ([]*manifest.Document, []*manifest.Error) {
+	var warnings []*manifest.Error
+	if len(*namespace) > 0 {
+		warnings = manifest.SetNamespace(documents, *namespace)
+	}
+	if len(*inventory) > 0 {
+		documents = AddInventory(documents)
+	}
+	labels, err := manifest.ParsePairs(*commonLabels)
+	if err != nil {
+		Elog.Fatalf("--common-labels: %v\n", err)
+	}
+	manifest.AddLabels(documents, labels)
+	annotations, err := manifest.ParsePairs(*commonAnnotations)
+	if err != nil {
+		Elog.Fatalf("--common-annotations: %v\n", err)
+	}
+	manifest.AddAnnotations(documents, annotations)
+	if *checksums {
+		manifest.AddChecksums(documents)
+	}
+	if err = manifest.EncodeModified(documents); err != nil {
+		Elog.Fatalf("%v\n", err)
+	}
+	if *sortOutput {
+		documents = manifest.SortInstallOrder(documents)
+	}
+	return documents, warnings
+}
+
+// ApplyGenerators runs the generators and applies the patches, encoding the
+// edited documents so they are checked as they are written
+func ApplyGenerators(documents []*manifest.Document) []*manifest.Document {
+	if len(*generators) > 0 {
+		documents = RunGenerators(documents)
+	}
+	if len(*patches) > 0 {
+		ApplyPatches(documents)
+	}
+	if err := manifest.EncodeModified(documents); err != nil {
+		Elog.Fatalf("%v\n", err)
+	}
+	return documents
+}
+
+// ApplyPatches applies the --patch files in order
+func ApplyPatches(documents []*manifest.Document) {
+	for _, filename := range strings.Split(*patches, ",") {
+		filename = strings.TrimSpace(filename)
+		if len(filename) == 0 {
+			continue
+		}
+		text, err := ioutil.ReadFile(ExpandHome(filename))
+		if err != nil {
+			Elog.Fatalf("--patch: %v\n", err)
+		}
+		list, err := manifest.ParsePatches(filename, string(text))
+		if err != nil {
+			Elog.Fatalf("--patch %v\n", err)
+		}
+		if err = manifest.ApplyPatches(documents, list); err != nil {
+			Elog.Fatalf("--patch %v\n", err)
+		}
+	}
+}
+
+// Namespace the namespace of resources rendered without one,
+// --namespace or default
+func Namespace() string {
+	if len(*namespace) > 0 {
+		return *namespace
+	}
+	return "default"
+}
+
+// AddInventory labels the documents with the inventory id and adds the
+// --inventory ConfigMap, in --namespace or default
+func AddInventory(documents []*manifest.Document) []*manifest.Document {
+	ns := Namespace()
+	id := *inventoryID
+	if len(id) == 0 {
+		id = naming.LabelValue(ns + "-" + *inventory)
+	} else if naming.LabelValue(id) != id {
+		Elog.Fatalf("--inventory-id %s: not a valid label value\n", id)
+	}
+	return manifest.AddInventory(documents, *inventory, ns, id)
+}
+
+// RunGenerators adds the objects described in --generators, named with a
+// hash of their content, and points the references of the rendered
+// workloads at the hashed names
+func RunGenerators(documents []*manifest.Document) []*manifest.Document {
+	list, err := manifest.ParseGenerators(Load(ExpandHome(*generators)))
+	if err != nil {
+		Elog.Fatalf("%s: %v\n", *generators, err)
+	}
+	var generated []*manifest.Document
+	for _, generator := range list {
+		values, err := MappingValues(generator.Sources())
+		if err != nil {
+			Elog.Fatalf("%s: generator %s: %v\n", *generators, generator.Name, err)
+		}
+		document, err := generator.Generate(values)
+		if err != nil {
+			Elog.Fatalf("%s: %v\n", *generators, err)
+		}
+		generated = append(generated, document)
+		manifest.RenameReferences(documents, generator.Kind, generator.Namespace, generator.Name, document.Name())
+	}
+	return manifest.Insert(documents, generated...)
 }
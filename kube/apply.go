@@ -0,0 +1,54 @@
+package kube
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/davidwalter0/k8s-template/manifest"
+)
+
+// retryInterval between reads of a kind a CustomResourceDefinition of
+// the same render defines, until the server serves it
+var retryInterval = time.Second
+
+// retries of a kind not yet served
+const retries = 30
+
+// ApplyDocument server side applies one resource, the result created,
+// configured or unchanged. A kind a CustomResourceDefinition of the
+// same render defines, defined holding its "apiVersion kind", is
+// retried until the server serves it.
+func (client *Client) ApplyDocument(document *manifest.Document, options ApplyOptions, defined map[string]bool) (string, error) {
+	apiVersion, kind, namespace, name := document.APIVersion(), document.Kind(), document.Namespace(), document.Name()
+	if len(name) == 0 {
+		return "", fmt.Errorf("server side apply needs metadata.name, generateName is not supported")
+	}
+	before, err := client.Get(apiVersion, kind, namespace, name)
+	if _, status := err.(*StatusError); err != nil && !status && defined[apiVersion+" "+kind] {
+		if options.DryRun {
+			return "skipped, its CustomResourceDefinition is not created by a dry run", nil
+		}
+		for tries := 0; err != nil && tries < retries; tries++ {
+			time.Sleep(retryInterval)
+			client.Forget(apiVersion)
+			before, err = client.Get(apiVersion, kind, namespace, name)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	body, err := document.JSON(false)
+	if err != nil {
+		return "", err
+	}
+	after, created, err := client.Apply(apiVersion, kind, namespace, name, body, options)
+	switch {
+	case err != nil:
+		return "", err
+	case created || before == nil:
+		return "created", nil
+	case manifest.Canonical(manifest.StripServerFields(before)) == manifest.Canonical(manifest.StripServerFields(after)):
+		return "unchanged", nil
+	}
+	return "configured", nil
+}
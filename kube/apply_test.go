@@ -0,0 +1,112 @@
+package kube
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyDocument(t *testing.T) {
+	server := newFakeServer(t)
+	client := server.client(t, "")
+	options := ApplyOptions{FieldManager: "k8s-template"}
+	path := "/api/v1/namespaces/default/services/web"
+	tests := []struct {
+		name    string
+		text    string
+		options ApplyOptions
+		result  string
+		request string
+	}{
+		{"created", serviceText, options, "created",
+			"PATCH " + path + "?fieldManager=k8s-template"},
+		{"unchanged", serviceText, options, "unchanged",
+			"PATCH " + path + "?fieldManager=k8s-template"},
+		{"configured", strings.Replace(serviceText, "80", "8080", 1), ApplyOptions{FieldManager: "ops", Force: true}, "configured",
+			"PATCH " + path + "?fieldManager=ops&force=true"},
+		{"dry run", strings.Replace(serviceText, "80", "9090", 1), ApplyOptions{FieldManager: "k8s-template", DryRun: true}, "configured",
+			"PATCH " + path + "?dryRun=All&fieldManager=k8s-template"},
+		{"dry run of a new object", strings.Replace(serviceText, "web", "api", 1), ApplyOptions{FieldManager: "k8s-template", DryRun: true}, "created",
+			"PATCH /api/v1/namespaces/default/services/api?dryRun=All&fieldManager=k8s-template"},
+	}
+	for _, test := range tests {
+		result, err := client.ApplyDocument(document(t, test.text), test.options, nil)
+		if err != nil || result != test.result {
+			t.Errorf("%s: ApplyDocument = %s, %v, want %s", test.name, result, err, test.result)
+		}
+		requests := server.take()
+		if last := requests[len(requests)-1]; last != test.request {
+			t.Errorf("%s: request %s, want %s", test.name, last, test.request)
+		}
+	}
+	if port := server.objects[path]["spec"].(map[string]interface{})["ports"].([]interface{})[0].(map[string]interface{})["port"]; port != float64(8080) {
+		t.Errorf("port %v after the dry run, want 8080", port)
+	}
+	if _, ok := server.objects["/api/v1/namespaces/default/services/api"]; ok {
+		t.Error("the dry run created the object")
+	}
+}
+
+func TestApplyDocumentErrors(t *testing.T) {
+	server := newFakeServer(t)
+	client := server.client(t, "team")
+	server.failures["/api/v1/namespaces/team/services/web"] = &StatusError{Code: 409, Reason: "Conflict",
+		Message: `Apply failed with 1 conflict: conflict with "kubectl": .spec.ports`}
+	tests := []struct {
+		text string
+		want string
+		code int
+	}{
+		{serviceText, `Apply failed with 1 conflict: conflict with "kubectl": .spec.ports`, 409},
+		{"apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\n", "the server does not serve example.com/v1", 0},
+		{"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  generateName: cfg-\n", "server side apply needs metadata.name, generateName is not supported", 0},
+	}
+	for _, test := range tests {
+		result, err := client.ApplyDocument(document(t, test.text), ApplyOptions{FieldManager: "k8s-template"}, nil)
+		if err == nil || err.Error() != test.want || len(result) > 0 {
+			t.Errorf("ApplyDocument = %q, %v, want %s", result, err, test.want)
+		}
+		if status, ok := err.(*StatusError); (test.code > 0) != ok || (ok && status.Code != test.code) {
+			t.Errorf("ApplyDocument error %#v, want a StatusError %d", err, test.code)
+		}
+	}
+}
+
+func TestApplyDocumentDefinedKind(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = time.Millisecond
+	server := newFakeServer(t)
+	client := server.client(t, "")
+	server.resources["example.com/v1"] = []Resource{{Name: "widgets", Kind: "Widget", Namespaced: true}}
+	widget := "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\nspec:\n  size: 3\n"
+	defined := map[string]bool{"example.com/v1 Widget": true}
+
+	server.unserved["example.com/v1"] = 1
+	result, err := client.ApplyDocument(document(t, widget), ApplyOptions{FieldManager: "k8s-template", DryRun: true}, defined)
+	if err != nil || !strings.HasPrefix(result, "skipped") {
+		t.Errorf("dry run ApplyDocument = %s, %v, want skipped", result, err)
+	}
+	server.take()
+
+	server.unserved["example.com/v1"] = 3
+	client.Forget("example.com/v1")
+	result, err = client.ApplyDocument(document(t, widget), ApplyOptions{FieldManager: "k8s-template"}, defined)
+	if err != nil || result != "created" {
+		t.Errorf("ApplyDocument = %s, %v, want created", result, err)
+	}
+	want := "GET /apis/example.com/v1,GET /apis/example.com/v1,GET /apis/example.com/v1,GET /apis/example.com/v1," +
+		"GET /apis/example.com/v1/namespaces/default/widgets/w,PATCH /apis/example.com/v1/namespaces/default/widgets/w?fieldManager=k8s-template"
+	if got := strings.Join(server.take(), ","); got != want {
+		t.Errorf("requests\n%s\nwant\n%s", got, want)
+	}
+
+	// a kind no definition of the render defines is not retried
+	server.unserved["example.com/v1"] = 1
+	client.Forget("example.com/v1")
+	if _, err = client.ApplyDocument(document(t, widget), ApplyOptions{FieldManager: "k8s-template"}, nil); err == nil {
+		t.Error("ApplyDocument of an unserved kind succeeded")
+	}
+	if got := len(server.take()); got != 1 {
+		t.Errorf("%d requests, want 1", got)
+	}
+}
@@ -0,0 +1,260 @@
+package kube
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Resource an api resource found by discovery
+type Resource struct {
+	// Name the plural, deployments
+	Name       string   `json:"name"`
+	Kind       string   `json:"kind"`
+	Namespaced bool     `json:"namespaced"`
+	Verbs      []string `json:"verbs"`
+}
+
+// StatusError an api server failure, its Status reply
+type StatusError struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *StatusError) Error() string {
+	if len(e.Message) > 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%d %s", e.Code, e.Reason)
+}
+
+// IsNotFound reports err is a 404 of the api server
+func IsNotFound(err error) bool {
+	status, ok := err.(*StatusError)
+	return ok && status.Code == http.StatusNotFound
+}
+
+// Client of an api server
+type Client struct {
+	Config *Config
+	HTTP   *http.Client
+
+	mutex     sync.Mutex
+	resources map[string][]Resource
+}
+
+// NewClient a Client of the server of config
+func NewClient(config *Config) (*Client, error) {
+	if len(config.Server) == 0 {
+		return nil, fmt.Errorf("kubeconfig cluster has no server")
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.Insecure}
+	if len(config.CAData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(config.CAData) {
+			return nil, fmt.Errorf("kubeconfig certificate authority holds no pem certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(config.CertData) > 0 {
+		certificate, err := tls.X509KeyPair(config.CertData, config.KeyData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}
+	return &Client{Config: config, HTTP: &http.Client{Transport: transport, Timeout: 60 * time.Second}}, nil
+}
+
+// Resource of kind in apiVersion, found by discovery
+func (client *Client) Resource(apiVersion, kind string) (*Resource, error) {
+	client.mutex.Lock()
+	resources, ok := client.resources[apiVersion]
+	client.mutex.Unlock()
+	if !ok {
+		path := "/apis/" + apiVersion
+		if !strings.Contains(apiVersion, "/") {
+			path = "/api/" + apiVersion
+		}
+		var list struct {
+			Resources []Resource `json:"resources"`
+		}
+		if err := client.Do("GET", path, "", nil, &list); err != nil {
+			if IsNotFound(err) {
+				return nil, fmt.Errorf("the server does not serve %s", apiVersion)
+			}
+			return nil, err
+		}
+		resources = list.Resources
+		client.mutex.Lock()
+		if client.resources == nil {
+			client.resources = make(map[string][]Resource)
+		}
+		client.resources[apiVersion] = resources
+		client.mutex.Unlock()
+	}
+	for i := range resources {
+		// subresources, deployments/scale, share the kind
+		if resources[i].Kind == kind && !strings.Contains(resources[i].Name, "/") {
+			return &resources[i], nil
+		}
+	}
+	return nil, fmt.Errorf("the server does not serve %s %s", apiVersion, kind)
+}
+
+// Path of the object, the namespace of the context or default for a
+// namespaced object without one; the namespace used is returned
+func (client *Client) Path(apiVersion, kind, namespace, name string) (string, string, error) {
+	resource, err := client.Resource(apiVersion, kind)
+	if err != nil {
+		return "", "", err
+	}
+	path := "/apis/" + apiVersion
+	if !strings.Contains(apiVersion, "/") {
+		path = "/api/" + apiVersion
+	}
+	if resource.Namespaced {
+		if len(namespace) == 0 {
+			namespace = client.Config.Namespace
+		}
+		if len(namespace) == 0 {
+			namespace = "default"
+		}
+		path += "/namespaces/" + url.PathEscape(namespace)
+	} else {
+		namespace = ""
+	}
+	return path + "/" + resource.Name + "/" + url.PathEscape(name), namespace, nil
+}
+
+// Get the live object, nil when it does not exist
+func (client *Client) Get(apiVersion, kind, namespace, name string) (yaml.MapSlice, error) {
+	path, _, err := client.Path(apiVersion, kind, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	var text json.RawMessage
+	if err = client.Do("GET", path, "", nil, &text); IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return Decode(text)
+}
+
+// Decode json into a yaml.MapSlice, keeping the key order
+func Decode(text []byte) (object yaml.MapSlice, err error) {
+	err = yaml.Unmarshal(text, &object)
+	return
+}
+
+// Do sends a request, decoding a json reply into out when not nil and a
+// failure into a *StatusError
+func (client *Client) Do(method, path, contentType string, body []byte, out interface{}) error {
+	_, err := client.do(method, path, contentType, body, out)
+	return err
+}
+
+// do sends a request as Do does, returning the http status
+func (client *Client) do(method, path, contentType string, body []byte, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequest(method, client.Config.Server+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if len(contentType) > 0 {
+		request.Header.Set("Content-Type", contentType)
+	}
+	switch {
+	case len(client.Config.Token) > 0:
+		request.Header.Set("Authorization", "Bearer "+client.Config.Token)
+	case len(client.Config.Username) > 0:
+		request.SetBasicAuth(client.Config.Username, client.Config.Password)
+	}
+	response, err := client.HTTP.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	text, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return response.StatusCode, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		status := &StatusError{}
+		if json.Unmarshal(text, status) != nil || status.Code == 0 {
+			status = &StatusError{Code: response.StatusCode, Reason: response.Status, Message: strings.TrimSpace(string(text))}
+		}
+		if len(status.Message) == 0 {
+			status.Message = fmt.Sprintf("%s %s: %s", method, path, response.Status)
+		}
+		return response.StatusCode, status
+	}
+	if out != nil {
+		if raw, ok := out.(*json.RawMessage); ok {
+			*raw = text
+			return response.StatusCode, nil
+		}
+		return response.StatusCode, json.Unmarshal(text, out)
+	}
+	return response.StatusCode, nil
+}
+
+// ApplyOptions of a server side apply
+type ApplyOptions struct {
+	// FieldManager owning the applied fields
+	FieldManager string
+	// Force takes ownership of fields another manager owns
+	Force bool
+	// DryRun has the server validate and default without persisting
+	DryRun bool
+}
+
+// Apply object, its json in body, with a server side apply. The object
+// the server returns is returned with created set when it is new.
+func (client *Client) Apply(apiVersion, kind, namespace, name string, body []byte, options ApplyOptions) (object yaml.MapSlice, created bool, err error) {
+	path, _, err := client.Path(apiVersion, kind, namespace, name)
+	if err != nil {
+		return nil, false, err
+	}
+	query := url.Values{}
+	query.Set("fieldManager", options.FieldManager)
+	if options.Force {
+		query.Set("force", "true")
+	}
+	if options.DryRun {
+		query.Set("dryRun", "All")
+	}
+	var text json.RawMessage
+	status, err := client.do("PATCH", path+"?"+query.Encode(), "application/apply-patch+yaml", body, &text)
+	if err != nil {
+		return nil, false, err
+	}
+	object, err = Decode(text)
+	return object, status == http.StatusCreated, err
+}
+
+// Forget the discovered resources of apiVersion, to find the kinds of
+// a CustomResourceDefinition applied since
+func (client *Client) Forget(apiVersion string) {
+	client.mutex.Lock()
+	delete(client.resources, apiVersion)
+	client.mutex.Unlock()
+}
@@ -0,0 +1,322 @@
+package kube
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/davidwalter0/k8s-template/manifest"
+)
+
+// fakeServer an api server holding objects in memory: discovery of the
+// groups in resources, GET of an object and server side apply PATCH,
+// which defaults a Service's clusterIP, merges a Secret's stringData
+// into data and adds the metadata the server maintains
+type fakeServer struct {
+	*httptest.Server
+	resources map[string][]Resource
+	objects   map[string]map[string]interface{}
+	// failures answers a PATCH of a path with a Status
+	failures map[string]*StatusError
+	// unserved counts the discovery requests of an apiVersion answered
+	// 404 before it is served, as for a CustomResourceDefinition just
+	// created
+	unserved map[string]int
+
+	mutex    sync.Mutex
+	requests []string
+	version  int
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	server := &fakeServer{
+		resources: map[string][]Resource{
+			"v1": {
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+				{Name: "secrets", Kind: "Secret", Namespaced: true},
+				{Name: "services", Kind: "Service", Namespaced: true},
+				{Name: "services/status", Kind: "Service", Namespaced: true},
+				{Name: "namespaces", Kind: "Namespace"},
+			},
+			"apps/v1": {
+				{Name: "deployments/scale", Kind: "Scale", Namespaced: true},
+				{Name: "deployments", Kind: "Deployment", Namespaced: true},
+			},
+		},
+		objects:  make(map[string]map[string]interface{}),
+		failures: make(map[string]*StatusError),
+		unserved: make(map[string]int),
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// client of the server, in the namespace of its context
+func (server *fakeServer) client(t *testing.T, namespace string) *Client {
+	client, err := NewClient(&Config{Server: server.URL, Namespace: namespace, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func (server *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.requests = append(server.requests, r.Method+" "+r.URL.RequestURI())
+	if r.Header.Get("Authorization") != "Bearer token" {
+		server.status(w, &StatusError{Code: http.StatusUnauthorized, Reason: "Unauthorized", Message: "Unauthorized"})
+		return
+	}
+	for apiVersion, resources := range server.resources {
+		if r.URL.Path == groupPath(apiVersion) {
+			if server.unserved[apiVersion] > 0 {
+				server.unserved[apiVersion]--
+				break
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"resources": resources})
+			return
+		}
+	}
+	switch r.Method {
+	case "GET":
+		object, ok := server.objects[r.URL.Path]
+		if !ok {
+			server.status(w, &StatusError{Code: http.StatusNotFound, Reason: "NotFound", Message: r.URL.Path + " not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(object)
+	case "PATCH":
+		if failure, ok := server.failures[r.URL.Path]; ok {
+			server.status(w, failure)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/apply-patch+yaml" || len(r.URL.Query().Get("fieldManager")) == 0 {
+			server.status(w, &StatusError{Code: http.StatusBadRequest, Reason: "BadRequest", Message: "not a server side apply"})
+			return
+		}
+		text, _ := ioutil.ReadAll(r.Body)
+		var applied map[string]interface{}
+		if err := json.Unmarshal(text, &applied); err != nil {
+			server.status(w, &StatusError{Code: http.StatusBadRequest, Reason: "BadRequest", Message: err.Error()})
+			return
+		}
+		live, exists := server.objects[r.URL.Path]
+		object := merge(copyObject(live), applied)
+		server.defaults(object)
+		if r.URL.Query().Get("dryRun") == "All" {
+			json.NewEncoder(w).Encode(object)
+			return
+		}
+		server.objects[r.URL.Path] = object
+		if !exists {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(object)
+	default:
+		server.status(w, &StatusError{Code: http.StatusMethodNotAllowed, Reason: "MethodNotAllowed"})
+	}
+}
+
+// defaults what the server fills in
+func (server *fakeServer) defaults(object map[string]interface{}) {
+	metadata := object["metadata"].(map[string]interface{})
+	if _, ok := metadata["uid"]; !ok {
+		metadata["uid"] = fmt.Sprintf("uid-%s", metadata["name"])
+		metadata["creationTimestamp"] = "2026-01-01T00:00:00Z"
+	}
+	server.version++
+	metadata["resourceVersion"] = fmt.Sprint(server.version)
+	metadata["managedFields"] = []interface{}{map[string]interface{}{"manager": "k8s-template"}}
+	switch object["kind"] {
+	case "Service":
+		spec, _ := object["spec"].(map[string]interface{})
+		if spec == nil {
+			spec = make(map[string]interface{})
+			object["spec"] = spec
+		}
+		if _, ok := spec["clusterIP"]; !ok {
+			spec["clusterIP"] = "10.0.0.10"
+		}
+	case "Secret":
+		if text, ok := object["stringData"].(map[string]interface{}); ok {
+			data, _ := object["data"].(map[string]interface{})
+			if data == nil {
+				data = make(map[string]interface{})
+			}
+			for key, value := range text {
+				data[key] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(value)))
+			}
+			object["data"] = data
+			delete(object, "stringData")
+		}
+	}
+}
+
+// set an object as it is live on the server
+func (server *fakeServer) set(path string, object map[string]interface{}) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.defaults(object)
+	server.objects[path] = object
+}
+
+func (server *fakeServer) status(w http.ResponseWriter, status *StatusError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status.Code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"kind": "Status", "status": "Failure", "code": status.Code, "reason": status.Reason, "message": status.Message,
+	})
+}
+
+// take the requests made since the last take
+func (server *fakeServer) take() []string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	requests := server.requests
+	server.requests = nil
+	return requests
+}
+
+func groupPath(apiVersion string) string {
+	if strings.Contains(apiVersion, "/") {
+		return "/apis/" + apiVersion
+	}
+	return "/api/" + apiVersion
+}
+
+func merge(object, patch map[string]interface{}) map[string]interface{} {
+	for key, value := range patch {
+		if next, ok := value.(map[string]interface{}); ok {
+			if current, ok := object[key].(map[string]interface{}); ok {
+				object[key] = merge(current, next)
+				continue
+			}
+		}
+		object[key] = value
+	}
+	return object
+}
+
+func copyObject(object map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	if object == nil {
+		return out
+	}
+	text, _ := json.Marshal(object)
+	json.Unmarshal(text, &out)
+	return out
+}
+
+func TestResource(t *testing.T) {
+	server := newFakeServer(t)
+	client := server.client(t, "")
+	tests := []struct {
+		apiVersion, kind string
+		name             string
+		namespaced       bool
+		err              string
+	}{
+		{"v1", "Service", "services", true, ""},
+		{"v1", "Namespace", "namespaces", false, ""},
+		{"apps/v1", "Deployment", "deployments", true, ""},
+		{"apps/v1", "StatefulSet", "", false, "the server does not serve apps/v1 StatefulSet"},
+		{"example.com/v1", "Widget", "", false, "the server does not serve example.com/v1"},
+	}
+	for _, test := range tests {
+		resource, err := client.Resource(test.apiVersion, test.kind)
+		if len(test.err) > 0 {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Resource(%s, %s) error %v, want %s", test.apiVersion, test.kind, err, test.err)
+			}
+			continue
+		}
+		if err != nil || resource.Name != test.name || resource.Namespaced != test.namespaced {
+			t.Errorf("Resource(%s, %s) = %+v, %v", test.apiVersion, test.kind, resource, err)
+		}
+	}
+	want := "GET /api/v1,GET /apis/apps/v1,GET /apis/example.com/v1"
+	if got := strings.Join(server.take(), ","); got != want {
+		t.Errorf("requests %s, want %s, discovery cached", got, want)
+	}
+	client.Forget("v1")
+	client.Resource("v1", "Service")
+	if got := strings.Join(server.take(), ","); got != "GET /api/v1" {
+		t.Errorf("requests after Forget %s", got)
+	}
+}
+
+func TestPath(t *testing.T) {
+	server := newFakeServer(t)
+	tests := []struct {
+		context, apiVersion, kind, namespace string
+		path, used                           string
+	}{
+		{"", "v1", "ConfigMap", "", "/api/v1/namespaces/default/configmaps/x", "default"},
+		{"team", "v1", "ConfigMap", "", "/api/v1/namespaces/team/configmaps/x", "team"},
+		{"team", "apps/v1", "Deployment", "prod", "/apis/apps/v1/namespaces/prod/deployments/x", "prod"},
+		{"team", "v1", "Namespace", "ignored", "/api/v1/namespaces/x", ""},
+	}
+	for _, test := range tests {
+		path, used, err := server.client(t, test.context).Path(test.apiVersion, test.kind, test.namespace, "x")
+		if err != nil || path != test.path || used != test.used {
+			t.Errorf("Path(%s %s %q) = %s, %q, %v", test.apiVersion, test.kind, test.namespace, path, used, err)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	server := newFakeServer(t)
+	client := server.client(t, "")
+	server.set("/api/v1/namespaces/default/configmaps/cfg", map[string]interface{}{
+		"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "cfg"},
+		"data": map[string]interface{}{"b": "2", "a": "1"},
+	})
+	object, err := client.Get("v1", "ConfigMap", "", "cfg")
+	if err != nil || manifest.GetString(object, "data", "a") != "1" || manifest.GetString(object, "metadata", "uid") != "uid-cfg" {
+		t.Errorf("Get = %v, %v", object, err)
+	}
+	if object, err = client.Get("v1", "ConfigMap", "", "missing"); object != nil || err != nil {
+		t.Errorf("Get of a missing object = %v, %v, want nil, nil", object, err)
+	}
+
+	client.Config.Token = "wrong"
+	_, err = client.Get("v1", "ConfigMap", "", "cfg")
+	if status, ok := err.(*StatusError); !ok || status.Code != http.StatusUnauthorized || IsNotFound(err) || err.Error() != "Unauthorized" {
+		t.Errorf("Get unauthorized error %#v", err)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/text":
+			http.Error(w, "plain failure", http.StatusInternalServerError)
+		case "/empty":
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	client, _ := NewClient(&Config{Server: server.URL})
+	tests := []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/text", 500, "plain failure"},
+		{"/empty", 403, "GET /empty: 403 Forbidden"},
+	}
+	for _, test := range tests {
+		err := client.Do("GET", test.path, "", nil, nil)
+		if status, ok := err.(*StatusError); !ok || status.Code != test.code || err.Error() != test.want {
+			t.Errorf("Do(%s) error %#v, want %d %s", test.path, err, test.code, test.want)
+		}
+	}
+}
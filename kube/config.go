@@ -0,0 +1,223 @@
+/*
+kube:
+
+A small client of the kubernetes api server: the connection a
+kubeconfig context describes, api discovery to find the resource of a
+kind, and the reads and server side applies the diff and apply
+commands need.
+*/
+
+package kube
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config the connection to an api server of a kubeconfig context
+type Config struct {
+	Server string
+	// Namespace of the context, for resources that name none
+	Namespace string
+	// CAData pem certificates of the server, the system roots if empty
+	CAData   []byte
+	Insecure bool
+	Token    string
+	Username string
+	Password string
+	// CertData and KeyData pem client certificate and key
+	CertData []byte
+	KeyData  []byte
+}
+
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string      `yaml:"token"`
+			TokenFile             string      `yaml:"tokenFile"`
+			ClientCertificate     string      `yaml:"client-certificate"`
+			ClientCertificateData string      `yaml:"client-certificate-data"`
+			ClientKey             string      `yaml:"client-key"`
+			ClientKeyData         string      `yaml:"client-key-data"`
+			Username              string      `yaml:"username"`
+			Password              string      `yaml:"password"`
+			Exec                  interface{} `yaml:"exec"`
+			AuthProvider          interface{} `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	// dir relative file names are read from
+	dir string
+}
+
+// serviceAccount where a pod finds its credentials
+const serviceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// LoadConfig reads the connection of context, the current context when
+// empty, from the kubeconfig files of path, $KUBECONFIG or
+// ~/.kube/config; the first file naming a cluster, user or context
+// wins, as kubectl merges them. Inside a pod without a kubeconfig the
+// service account is used.
+func LoadConfig(path, context string) (*Config, error) {
+	if len(path) == 0 {
+		path = os.Getenv("KUBECONFIG")
+	}
+	if len(path) == 0 {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".kube", "config")
+		}
+	}
+	var files []*kubeconfig
+	for _, filename := range filepath.SplitList(path) {
+		text, err := ioutil.ReadFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		file := &kubeconfig{dir: filepath.Dir(filename)}
+		if err = yaml.Unmarshal(text, file); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		if host := os.Getenv("KUBERNETES_SERVICE_HOST"); len(host) > 0 && len(context) == 0 {
+			return inCluster(host, os.Getenv("KUBERNETES_SERVICE_PORT"))
+		}
+		return nil, fmt.Errorf("no kubeconfig found in %s", path)
+	}
+	for _, file := range files {
+		if len(context) == 0 {
+			context = file.CurrentContext
+		}
+	}
+	if len(context) == 0 {
+		return nil, fmt.Errorf("kubeconfig %s has no current-context", path)
+	}
+	config := &Config{}
+	var clusterName, userName string
+	found := false
+	for _, file := range files {
+		for _, c := range file.Contexts {
+			if c.Name == context && !found {
+				found = true
+				clusterName, userName, config.Namespace = c.Context.Cluster, c.Context.User, c.Context.Namespace
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("kubeconfig %s has no context %s", path, context)
+	}
+	if err := config.cluster(files, clusterName); err != nil {
+		return nil, err
+	}
+	if err := config.user(files, userName); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (config *Config) cluster(files []*kubeconfig, name string) (err error) {
+	for _, file := range files {
+		for _, c := range file.Clusters {
+			if c.Name != name {
+				continue
+			}
+			config.Server = strings.TrimSuffix(c.Cluster.Server, "/")
+			config.Insecure = c.Cluster.InsecureSkipTLSVerify
+			config.CAData, err = data(file.dir, c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority)
+			return err
+		}
+	}
+	return fmt.Errorf("kubeconfig has no cluster %s", name)
+}
+
+func (config *Config) user(files []*kubeconfig, name string) (err error) {
+	for _, file := range files {
+		for _, u := range file.Users {
+			if u.Name != name {
+				continue
+			}
+			if u.User.Exec != nil || u.User.AuthProvider != nil {
+				return fmt.Errorf("kubeconfig user %s: exec and auth-provider credentials are not supported", name)
+			}
+			config.Token, config.Username, config.Password = u.User.Token, u.User.Username, u.User.Password
+			if len(config.Token) == 0 && len(u.User.TokenFile) > 0 {
+				token, err := ioutil.ReadFile(resolve(file.dir, u.User.TokenFile))
+				if err != nil {
+					return err
+				}
+				config.Token = strings.TrimSpace(string(token))
+			}
+			if config.CertData, err = data(file.dir, u.User.ClientCertificateData, u.User.ClientCertificate); err != nil {
+				return err
+			}
+			config.KeyData, err = data(file.dir, u.User.ClientKeyData, u.User.ClientKey)
+			return err
+		}
+	}
+	return fmt.Errorf("kubeconfig has no user %s", name)
+}
+
+// inCluster the connection of the service account of a pod
+func inCluster(host, port string) (*Config, error) {
+	token, err := ioutil.ReadFile(filepath.Join(serviceAccount, "token"))
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{Server: "https://" + host + ":" + port, Token: strings.TrimSpace(string(token)), Namespace: "default"}
+	if strings.Contains(host, ":") {
+		config.Server = "https://[" + host + "]:" + port
+	}
+	if config.CAData, err = ioutil.ReadFile(filepath.Join(serviceAccount, "ca.crt")); err != nil {
+		return nil, err
+	}
+	if namespace, err := ioutil.ReadFile(filepath.Join(serviceAccount, "namespace")); err == nil {
+		config.Namespace = strings.TrimSpace(string(namespace))
+	}
+	return config, nil
+}
+
+// data decodes the base64 inline value or reads the file
+func data(dir, inline, filename string) ([]byte, error) {
+	if len(inline) > 0 {
+		return base64.StdEncoding.DecodeString(inline)
+	}
+	if len(filename) > 0 {
+		return ioutil.ReadFile(resolve(dir, filename))
+	}
+	return nil, nil
+}
+
+// resolve a kubeconfig file name relative to the kubeconfig
+func resolve(dir, filename string) string {
+	if filepath.IsAbs(filename) {
+		return filename
+	}
+	return filepath.Join(dir, filename)
+}
@@ -0,0 +1,45 @@
+package kube
+
+import (
+	"fmt"
+
+	"github.com/davidwalter0/k8s-template/manifest"
+)
+
+// Diff the unified diff of the live object of document against the
+// object a server side apply of document would leave, found with a
+// dry run apply as kubectl diff does, so the fields the server
+// defaults or other managers own are not reported. Status and the
+// metadata the server maintains are ignored and Secret data is masked;
+// a new object is diffed against /dev/null.
+func (client *Client) Diff(document *manifest.Document, options ApplyOptions) (string, error) {
+	apiVersion, kind, namespace, name := document.APIVersion(), document.Kind(), document.Namespace(), document.Name()
+	if len(name) == 0 {
+		return "", fmt.Errorf("generateName resources are created, not diffed")
+	}
+	live, err := client.Get(apiVersion, kind, namespace, name)
+	if err != nil {
+		return "", err
+	}
+	body, err := document.JSON(false)
+	if err != nil {
+		return "", err
+	}
+	options.DryRun = true
+	merged, _, err := client.Apply(apiVersion, kind, namespace, name, body, options)
+	if err != nil {
+		return "", err
+	}
+	merged = manifest.StripServerFields(merged)
+	if live != nil {
+		live = manifest.StripServerFields(live)
+	}
+	if kind == "Secret" {
+		live, merged = manifest.MaskSecrets(live, merged)
+	}
+	before := "live/" + document.Identity()
+	if live == nil {
+		before = "/dev/null"
+	}
+	return manifest.Diff(manifest.Canonical(live), manifest.Canonical(merged), before, "merged/"+document.Identity()), nil
+}
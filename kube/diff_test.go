@@ -0,0 +1,105 @@
+package kube
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/davidwalter0/k8s-template/manifest"
+)
+
+func document(t *testing.T, text string) *manifest.Document {
+	documents := manifest.Split(text)
+	if errors := manifest.Check(documents); len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	return documents[0]
+}
+
+const serviceText = "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\nspec:\n  ports:\n  - port: 80\n"
+
+func TestDiff(t *testing.T) {
+	server := newFakeServer(t)
+	client := server.client(t, "")
+	options := ApplyOptions{FieldManager: "k8s-template"}
+	path := "/api/v1/namespaces/default/services/web"
+
+	// a new object against /dev/null, with the fields the server defaults
+	diff, err := client.Diff(document(t, serviceText), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- /dev/null\n+++ merged/v1/Service web\n@@ -0,0 +1,8 @@\n+apiVersion: v1\n+kind: Service\n+metadata:\n+  name: web\n" +
+		"+spec:\n+  clusterIP: 10.0.0.10\n+  ports:\n+  - port: 80\n"
+	if !strings.HasPrefix(diff, want) {
+		t.Errorf("Diff of a new object =\n%s\nwant\n%s", diff, want)
+	}
+	requests := strings.Join(server.take(), ",")
+	if !strings.Contains(requests, "PATCH "+path+"?dryRun=All&fieldManager=k8s-template") {
+		t.Errorf("requests %s, want a dry run apply", requests)
+	}
+	if _, ok := server.objects[path]; ok {
+		t.Fatal("the dry run created the object")
+	}
+
+	// live with status, server metadata and a defaulted field
+	server.set(path, map[string]interface{}{
+		"apiVersion": "v1", "kind": "Service",
+		"metadata": map[string]interface{}{"name": "web", "namespace": "default",
+			"annotations": map[string]interface{}{"kubectl.kubernetes.io/last-applied-configuration": "{}"}},
+		"spec":   map[string]interface{}{"ports": []interface{}{map[string]interface{}{"port": 80}}},
+		"status": map[string]interface{}{"loadBalancer": map[string]interface{}{}},
+	})
+	if diff, err = client.Diff(document(t, serviceText), options); err != nil || len(diff) > 0 {
+		t.Errorf("Diff of an unchanged object = %q, %v", diff, err)
+	}
+
+	diff, err = client.Diff(document(t, strings.Replace(serviceText, "80", "8080", 1)), options)
+	want = "--- live/v1/Service web\n+++ merged/v1/Service web\n"
+	if err != nil || !strings.HasPrefix(diff, want) || !strings.Contains(diff, "\n-  - port: 80\n+  - port: 8080\n") {
+		t.Errorf("Diff of a changed object =\n%s%v", diff, err)
+	}
+}
+
+func TestDiffSecret(t *testing.T) {
+	server := newFakeServer(t)
+	client := server.client(t, "team")
+	server.set("/api/v1/namespaces/team/secrets/s", map[string]interface{}{
+		"apiVersion": "v1", "kind": "Secret", "metadata": map[string]interface{}{"name": "s"},
+		"data": map[string]interface{}{"same": "c2FtZQ==", "changed": "b2xk"},
+	})
+	text := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\nstringData:\n  same: same\n  changed: new password\n  added: added\n"
+	diff, err := client.Diff(document(t, text), ApplyOptions{FieldManager: "k8s-template"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"same", "b2xk", "new password", "bmV3IHBhc3N3b3Jk", "YWRkZWQ="} {
+		if strings.Contains(diff, ": "+secret) {
+			t.Errorf("diff shows %s\n%s", secret, diff)
+		}
+	}
+	for _, line := range []string{"-  changed: '*** (before)'\n", "+  changed: '*** (after)'\n", "+  added: '***'\n", "   same: '***'\n"} {
+		if !strings.Contains(diff, line) {
+			t.Errorf("diff without %q\n%s", line, diff)
+		}
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	server := newFakeServer(t)
+	client := server.client(t, "")
+	server.failures["/api/v1/namespaces/default/services/web"] = &StatusError{Code: 422, Reason: "Invalid", Message: "spec.ports: Required value"}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{serviceText, "spec.ports: Required value"},
+		{"apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\n", "the server does not serve example.com/v1"},
+		{"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  generateName: cfg-\n", "generateName resources are created, not diffed"},
+	}
+	for _, test := range tests {
+		diff, err := client.Diff(document(t, test.text), ApplyOptions{FieldManager: "k8s-template"})
+		if err == nil || err.Error() != test.want || len(diff) > 0 {
+			t.Errorf("Diff error %v, want %s", err, test.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package kube
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/davidwalter0/k8s-template/manifest"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RolloutKinds the kinds WaitRollout waits for
+var RolloutKinds = map[string]bool{
+	"Deployment":            true,
+	"StatefulSet":           true,
+	"DaemonSet":             true,
+	"ReplicaSet":            true,
+	"ReplicationController": true,
+}
+
+// pollInterval between reads of an object rolling out
+var pollInterval = 2 * time.Second
+
+// WaitRollout polls a workload until the controller reports its pods
+// updated and available, or timeout passes
+func (client *Client) WaitRollout(apiVersion, kind, namespace, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		object, err := client.Get(apiVersion, kind, namespace, name)
+		if err != nil {
+			return err
+		}
+		if object == nil {
+			return fmt.Errorf("%s %s was deleted", kind, name)
+		}
+		done, progress := RolloutDone(kind, object)
+		if done {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("rollout not done after %s: %s", timeout, progress)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// RolloutDone reports the rollout of a workload complete, with the
+// progress when it is not, as kubectl rollout status judges it
+func RolloutDone(kind string, object yaml.MapSlice) (bool, string) {
+	if generation, observed := integer(object, "metadata", "generation"), integer(object, "status", "observedGeneration"); observed < generation {
+		return false, "waiting for the controller to observe the update"
+	}
+	replicas := integer(object, "spec", "replicas")
+	if manifest.Get(object, "spec", "replicas") == nil {
+		replicas = 1
+	}
+	switch kind {
+	case "Deployment":
+		updated := integer(object, "status", "updatedReplicas")
+		total := integer(object, "status", "replicas")
+		available := integer(object, "status", "availableReplicas")
+		switch {
+		case updated < replicas:
+			return false, fmt.Sprintf("%d of %d replicas updated", updated, replicas)
+		case total > updated:
+			return false, fmt.Sprintf("%d old replicas pending termination", total-updated)
+		case available < updated:
+			return false, fmt.Sprintf("%d of %d updated replicas available", available, updated)
+		}
+	case "StatefulSet":
+		ready := integer(object, "status", "readyReplicas")
+		updated := integer(object, "status", "updatedReplicas")
+		if ready < replicas {
+			return false, fmt.Sprintf("%d of %d replicas ready", ready, replicas)
+		}
+		if update, current := manifest.GetString(object, "status", "updateRevision"), manifest.GetString(object, "status", "currentRevision"); update != current && updated < replicas {
+			return false, fmt.Sprintf("%d of %d replicas updated", updated, replicas)
+		}
+	case "DaemonSet":
+		desired := integer(object, "status", "desiredNumberScheduled")
+		updated := integer(object, "status", "updatedNumberScheduled")
+		available := integer(object, "status", "numberAvailable")
+		switch {
+		case updated < desired:
+			return false, fmt.Sprintf("%d of %d pods updated", updated, desired)
+		case available < desired:
+			return false, fmt.Sprintf("%d of %d updated pods available", available, desired)
+		}
+	case "ReplicaSet", "ReplicationController":
+		ready := integer(object, "status", "readyReplicas")
+		if ready < replicas {
+			return false, fmt.Sprintf("%d of %d replicas ready", ready, replicas)
+		}
+	}
+	return true, ""
+}
+
+func integer(object yaml.MapSlice, path ...string) int64 {
+	switch v := manifest.Get(object, path...).(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case uint64:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
@@ -0,0 +1,71 @@
+package kube
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestRolloutDone(t *testing.T) {
+	tests := []struct {
+		kind     string
+		text     string
+		done     bool
+		progress string
+	}{
+		{"Deployment", "metadata: {generation: 2}\nstatus: {observedGeneration: 1}", false, "waiting for the controller to observe the update"},
+		{"Deployment", "spec: {replicas: 3}\nstatus: {updatedReplicas: 1, replicas: 3, availableReplicas: 1}", false, "1 of 3 replicas updated"},
+		{"Deployment", "spec: {replicas: 3}\nstatus: {updatedReplicas: 3, replicas: 4, availableReplicas: 3}", false, "1 old replicas pending termination"},
+		{"Deployment", "spec: {replicas: 3}\nstatus: {updatedReplicas: 3, replicas: 3, availableReplicas: 2}", false, "2 of 3 updated replicas available"},
+		{"Deployment", "metadata: {generation: 2}\nspec: {replicas: 3}\nstatus: {observedGeneration: 2, updatedReplicas: 3, replicas: 3, availableReplicas: 3}", true, ""},
+		{"Deployment", "status: {updatedReplicas: 1, replicas: 1, availableReplicas: 1}", true, ""},
+		{"Deployment", "spec: {replicas: 0}\nstatus: {}", true, ""},
+		{"StatefulSet", "spec: {replicas: 2}\nstatus: {readyReplicas: 1}", false, "1 of 2 replicas ready"},
+		{"StatefulSet", "spec: {replicas: 2}\nstatus: {readyReplicas: 2, updatedReplicas: 1, updateRevision: b, currentRevision: a}", false, "1 of 2 replicas updated"},
+		{"StatefulSet", "spec: {replicas: 2}\nstatus: {readyReplicas: 2, updatedReplicas: 2, updateRevision: b, currentRevision: a}", true, ""},
+		{"StatefulSet", "spec: {replicas: 2}\nstatus: {readyReplicas: 2, updateRevision: b, currentRevision: b}", true, ""},
+		{"DaemonSet", "status: {desiredNumberScheduled: 3, updatedNumberScheduled: 2, numberAvailable: 3}", false, "2 of 3 pods updated"},
+		{"DaemonSet", "status: {desiredNumberScheduled: 3, updatedNumberScheduled: 3, numberAvailable: 1}", false, "1 of 3 updated pods available"},
+		{"DaemonSet", "status: {desiredNumberScheduled: 3, updatedNumberScheduled: 3, numberAvailable: 3}", true, ""},
+		{"ReplicaSet", "spec: {replicas: 2}\nstatus: {readyReplicas: 1}", false, "1 of 2 replicas ready"},
+		{"ReplicaSet", "spec: {replicas: 2}\nstatus: {readyReplicas: 2}", true, ""},
+		{"ReplicationController", "status: {readyReplicas: 0}", false, "0 of 1 replicas ready"},
+		{"ReplicationController", "status: {readyReplicas: 1}", true, ""},
+	}
+	for _, test := range tests {
+		var object yaml.MapSlice
+		if err := yaml.Unmarshal([]byte(test.text), &object); err != nil {
+			t.Fatal(err)
+		}
+		done, progress := RolloutDone(test.kind, object)
+		if done != test.done || progress != test.progress {
+			t.Errorf("RolloutDone(%s, %s) = %v, %q, want %v, %q", test.kind, test.text, done, progress, test.done, test.progress)
+		}
+	}
+}
+
+func TestWaitRollout(t *testing.T) {
+	defer func(interval time.Duration) { pollInterval = interval }(pollInterval)
+	pollInterval = time.Millisecond
+	server := newFakeServer(t)
+	client := server.client(t, "")
+	path := "/apis/apps/v1/namespaces/default/deployments/web"
+	server.set(path, map[string]interface{}{
+		"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]interface{}{"name": "web"},
+		"spec":   map[string]interface{}{"replicas": 2},
+		"status": map[string]interface{}{"updatedReplicas": 2, "replicas": 2, "availableReplicas": 1},
+	})
+	err := client.WaitRollout("apps/v1", "Deployment", "", "web", 20*time.Millisecond)
+	if err == nil || !strings.HasSuffix(err.Error(), ": 1 of 2 updated replicas available") {
+		t.Errorf("WaitRollout error %v", err)
+	}
+	server.objects[path]["status"].(map[string]interface{})["availableReplicas"] = 2
+	if err = client.WaitRollout("apps/v1", "Deployment", "", "web", time.Second); err != nil {
+		t.Errorf("WaitRollout: %v", err)
+	}
+	if err = client.WaitRollout("apps/v1", "Deployment", "", "gone", time.Second); err == nil || err.Error() != "Deployment gone was deleted" {
+		t.Errorf("WaitRollout of a missing object error %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level of a logger, messages below the configured level are dropped
+type Level int
+
+// Levels in increasing severity
+const (
+	TraceLevel Level = iota
+	DebugLevel
+	InfoLevel
+	WarningLevel
+	ErrorLevel
+)
+
+// Levels by name
+var Levels = []string{"trace", "debug", "info", "warning", "error"}
+
+// Formats of a log line
+var Formats = []string{"text", "json"}
+
+// MaxFileSize a log file larger than this when opened is renamed to
+// <file>.1 and a new file started
+const MaxFileSize = 10 << 20
+
+// ParseLevel a level by name
+func ParseLevel(name string) (Level, error) {
+	for i, level := range Levels {
+		if strings.EqualFold(name, level) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %s, expected %s", name, strings.Join(Levels, "|"))
+}
+
+// ParseFormat a format by name
+func ParseFormat(name string) (string, error) {
+	for _, format := range Formats {
+		if strings.EqualFold(name, format) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown log format %s, expected %s", name, strings.Join(Formats, "|"))
+}
+
+func (level Level) String() string {
+	if level < 0 || int(level) >= len(Levels) {
+		return fmt.Sprintf("level(%d)", int(level))
+	}
+	return Levels[level]
+}
+
+// Options of Configure
+type Options struct {
+	// Output receives the messages of Level and above
+	Output io.Writer
+	Level  Level
+	// Format text or json, one object per line
+	Format string
+	// Filter edits each message before it is formatted, masking
+	// secret values; nil leaves messages alone
+	Filter func(string) string
+	// Errors also receives error messages, as text; stderr when the
+	// Output is a log file
+	Errors io.Writer
+}
+
+// Configure the package loggers in place, so copies of the logger
+// pointers follow the configuration
+func Configure(options Options) error {
+	format, err := ParseFormat(options.Format)
+	if err != nil {
+		return err
+	}
+	options.Format = format
+	var mutex sync.Mutex
+	for level, l := range []*log.Logger{Trace, Debug, Info, Warning, Error} {
+		var w io.Writer = ioutil.Discard
+		if Level(level) >= options.Level {
+			w = &sink{mutex: &mutex, level: Level(level), options: options, w: options.Output, format: options.Format}
+		}
+		if Level(level) == ErrorLevel && options.Errors != nil {
+			w = io.MultiWriter(w, &sink{mutex: &mutex, level: ErrorLevel, options: options, w: options.Errors, format: "text"})
+		}
+		l.SetPrefix("")
+		l.SetFlags(log.Lshortfile)
+		l.SetOutput(w)
+	}
+	// Plain writes undecorated debug text
+	if DebugLevel >= options.Level {
+		Plain.SetOutput(&sink{mutex: &mutex, level: DebugLevel, options: options, w: options.Output, format: options.Format, plain: true})
+	} else {
+		Plain.SetOutput(ioutil.Discard)
+	}
+	return nil
+}
+
+// OpenFile opens filename to append log messages, creating it readable
+// by its owner alone; an existing file is restricted to its owner and
+// one over MaxFileSize is first renamed to filename.1
+func OpenFile(filename string) (*os.File, error) {
+	if info, err := os.Stat(filename); err == nil && info.Size() > MaxFileSize {
+		if err = os.Rename(filename, filename+".1"); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Chmod(0600); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+var caller = regexp.MustCompile(`^([^ :]+\.go:\d+): `)
+
+// sink formats the messages of a log.Logger writing Lshortfile lines
+type sink struct {
+	mutex   *sync.Mutex
+	level   Level
+	options Options
+	w       io.Writer
+	format  string
+	plain   bool
+}
+
+func (s *sink) Write(p []byte) (int, error) {
+	text := string(p)
+	file := ""
+	if match := caller.FindStringSubmatch(text); match != nil && !s.plain {
+		file, text = match[1], text[len(match[0]):]
+	}
+	if s.options.Filter != nil {
+		text = s.options.Filter(text)
+	}
+	now := time.Now()
+	var line string
+	switch {
+	case s.format == "json":
+		record := struct {
+			Time    string `json:"time"`
+			Level   string `json:"level"`
+			Caller  string `json:"caller,omitempty"`
+			Message string `json:"message"`
+		}{now.Format(time.RFC3339Nano), s.level.String(), file, strings.TrimRight(text, "\n")}
+		var buffer strings.Builder
+		encoder := json.NewEncoder(&buffer)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(record); err != nil {
+			return 0, err
+		}
+		line = buffer.String()
+	case s.plain:
+		line = text
+	default:
+		line = fmt.Sprintf("%s: %s %s: %s", strings.ToUpper(s.level.String()), now.Format("2006/01/02 15:04:05"), file, text)
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := io.WriteString(s.w, line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
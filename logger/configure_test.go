@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		level Level
+		err   string
+	}{
+		{"trace", TraceLevel, ""},
+		{"debug", DebugLevel, ""},
+		{"Info", InfoLevel, ""},
+		{"WARNING", WarningLevel, ""},
+		{"error", ErrorLevel, ""},
+		{"warn", 0, "unknown log level warn, expected trace|debug|info|warning|error"},
+		{"", 0, "unknown log level , expected trace|debug|info|warning|error"},
+	}
+	for _, test := range tests {
+		level, err := ParseLevel(test.name)
+		if len(test.err) > 0 {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("ParseLevel(%s) error %v, want %s", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil || level != test.level || level.String() != strings.ToLower(test.name) {
+			t.Errorf("ParseLevel(%s) = %v, %v, want %v", test.name, level, err, test.level)
+		}
+	}
+	if got := Level(7).String(); got != "level(7)" {
+		t.Errorf("Level(7) = %s", got)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"text", "JSON"} {
+		if format, err := ParseFormat(name); err != nil || format != strings.ToLower(name) {
+			t.Errorf("ParseFormat(%s) = %s, %v", name, format, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil || err.Error() != "unknown log format xml, expected text|json" {
+		t.Errorf("ParseFormat(xml) error %v", err)
+	}
+	if err := Configure(Options{Output: &bytes.Buffer{}, Format: "xml"}); err == nil {
+		t.Error("Configure accepted format xml")
+	}
+}
+
+var textLine = regexp.MustCompile(`^(TRACE|DEBUG|INFO|WARNING|ERROR): \d{4}/\d\d/\d\d \d\d:\d\d:\d\d configure_test\.go:\d+: (.*)$`)
+
+func TestConfigureText(t *testing.T) {
+	var output, errors bytes.Buffer
+	if err := Configure(Options{Output: &output, Level: InfoLevel, Format: "text", Errors: &errors}); err != nil {
+		t.Fatal(err)
+	}
+	Trace.Println("trace")
+	Debug.Println("debug")
+	Plain.Println("plain")
+	Info.Println("info")
+	Warning.Printf("warning %d", 2)
+	Error.Println("error")
+	var got []string
+	for _, line := range strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n") {
+		match := textLine.FindStringSubmatch(line)
+		if match == nil {
+			t.Fatalf("line %q is not level: time file: message", line)
+		}
+		got = append(got, match[1]+" "+match[2])
+	}
+	if strings.Join(got, ",") != "INFO info,WARNING warning 2,ERROR error" {
+		t.Errorf("logged %v", got)
+	}
+	if match := textLine.FindStringSubmatch(strings.TrimSuffix(errors.String(), "\n")); match == nil || match[2] != "error" {
+		t.Errorf("errors %q", errors.String())
+	}
+}
+
+func TestConfigureJSON(t *testing.T) {
+	var output bytes.Buffer
+	if err := Configure(Options{Output: &output, Level: TraceLevel, Format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	Trace.Println("trace")
+	Plain.Print("plain <text>")
+	Error.Println("error\twith \"quotes\"")
+	var got []string
+	for _, line := range strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n") {
+		var record map[string]string
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		if len(record["time"]) == 0 || (record["level"] != "debug" && !strings.HasPrefix(record["caller"], "configure_test.go:")) {
+			t.Errorf("record %v", record)
+		}
+		got = append(got, record["level"]+" "+record["message"])
+	}
+	if want := "trace trace,debug plain <text>,error error\twith \"quotes\""; strings.Join(got, ",") != want {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
+
+func TestConfigureFilter(t *testing.T) {
+	var output, errors bytes.Buffer
+	filter := func(text string) string { return strings.Replace(text, "hunter22", "[redacted]", -1) }
+	for _, format := range Formats {
+		output.Reset()
+		errors.Reset()
+		if err := Configure(Options{Output: &output, Level: DebugLevel, Format: format, Filter: filter, Errors: &errors}); err != nil {
+			t.Fatal(err)
+		}
+		Info.Println("password hunter22")
+		Plain.Println("plain hunter22")
+		Error.Println("error hunter22")
+		for _, text := range []string{output.String(), errors.String()} {
+			if strings.Contains(text, "hunter22") || strings.Count(text, "[redacted]") != strings.Count(text, "\n") {
+				t.Errorf("%s: not filtered %q", format, text)
+			}
+		}
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "k8s-template.log")
+	f, err := OpenFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("first\n")
+	f.Close()
+	if info, err := os.Stat(filename); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("log file mode %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+	// an existing file is appended to and restricted to its owner
+	if err = os.Chmod(filename, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = OpenFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("second\n")
+	f.Close()
+	text, _ := ioutil.ReadFile(filename)
+	if info, _ := os.Stat(filename); string(text) != "first\nsecond\n" || info.Mode().Perm() != 0600 {
+		t.Errorf("log file %q mode %v", text, info.Mode().Perm())
+	}
+	// one over MaxFileSize is renamed to .1
+	if err = ioutil.WriteFile(filename, make([]byte, MaxFileSize+1), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = OpenFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if info, err := os.Stat(filename); err != nil || info.Size() != 0 || info.Mode().Perm() != 0600 {
+		t.Errorf("new log file %v, %v", info, err)
+	}
+	if info, err := os.Stat(filename + ".1"); err != nil || info.Size() != MaxFileSize+1 {
+		t.Errorf("rotated log file %v, %v", info, err)
+	}
+}
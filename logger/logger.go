@@ -55,5 +55,5 @@ func Args2String(args []interface{}) string {
 }
 
 func init() {
-	Init(ioutil.Discard, os.Stdout, os.Stdout, os.Stdout, os.Stderr, os.Stdout)
+	Init(ioutil.Discard, os.Stderr, os.Stderr, os.Stderr, os.Stderr, os.Stderr)
 }
@@ -0,0 +1,132 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// apiChange an apiVersion of kinds that is deprecated or removed in a
+// kubernetes release and the apiVersion that replaces it
+type apiChange struct {
+	apiVersion string
+	kinds      []string
+	// deprecated and removed releases, "" when not planned
+	deprecated, removed string
+	// replacement apiVersion, followed by the kind when it changes
+	replacement string
+}
+
+var apiChanges = []apiChange{
+	{"extensions/v1beta1", []string{"Deployment", "DaemonSet", "ReplicaSet"}, "1.8", "1.16", "apps/v1"},
+	{"extensions/v1beta1", []string{"NetworkPolicy"}, "1.9", "1.16", "networking.k8s.io/v1"},
+	{"extensions/v1beta1", []string{"PodSecurityPolicy"}, "1.10", "1.16", "policy/v1beta1"},
+	{"extensions/v1beta1", []string{"Ingress"}, "1.14", "1.22", "networking.k8s.io/v1"},
+	{"apps/v1beta1", []string{"Deployment", "StatefulSet", "ReplicaSet"}, "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", []string{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet"}, "1.9", "1.16", "apps/v1"},
+	{"networking.k8s.io/v1beta1", []string{"Ingress", "IngressClass"}, "1.19", "1.22", "networking.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", []string{"ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding"}, "1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", []string{"CustomResourceDefinition"}, "1.16", "1.22", "apiextensions.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", []string{"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration"}, "1.16", "1.22", "admissionregistration.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", []string{"APIService"}, "1.19", "1.22", "apiregistration.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", []string{"PriorityClass"}, "1.14", "1.22", "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", []string{"CSIDriver", "CSINode", "StorageClass", "VolumeAttachment"}, "1.19", "1.22", "storage.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", []string{"CertificateSigningRequest"}, "1.19", "1.22", "certificates.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", []string{"Lease"}, "1.19", "1.22", "coordination.k8s.io/v1"},
+	{"batch/v1beta1", []string{"CronJob"}, "1.21", "1.25", "batch/v1"},
+	{"policy/v1beta1", []string{"PodDisruptionBudget"}, "1.21", "1.25", "policy/v1"},
+	{"policy/v1beta1", []string{"PodSecurityPolicy"}, "1.21", "1.25", ""},
+	{"autoscaling/v2beta1", []string{"HorizontalPodAutoscaler"}, "1.22", "1.25", "autoscaling/v2"},
+	{"autoscaling/v2beta2", []string{"HorizontalPodAutoscaler"}, "1.23", "1.26", "autoscaling/v2"},
+	{"discovery.k8s.io/v1beta1", []string{"EndpointSlice"}, "1.21", "1.25", "discovery.k8s.io/v1"},
+	{"events.k8s.io/v1beta1", []string{"Event"}, "1.19", "1.25", "events.k8s.io/v1"},
+	{"node.k8s.io/v1beta1", []string{"RuntimeClass"}, "1.20", "1.25", "node.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", []string{"CSIStorageCapacity"}, "1.24", "1.27", "storage.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", []string{"FlowSchema", "PriorityLevelConfiguration"}, "1.23", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", []string{"FlowSchema", "PriorityLevelConfiguration"}, "1.26", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", []string{"FlowSchema", "PriorityLevelConfiguration"}, "1.29", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+	// not deprecated, superseded from 1.9, the first release serving
+	// apps/v1 Deployment
+	{"v1", []string{"ReplicationController"}, "1.9", "", "apps/v1 Deployment"},
+}
+
+// ParseVersion reads a kubernetes release, 1.29, v1.29 or 1.29.3
+func ParseVersion(version string) (major, minor int, err error) {
+	parts := strings.SplitN(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".", 3)
+	if len(parts) >= 2 {
+		if major, err = strconv.Atoi(parts[0]); err == nil {
+			if minor, err = strconv.Atoi(parts[1]); err == nil {
+				return
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid kubernetes version %q, expected X.Y", version)
+}
+
+// atLeast reports version is release or later, false for release ""
+func atLeast(major, minor int, release string) bool {
+	if len(release) == 0 {
+		return false
+	}
+	x, y, _ := ParseVersion(release)
+	return major > x || (major == x && minor >= y)
+}
+
+// CheckAPIVersions reports resources using an apiVersion removed in
+// version as errors and those deprecated in version as warnings
+func CheckAPIVersions(documents []*Document, version string) (errors []*Error, err error) {
+	major, minor, err := ParseVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	for _, document := range documents {
+		if document.Object == nil {
+			continue
+		}
+		change := findAPIChange(document.APIVersion(), document.Kind())
+		if change == nil || !atLeast(major, minor, change.deprecated) {
+			continue
+		}
+		e := &Error{
+			Index:    document.Index,
+			Identity: document.Identity(),
+			Warning:  true,
+		}
+		n := document.keyLine([]string{"apiVersion"})
+		e.Line, e.Column = document.streamLine(n), document.column(n)
+		what := document.APIVersion() + " " + document.Kind()
+		switch {
+		case atLeast(major, minor, change.removed):
+			e.Warning = false
+			e.Message = fmt.Sprintf("%s was removed in %s", what, change.removed)
+		case len(change.removed) > 0:
+			e.Message = fmt.Sprintf("%s is deprecated since %s and removed in %s", what, change.deprecated, change.removed)
+		default:
+			e.Message = fmt.Sprintf("%s is superseded", what)
+		}
+		if len(change.replacement) == 0 {
+			e.Message += ", it has no replacement"
+		} else {
+			e.Message += ", use " + change.replacement
+		}
+		if Convertible(document) {
+			e.Message += ", --convert rewrites it"
+		}
+		errors = append(errors, e)
+	}
+	return
+}
+
+func findAPIChange(apiVersion, kind string) *apiChange {
+	for i := range apiChanges {
+		if apiChanges[i].apiVersion != apiVersion {
+			continue
+		}
+		for _, k := range apiChanges[i].kinds {
+			if k == kind {
+				return &apiChanges[i]
+			}
+		}
+	}
+	return nil
+}
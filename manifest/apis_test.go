@@ -0,0 +1,82 @@
+package manifest
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version      string
+		major, minor int
+		err          bool
+	}{
+		{"1.29", 1, 29, false},
+		{"v1.22", 1, 22, false},
+		{" 1.25.3 ", 1, 25, false},
+		{"1", 0, 0, true},
+		{"1.x", 0, 0, true},
+		{"latest", 0, 0, true},
+	}
+	for _, test := range tests {
+		major, minor, err := ParseVersion(test.version)
+		if (err != nil) != test.err || major != test.major || minor != test.minor {
+			t.Errorf("ParseVersion(%q) = %d, %d, %v", test.version, major, minor, err)
+		}
+	}
+}
+
+func TestCheckAPIVersions(t *testing.T) {
+	tests := []struct {
+		apiVersion, kind, version string
+		want                      string
+	}{
+		// deprecated in 1.14, removed in 1.22
+		{"extensions/v1beta1", "Ingress", "1.13", ""},
+		{"extensions/v1beta1", "Ingress", "1.14", "warning: extensions/v1beta1 Ingress is deprecated since 1.14 and removed in 1.22, use networking.k8s.io/v1, --convert rewrites it"},
+		{"extensions/v1beta1", "Ingress", "1.21", "warning: extensions/v1beta1 Ingress is deprecated since 1.14 and removed in 1.22, use networking.k8s.io/v1, --convert rewrites it"},
+		{"extensions/v1beta1", "Ingress", "1.22", "extensions/v1beta1 Ingress was removed in 1.22, use networking.k8s.io/v1, --convert rewrites it"},
+		{"extensions/v1beta1", "Ingress", "v1.29.1", "extensions/v1beta1 Ingress was removed in 1.22, use networking.k8s.io/v1, --convert rewrites it"},
+		// the same apiVersion has a change per kind
+		{"extensions/v1beta1", "Deployment", "1.15", "warning: extensions/v1beta1 Deployment is deprecated since 1.8 and removed in 1.16, use apps/v1, --convert rewrites it"},
+		{"extensions/v1beta1", "DaemonSet", "1.16", "extensions/v1beta1 DaemonSet was removed in 1.16, use apps/v1, --convert rewrites it"},
+		{"batch/v1beta1", "CronJob", "1.20", ""},
+		{"batch/v1beta1", "CronJob", "1.25", "batch/v1beta1 CronJob was removed in 1.25, use batch/v1, --convert rewrites it"},
+		{"policy/v1beta1", "PodSecurityPolicy", "1.24", "warning: policy/v1beta1 PodSecurityPolicy is deprecated since 1.21 and removed in 1.25, it has no replacement"},
+		{"policy/v1beta1", "PodSecurityPolicy", "1.25", "policy/v1beta1 PodSecurityPolicy was removed in 1.25, it has no replacement"},
+		{"flowcontrol.apiserver.k8s.io/v1beta3", "FlowSchema", "1.31", "warning: flowcontrol.apiserver.k8s.io/v1beta3 FlowSchema is deprecated since 1.29 and removed in 1.32, use flowcontrol.apiserver.k8s.io/v1"},
+		// superseded from 1.9, the first release serving apps/v1
+		{"v1", "ReplicationController", "1.8", ""},
+		{"v1", "ReplicationController", "1.9", "warning: v1 ReplicationController is superseded, use apps/v1 Deployment, --convert rewrites it"},
+		{"v1", "ReplicationController", "1.29", "warning: v1 ReplicationController is superseded, use apps/v1 Deployment, --convert rewrites it"},
+		// current apiVersions
+		{"apps/v1", "Deployment", "1.29", ""},
+		{"networking.k8s.io/v1", "Ingress", "1.29", ""},
+		{"v1", "ConfigMap", "1.29", ""},
+	}
+	for _, test := range tests {
+		text := fmt.Sprintf("# %s\napiVersion: %s\nkind: %s\nmetadata:\n  name: x\n", test.version, test.apiVersion, test.kind)
+		errors, err := CheckAPIVersions(parse(t, text), test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if len(errors) > 0 {
+			e := errors[0]
+			got = fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+			if e.Warning {
+				got = fmt.Sprintf("%d:%d: warning: %s", e.Line, e.Column, e.Message)
+			}
+		}
+		want := ""
+		if len(test.want) > 0 {
+			want = "2:1: " + test.want
+		}
+		if len(errors) > 1 || got != want {
+			t.Errorf("%s %s at %s: %v, want %s", test.apiVersion, test.kind, test.version, errors, want)
+		}
+	}
+	if _, err := CheckAPIVersions(nil, "1"); err == nil {
+		t.Error("CheckAPIVersions accepted version 1")
+	}
+}
@@ -0,0 +1,146 @@
+package manifest
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Error in a document, Line and Column are in the rendered stream, Line
+// is 0 for a document not split from it, a generated one
+type Error struct {
+	Index    int
+	Identity string
+	Line     int
+	Column   int
+	Message  string
+	// Warning is reported without failing the render
+	Warning bool
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Describe())
+}
+
+// Describe the error without its position
+func (e *Error) Describe() string {
+	identity := ""
+	if len(e.Identity) > 0 {
+		identity = " (" + e.Identity + ")"
+	}
+	warning := ""
+	if e.Warning {
+		warning = "warning: "
+	}
+	return fmt.Sprintf("%sdocument %d%s: %s", warning, e.Index+1, identity, e.Message)
+}
+
+var yamlLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// Check documents parse as yaml mappings naming a resource with
+// apiVersion, kind and metadata.name, empty documents are skipped.
+// Documents are parsed as a side effect.
+func Check(documents []*Document) (errors []*Error) {
+	for _, document := range documents {
+		if err := document.Parse(); err != nil {
+			e := &Error{Index: document.Index, Line: document.streamLine(1), Column: 1, Message: err.Error()}
+			if match := yamlLine.FindStringSubmatch(err.Error()); match != nil {
+				n, _ := strconv.Atoi(match[1])
+				e.Line = document.streamLine(n)
+				e.Column = document.column(n)
+				e.Message = "yaml: " + match[2]
+			}
+			errors = append(errors, e)
+			continue
+		}
+		if document.Object == nil {
+			continue
+		}
+		for _, path := range [][]string{{"apiVersion"}, {"kind"}, {"metadata", "name"}} {
+			if len(GetString(document.Object, path...)) > 0 {
+				continue
+			}
+			if path[0] == "metadata" && len(GetString(document.Object, "metadata", "generateName")) > 0 {
+				continue
+			}
+			n := document.keyLine(path)
+			errors = append(errors, &Error{
+				Index:    document.Index,
+				Identity: document.Identity(),
+				Line:     document.streamLine(n),
+				Column:   document.column(n),
+				Message:  "missing " + strings.Join(path, "."),
+			})
+		}
+	}
+	return
+}
+
+// PathLine the stream line and column of a .spec.containers[0].image
+// style path, found by key names alone, list indexes are ignored
+func (document *Document) PathLine(path string) (line, column int) {
+	var keys []string
+	for _, key := range strings.Split(strings.Trim(path, "."), ".") {
+		if i := strings.Index(key, "["); i >= 0 {
+			key = key[:i]
+		}
+		if len(key) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	n := document.keyLine(keys)
+	return document.streamLine(n), document.column(n)
+}
+
+// streamLine the line of the stream holding line n of the document,
+// counting from 1, the first line of an encoded document and 0 for a
+// document not split from a stream
+func (document *Document) streamLine(n int) int {
+	if document.Line == 0 || document.Encoded {
+		return document.Line
+	}
+	return document.Line + n - 1
+}
+
+// keyLine the line of the document, counting from 1, holding the
+// deepest key of path present, or the first content line
+func (document *Document) keyLine(path []string) int {
+	lines := strings.Split(document.Text, "\n")
+	found, depth := 0, 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if found == 0 {
+			found = i + 1
+		}
+		trimmed = strings.TrimLeft(strings.TrimPrefix(trimmed, "-"), " ")
+		if depth < len(path) && hasKey(trimmed, path[depth]) &&
+			(depth > 0 || trimmed == line) {
+			found = i + 1
+			depth++
+		}
+	}
+	if found == 0 {
+		found = 1
+	}
+	return found
+}
+
+// hasKey reports a line starting with key, plain or quoted
+func hasKey(line, key string) bool {
+	return strings.HasPrefix(line, key+":") || strings.HasPrefix(line, `"`+key+`":`) ||
+		strings.HasPrefix(line, "'"+key+"':")
+}
+
+// column the first non blank column of line n, counting from 1, 1 for
+// an encoded document, as streamLine is its first line
+func (document *Document) column(n int) int {
+	lines := strings.Split(document.Text, "\n")
+	if n < 1 || n > len(lines) || document.Encoded {
+		return 1
+	}
+	return len(lines[n-1]) - len(strings.TrimLeft(lines[n-1], " \t")) + 1
+}
@@ -0,0 +1,94 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"valid", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n", nil},
+		{"empty and comment only documents", "---\n# nothing\n---\n\n", nil},
+		{"generateName", "apiVersion: v1\nkind: Pod\nmetadata:\n  generateName: p-\n", nil},
+		{"missing name in the second document",
+			"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  labels: {a: b}\n",
+			[]string{"8:1: document 2 (v1/ConfigMap <unnamed>): missing metadata.name"}},
+		{"missing apiVersion and kind after a comment",
+			"# head\nmetadata:\n  name: a\n",
+			[]string{"2:1: document 1 (/ a): missing apiVersion", "2:1: document 1 (/ a): missing kind"}},
+		// yaml.v2 reports the line of the key before the bad indentation
+		{"yaml error in the third document",
+			"kind: A\n---\nkind: B\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n   labels: {}\n",
+			[]string{"1:1: document 1 (/A <unnamed>): missing apiVersion", "1:1: document 1 (/A <unnamed>): missing metadata.name",
+				"3:1: document 2 (/B <unnamed>): missing apiVersion", "3:1: document 2 (/B <unnamed>): missing metadata.name",
+				"8:3: document 3: yaml: mapping values are not allowed in this context"}},
+		{"not a mapping", "apiVersion: v1\nkind: List\nmetadata:\n  name: a\n---\n- a\n- b\n",
+			[]string{"6:1: document 2: expected a mapping, found a sequence"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, e := range Check(Split(test.text)) {
+			got = append(got, e.Error())
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: Check =\n%s\nwant\n%s", test.name, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
+
+func TestPathLine(t *testing.T) {
+	documents := Split("a: 1\n---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  template:\n    spec:\n" +
+		"      containers:\n      - name: web\n        image: web:1\n")
+	if errors := Check(documents); len(errors) > 0 && errors[0].Index != 0 {
+		t.Fatal(errors)
+	}
+	tests := []struct {
+		path   string
+		line   int
+		column int
+	}{
+		{".spec.template.spec.containers[0].image", 12, 9},
+		{".spec.template.spec.containers[0].name", 11, 7},
+		{".metadata.name", 6, 3},
+		{".spec.replicas", 7, 1},
+		{".status", 3, 1},
+	}
+	for _, test := range tests {
+		if line, column := documents[1].PathLine(test.path); line != test.line || column != test.column {
+			t.Errorf("PathLine(%s) = %d:%d, want %d:%d", test.path, line, column, test.line, test.column)
+		}
+	}
+}
+
+// an encoded document is reported at its first line, a generated one at
+// line 0
+func TestCheckEdited(t *testing.T) {
+	documents := Split("# head\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  labels: {a: b}\n")
+	if errors := Check(documents); len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	documents[1].Object = Delete(documents[1].Object, "metadata", "name")
+	if err := documents[1].Encode(); err != nil {
+		t.Fatal(err)
+	}
+	generated, err := NewConfigMap("g", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated.Object = Delete(generated.Object, "metadata", "name")
+	if err = generated.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range Check(append(documents, generated)) {
+		got = append(got, e.Error())
+	}
+	want := "3:1: document 2 (v1/ConfigMap <unnamed>): missing metadata.name\n0:1: document 1 (v1/ConfigMap <unnamed>): missing metadata.name"
+	if strings.Join(got, "\n") != want {
+		t.Errorf("Check =\n%s\nwant\n%s", strings.Join(got, "\n"), want)
+	}
+}
@@ -0,0 +1,103 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/davidwalter0/k8s-template/naming"
+)
+
+// ChecksumPrefix of the pod template annotations AddChecksums writes
+const ChecksumPrefix = "checksum/"
+
+// AddChecksums annotates the pod template of every workload with
+// checksum/<name> for each ConfigMap and Secret of the stream it
+// references, so a change of their data changes the pod template and
+// rolls the workload. An empty namespace matches any namespace. A name
+// longer than the 63 characters of an annotation key name is truncated
+// and ends in a hash of the whole name.
+func AddChecksums(documents []*Document) {
+	for _, document := range documents {
+		if document.Object == nil || !document.IsWorkload() {
+			continue
+		}
+		// the referenced objects by name, a ConfigMap and a Secret may
+		// share a name and so an annotation
+		targets := make(map[string][]*Document)
+		for _, reference := range document.References() {
+			target := find(documents, reference.Kind, document.Namespace(), reference.Name)
+			if target != nil && !contains(targets[reference.Name], target) {
+				targets[reference.Name] = append(targets[reference.Name], target)
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+		var names []string
+		for name := range targets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		path := append(document.PodTemplatePath(), "metadata", "annotations")
+		if document.Kind() == "Pod" {
+			path = []string{"metadata", "annotations"}
+		}
+		annotations := GetMap(document.Object, path...)
+		for _, name := range names {
+			annotations = Set(annotations, DataChecksum(targets[name]...), ChecksumKey(name))
+		}
+		document.Object = Set(document.Object, annotations, path...)
+		document.Modified = true
+	}
+}
+
+// ChecksumKey the annotation key of the checksum of the objects name
+func ChecksumKey(name string) string {
+	return ChecksumPrefix + naming.LabelValue(name)
+}
+
+// DataChecksum the sha256 of the kind, type, data, binaryData and
+// stringData of objects
+func DataChecksum(documents ...*Document) string {
+	var content []map[string]interface{}
+	for _, document := range documents {
+		item := map[string]interface{}{"kind": document.Kind()}
+		for _, key := range []string{"type", "data", "binaryData", "stringData"} {
+			if value := Get(document.Object, key); value != nil {
+				item[key] = PlainMaps(value)
+			}
+		}
+		content = append(content, item)
+	}
+	sort.Slice(content, func(i, j int) bool {
+		return content[i]["kind"].(string) < content[j]["kind"].(string)
+	})
+	text, _ := json.Marshal(content)
+	sum := sha256.Sum256(text)
+	return hex.EncodeToString(sum[:])
+}
+
+// find the document of kind and name in namespace
+func find(documents []*Document, kind, namespace, name string) *Document {
+	for _, document := range documents {
+		if document.Object == nil || document.Kind() != kind || document.Name() != name {
+			continue
+		}
+		if len(namespace) == 0 || len(document.Namespace()) == 0 || document.Namespace() == namespace {
+			return document
+		}
+	}
+	return nil
+}
+
+func contains(documents []*Document, document *Document) bool {
+	for _, x := range documents {
+		if x == document {
+			return true
+		}
+	}
+	return false
+}
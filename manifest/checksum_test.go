@@ -0,0 +1,164 @@
+package manifest
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const checksumStream = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cfg
+data:
+  a: "1"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: cfg
+data:
+  b: Mg==
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        envFrom:
+        - configMapRef: {name: cfg}
+        - secretRef: {name: cfg}
+        - secretRef: {name: missing}
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+spec:
+  containers:
+  - name: c
+    env:
+    - name: A
+      valueFrom:
+        configMapKeyRef: {name: cfg, key: a}
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: nightly
+  namespace: other
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          volumes:
+          - name: v
+            configMap: {name: cfg}
+`
+
+// checksums the checksum annotations of each workload of stream
+func checksums(t *testing.T, stream string) map[string]map[string]string {
+	documents := parse(t, stream)
+	AddChecksums(documents)
+	annotations := make(map[string]map[string]string)
+	for _, document := range documents {
+		if !document.IsWorkload() {
+			continue
+		}
+		path := append(document.PodTemplatePath(), "metadata", "annotations")
+		if document.Kind() == "Pod" {
+			path = []string{"metadata", "annotations"}
+		}
+		annotations[document.Name()] = make(map[string]string)
+		for _, item := range GetMap(document.Object, path...) {
+			annotations[document.Name()][item.Key.(string)] = item.Value.(string)
+		}
+	}
+	return annotations
+}
+
+func TestAddChecksums(t *testing.T) {
+	base := checksums(t, checksumStream)
+	sha := regexp.MustCompile(`^[0-9a-f]{64}$`)
+	for _, name := range []string{"web", "pod"} {
+		if len(base[name]) != 1 || !sha.MatchString(base[name]["checksum/cfg"]) {
+			t.Errorf("%s annotations %v, want checksum/cfg", name, base[name])
+		}
+	}
+	// a ConfigMap and Secret of one name share the annotation
+	if base["web"]["checksum/cfg"] == base["pod"]["checksum/cfg"] {
+		t.Error("the checksum of a ConfigMap and Secret equals that of the ConfigMap")
+	}
+	// objects without a namespace match workloads of any namespace
+	if base["nightly"]["checksum/cfg"] != base["pod"]["checksum/cfg"] {
+		t.Errorf("nightly annotations %v", base["nightly"])
+	}
+	tests := []struct {
+		name     string
+		old, new string
+		web, pod bool
+	}{
+		{"unchanged", "", "", false, false},
+		{"configmap data", `a: "1"`, `a: "2"`, true, true},
+		{"secret data", "b: Mg==", "b: Mw==", true, false},
+		{"secret type", "kind: Secret\n", "kind: Secret\ntype: Opaque\n", true, false},
+		{"configmap metadata", "  name: cfg\ndata:\n  a:", "  name: cfg\n  labels: {x: y}\ndata:\n  a:", false, false},
+		{"configmap key added", `data:
+  a: "1"`, `data:
+  z: "0"
+  a: "1"`, true, true},
+	}
+	for _, test := range tests {
+		changed := checksums(t, strings.Replace(checksumStream, test.old, test.new, 1))
+		if (changed["web"]["checksum/cfg"] != base["web"]["checksum/cfg"]) != test.web ||
+			(changed["pod"]["checksum/cfg"] != base["pod"]["checksum/cfg"]) != test.pod {
+			t.Errorf("%s: checksums changed web %v pod %v, want %v %v", test.name,
+				changed["web"]["checksum/cfg"] != base["web"]["checksum/cfg"], changed["pod"]["checksum/cfg"] != base["pod"]["checksum/cfg"], test.web, test.pod)
+		}
+	}
+	reordered := checksums(t, strings.Replace(checksumStream, "data:\n  a: \"1\"", "data:\n  a: \"1\"\n  z: \"0\"", 1))
+	swapped := checksums(t, strings.Replace(checksumStream, "data:\n  a: \"1\"", "data:\n  z: \"0\"\n  a: \"1\"", 1))
+	if reordered["web"]["checksum/cfg"] != swapped["web"]["checksum/cfg"] {
+		t.Error("the checksum depends on the order of the data keys")
+	}
+}
+
+func TestChecksumKey(t *testing.T) {
+	long := strings.Repeat("very-long-config-map-name-", 5)
+	key := regexp.MustCompile(`^checksum/[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"cfg", "checksum/cfg"},
+		{strings.Repeat("a", 63), "checksum/" + strings.Repeat("a", 63)},
+		{long + "a", ""},
+		{long + "b", ""},
+		{"db.example-settings", "checksum/db.example-settings"},
+	}
+	seen := make(map[string]bool)
+	for _, test := range tests {
+		got := ChecksumKey(test.name)
+		if len(test.want) > 0 && got != test.want {
+			t.Errorf("ChecksumKey(%s) = %s, want %s", test.name, got, test.want)
+		}
+		if name := strings.TrimPrefix(got, ChecksumPrefix); len(name) > 63 || !key.MatchString(got) {
+			t.Errorf("ChecksumKey(%s) = %s, a %d character name", test.name, got, len(name))
+		}
+		if seen[got] {
+			t.Errorf("ChecksumKey(%s) = %s, given for another name", test.name, got)
+		}
+		seen[got] = true
+	}
+	stream := strings.Replace(strings.Replace(checksumStream, "name: cfg}", "name: "+long+"a}", -1), "  name: cfg\n", "  name: "+long+"a\n", -1)
+	for key := range checksums(t, stream)["web"] {
+		if key != ChecksumKey(long+"a") {
+			t.Errorf("annotation %s, want %s", key, ChecksumKey(long+"a"))
+		}
+	}
+}
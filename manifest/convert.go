@@ -0,0 +1,156 @@
+package manifest
+
+import (
+	"strconv"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// renames the apiVersion of a kind whose schema did not change
+var renames = map[string]string{
+	"rbac.authorization.k8s.io/v1beta1 ClusterRole":        "rbac.authorization.k8s.io/v1",
+	"rbac.authorization.k8s.io/v1beta1 ClusterRoleBinding": "rbac.authorization.k8s.io/v1",
+	"rbac.authorization.k8s.io/v1beta1 Role":               "rbac.authorization.k8s.io/v1",
+	"rbac.authorization.k8s.io/v1beta1 RoleBinding":        "rbac.authorization.k8s.io/v1",
+	"extensions/v1beta1 NetworkPolicy":                     "networking.k8s.io/v1",
+	"networking.k8s.io/v1beta1 IngressClass":               "networking.k8s.io/v1",
+	"scheduling.k8s.io/v1beta1 PriorityClass":              "scheduling.k8s.io/v1",
+	"batch/v1beta1 CronJob":                                "batch/v1",
+	"policy/v1beta1 PodDisruptionBudget":                   "policy/v1",
+	"autoscaling/v2beta2 HorizontalPodAutoscaler":          "autoscaling/v2",
+}
+
+// workloadVersions the apiVersions of workloads replaced by apps/v1
+var workloadVersions = map[string]bool{
+	"extensions/v1beta1": true,
+	"apps/v1beta1":       true,
+	"apps/v1beta2":       true,
+}
+
+// Convertible reports a document Convert rewrites
+func Convertible(document *Document) bool {
+	apiVersion, kind := document.APIVersion(), document.Kind()
+	switch {
+	case apiVersion == "v1" && kind == "ReplicationController":
+		return true
+	case kind == "Ingress":
+		return apiVersion == "extensions/v1beta1" || apiVersion == "networking.k8s.io/v1beta1"
+	case workloadVersions[apiVersion] && (kind == "Deployment" || kind == "DaemonSet" ||
+		kind == "ReplicaSet" || kind == "StatefulSet"):
+		return true
+	}
+	_, ok := renames[apiVersion+" "+kind]
+	return ok
+}
+
+// Convert rewrites the resources of replaced apiVersions to their
+// replacement: a ReplicationController becomes an apps/v1 Deployment,
+// beta workloads apps/v1 with the selector apps/v1 requires, beta
+// Ingresses networking.k8s.io/v1 with the new backend structure and
+// kinds whose schema did not change only a new apiVersion. The
+// converted documents are returned.
+func Convert(documents []*Document) (converted []*Document) {
+	for _, document := range documents {
+		if document.Object == nil || !Convertible(document) {
+			continue
+		}
+		apiVersion, kind := document.APIVersion(), document.Kind()
+		object := document.Object
+		switch {
+		case kind == "ReplicationController":
+			object = Set(object, "apps/v1", "apiVersion")
+			object = Set(object, "Deployment", "kind")
+			selector := GetMap(object, "spec", "selector")
+			if _, ok := Get(selector, "matchLabels").(yaml.MapSlice); !ok {
+				object = Set(object, yaml.MapSlice{{Key: "matchLabels", Value: selector}}, "spec", "selector")
+			}
+			object = defaultSelector(object)
+		case kind == "Ingress":
+			object = Set(object, "networking.k8s.io/v1", "apiVersion")
+			object = convertIngress(object)
+		case workloadVersions[apiVersion]:
+			object = Set(object, "apps/v1", "apiVersion")
+			object = Delete(object, "spec", "rollbackTo")
+			object = Delete(object, "spec", "templateGeneration")
+			object = defaultSelector(object)
+		default:
+			object = Set(object, renames[apiVersion+" "+kind], "apiVersion")
+		}
+		document.Object = object
+		document.Modified = true
+		converted = append(converted, document)
+	}
+	return
+}
+
+// defaultSelector sets an empty or missing spec.selector.matchLabels
+// to the labels of the pod template, as the beta apis defaulted it
+func defaultSelector(object yaml.MapSlice) yaml.MapSlice {
+	if len(GetMap(object, "spec", "selector", "matchLabels")) > 0 ||
+		len(GetList(object, "spec", "selector", "matchExpressions")) > 0 {
+		return object
+	}
+	labels := GetMap(object, "spec", "template", "metadata", "labels")
+	if len(labels) == 0 {
+		return object
+	}
+	return Set(object, labels, "spec", "selector", "matchLabels")
+}
+
+// convertIngress moves an extensions or networking.k8s.io/v1beta1
+// Ingress spec to networking.k8s.io/v1
+func convertIngress(object yaml.MapSlice) yaml.MapSlice {
+	spec := GetMap(object, "spec")
+	for i, item := range spec {
+		if item.Key == "backend" {
+			spec[i] = yaml.MapItem{Key: "defaultBackend", Value: ingressBackend(item.Value)}
+		}
+	}
+	for _, rule := range GetList(spec, "rules") {
+		// the list shares its elements with the object, paths are
+		// replaced in place
+		paths := GetList(rule, "http", "paths")
+		for i, path := range paths {
+			mapping, ok := path.(yaml.MapSlice)
+			if !ok {
+				continue
+			}
+			for j, item := range mapping {
+				if item.Key == "backend" {
+					mapping[j].Value = ingressBackend(item.Value)
+				}
+			}
+			if _, ok := Get(mapping, "pathType").(string); !ok {
+				mapping = append(mapping, yaml.MapItem{Key: "pathType", Value: "ImplementationSpecific"})
+			}
+			paths[i] = mapping
+		}
+	}
+	return object
+}
+
+// ingressBackend converts a serviceName, servicePort backend to a
+// service backend, a port number or name; resource backends are kept
+func ingressBackend(value interface{}) interface{} {
+	backend, ok := value.(yaml.MapSlice)
+	name := GetString(backend, "serviceName")
+	if !ok || len(name) == 0 {
+		return value
+	}
+	port := yaml.MapSlice{{Key: "name", Value: Get(backend, "servicePort")}}
+	switch v := Get(backend, "servicePort").(type) {
+	case int:
+		port[0] = yaml.MapItem{Key: "number", Value: v}
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			port[0] = yaml.MapItem{Key: "number", Value: n}
+		}
+	}
+	out := yaml.MapSlice{{Key: "service", Value: yaml.MapSlice{{Key: "name", Value: name}, {Key: "port", Value: port}}}}
+	for _, item := range backend {
+		if item.Key != "serviceName" && item.Key != "servicePort" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
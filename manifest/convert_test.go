@@ -0,0 +1,97 @@
+package manifest
+
+import (
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "replication controller",
+			text: "apiVersion: v1\nkind: ReplicationController\nmetadata:\n  name: web\nspec:\n  replicas: 2\n  selector:\n    app: web\n" +
+				"  template:\n    metadata:\n      labels:\n        app: web\n        tier: front\n",
+			want: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 2\n  selector:\n    matchLabels:\n      app: web\n" +
+				"  template:\n    metadata:\n      labels:\n        app: web\n        tier: front\n",
+		},
+		{
+			name: "replication controller without a selector",
+			text: "apiVersion: v1\nkind: ReplicationController\nmetadata:\n  name: web\nspec:\n  template:\n    metadata:\n      labels:\n        app: web\n",
+			want: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  template:\n    metadata:\n      labels:\n        app: web\n" +
+				"  selector:\n    matchLabels:\n      app: web\n",
+		},
+		{
+			name: "beta deployment",
+			text: "apiVersion: extensions/v1beta1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  rollbackTo:\n    revision: 2\n" +
+				"  templateGeneration: 3\n  template:\n    metadata:\n      labels:\n        app: web\n",
+			want: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  template:\n    metadata:\n      labels:\n        app: web\n" +
+				"  selector:\n    matchLabels:\n      app: web\n",
+		},
+		{
+			name: "beta statefulset selector kept",
+			text: "apiVersion: apps/v1beta2\nkind: StatefulSet\nmetadata:\n  name: db\nspec:\n  selector:\n    matchExpressions:\n" +
+				"    - {key: app, operator: In, values: [db]}\n  template:\n    metadata:\n      labels:\n        app: db\n",
+			want: "apiVersion: apps/v1\nkind: StatefulSet\nmetadata:\n  name: db\nspec:\n  selector:\n    matchExpressions:\n" +
+				"    - key: app\n      operator: In\n      values:\n      - db\n  template:\n    metadata:\n      labels:\n        app: db\n",
+		},
+		{
+			name: "ingress backends",
+			text: "apiVersion: extensions/v1beta1\nkind: Ingress\nmetadata:\n  name: web\nspec:\n  backend:\n    serviceName: default\n    servicePort: 80\n" +
+				"  rules:\n  - host: example.com\n    http:\n      paths:\n      - path: /\n        backend:\n          serviceName: web\n          servicePort: \"8080\"\n" +
+				"      - path: /api\n        pathType: Prefix\n        backend:\n          serviceName: api\n          servicePort: http\n" +
+				"      - path: /static\n        backend:\n          resource:\n            kind: StorageBucket\n            name: static\n",
+			want: "apiVersion: networking.k8s.io/v1\nkind: Ingress\nmetadata:\n  name: web\nspec:\n  defaultBackend:\n    service:\n      name: default\n      port:\n        number: 80\n" +
+				"  rules:\n  - host: example.com\n    http:\n      paths:\n      - path: /\n        backend:\n          service:\n            name: web\n            port:\n              number: 8080\n" +
+				"        pathType: ImplementationSpecific\n" +
+				"      - path: /api\n        pathType: Prefix\n        backend:\n          service:\n            name: api\n            port:\n              name: http\n" +
+				"      - path: /static\n        backend:\n          resource:\n            kind: StorageBucket\n            name: static\n        pathType: ImplementationSpecific\n",
+		},
+		{
+			name: "renamed apiVersion",
+			text: "apiVersion: batch/v1beta1\nkind: CronJob\nmetadata:\n  name: nightly\nspec:\n  schedule: '@daily'\n",
+			want: "apiVersion: batch/v1\nkind: CronJob\nmetadata:\n  name: nightly\nspec:\n  schedule: '@daily'\n",
+		},
+	}
+	for _, test := range tests {
+		documents := parse(t, test.text)
+		if converted := Convert(documents); len(converted) != 1 || !converted[0].Modified || Convertible(documents[0]) {
+			t.Errorf("%s: converted %v", test.name, converted)
+		}
+		if got := encode(t, documents); got != test.want {
+			t.Errorf("%s: Convert =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestConvertible(t *testing.T) {
+	tests := []struct {
+		apiVersion, kind string
+		want             bool
+	}{
+		{"v1", "ReplicationController", true},
+		{"extensions/v1beta1", "Ingress", true},
+		{"networking.k8s.io/v1beta1", "Ingress", true},
+		{"extensions/v1beta1", "DaemonSet", true},
+		{"apps/v1beta1", "StatefulSet", true},
+		{"rbac.authorization.k8s.io/v1beta1", "Role", true},
+		{"autoscaling/v2beta2", "HorizontalPodAutoscaler", true},
+		// the v2beta1 metrics changed shape
+		{"autoscaling/v2beta1", "HorizontalPodAutoscaler", false},
+		{"policy/v1beta1", "PodSecurityPolicy", false},
+		{"extensions/v1beta1", "PodSecurityPolicy", false},
+		{"apps/v1", "Deployment", false},
+		{"networking.k8s.io/v1", "Ingress", false},
+	}
+	for _, test := range tests {
+		documents := parse(t, "apiVersion: "+test.apiVersion+"\nkind: "+test.kind+"\nmetadata:\n  name: x\n")
+		if got := Convertible(documents[0]); got != test.want {
+			t.Errorf("Convertible(%s %s) = %v, want %v", test.apiVersion, test.kind, got, test.want)
+		}
+		if converted := Convert(documents); (len(converted) == 1) != test.want {
+			t.Errorf("Convert(%s %s) converted %d", test.apiVersion, test.kind, len(converted))
+		}
+	}
+}
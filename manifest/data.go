@@ -0,0 +1,163 @@
+package manifest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// MaxDataSize the largest data a Secret or ConfigMap may hold, 1 MiB,
+// counted as the API server does
+const MaxDataSize = 1 << 20
+
+// CheckData checks the Secrets and ConfigMaps of documents as the API
+// server would: keys of data, stringData and binaryData hold only
+// alphanumerics, -, _ and ., Secret data and ConfigMap binaryData values
+// are base64, ConfigMap data values are strings and the data stays
+// within MaxDataSize.
+//
+// With fix a Secret data value that is not base64 but is text is moved
+// to stringData, and a ConfigMap data number or bool is made a string,
+// instead of reported. A text value that happens to be valid base64,
+// "abcd", can not be told apart from an encoded one and is kept.
+func CheckData(documents []*Document, fix bool) (errors []*Error) {
+	for _, document := range documents {
+		kind := document.Kind()
+		if document.Object == nil || document.APIVersion() != "v1" || (kind != "Secret" && kind != "ConfigMap") {
+			continue
+		}
+		report := func(path []string, format string, args ...interface{}) {
+			n := document.keyLine(path)
+			errors = append(errors, &Error{
+				Index:    document.Index,
+				Identity: document.Identity(),
+				Line:     document.streamLine(n),
+				Column:   document.column(n),
+				Message:  strings.Join(path, ".") + ": " + fmt.Sprintf(format, args...),
+			})
+		}
+		for _, field := range []string{"data", "stringData", "binaryData"} {
+			for _, item := range GetMap(document.Object, field) {
+				if key := fmt.Sprint(item.Key); !SecretKey.MatchString(key) {
+					report([]string{field, key}, "invalid key, only alphanumerics, -, _ and . are allowed")
+				}
+			}
+		}
+		encoded := []string{"binaryData"}
+		if kind == "Secret" {
+			encoded = []string{"data"}
+		}
+		for _, field := range encoded {
+			var moved yaml.MapSlice
+			var kept yaml.MapSlice
+			for _, item := range GetMap(document.Object, field) {
+				key := fmt.Sprint(item.Key)
+				if item.Value == nil {
+					kept = append(kept, item)
+					continue
+				}
+				text, ok := item.Value.(string)
+				if !ok {
+					report([]string{field, key}, "expected a base64 string, found %s", scalar(item.Value))
+					kept = append(kept, item)
+					continue
+				}
+				_, err := decodeBase64(text)
+				if err == nil {
+					kept = append(kept, item)
+					continue
+				}
+				if fix && field == "data" && utf8.ValidString(text) && Get(document.Object, "stringData", key) == nil {
+					moved = append(moved, item)
+					continue
+				}
+				report([]string{field, key}, "value is not base64, %v", err)
+				kept = append(kept, item)
+			}
+			if len(moved) > 0 {
+				document.Object = Set(document.Object, append(GetMap(document.Object, "stringData"), moved...), "stringData")
+				if len(kept) > 0 {
+					document.Object = Set(document.Object, kept, field)
+				} else {
+					document.Object = Delete(document.Object, field)
+				}
+				document.Modified = true
+			}
+		}
+		if kind == "ConfigMap" {
+			data := GetMap(document.Object, "data")
+			for i, item := range data {
+				switch value := item.Value.(type) {
+				case string, nil:
+				case int, int64, uint64, float64, bool:
+					if fix {
+						data[i].Value = fmt.Sprint(value)
+						document.Modified = true
+						continue
+					}
+					report([]string{"data", fmt.Sprint(item.Key)}, "expected a string, found %s, quote it", scalar(value))
+				default:
+					report([]string{"data", fmt.Sprint(item.Key)}, "expected a string, found %s", scalar(value))
+				}
+			}
+		}
+		if size := dataSize(document); size > MaxDataSize {
+			report([]string{"metadata", "name"}, "data of %d bytes exceeds the %d byte limit", size, MaxDataSize)
+		}
+	}
+	return
+}
+
+// dataSize the bytes the API server counts against MaxDataSize: the
+// length of every key and of its value, decoded for base64 fields,
+// with a Secret's stringData replacing the data of the same key as it
+// is merged on the server
+func dataSize(document *Document) int {
+	sizes := make(map[string]int)
+	fields := []string{"data", "binaryData"}
+	if document.Kind() == "Secret" {
+		fields = []string{"data", "stringData"}
+	}
+	for _, field := range fields {
+		for _, item := range GetMap(document.Object, field) {
+			if item.Value == nil {
+				continue
+			}
+			text := fmt.Sprint(item.Value)
+			if field == "binaryData" || (field == "data" && document.Kind() == "Secret") {
+				if decoded, err := decodeBase64(text); err == nil {
+					text = string(decoded)
+				}
+			}
+			sizes[fmt.Sprint(item.Key)] = len(text)
+		}
+	}
+	size := 0
+	for key, n := range sizes {
+		size += len(key) + n
+	}
+	return size
+}
+
+// decodeBase64 as the API server decodes []byte fields, standard
+// padded encoding with line breaks ignored
+func decodeBase64(text string) ([]byte, error) {
+	text = strings.NewReplacer("\r", "", "\n", "").Replace(text)
+	return base64.StdEncoding.DecodeString(text)
+}
+
+// scalar names the yaml type of a decoded value for messages
+func scalar(value interface{}) string {
+	switch value.(type) {
+	case int, int64, uint64, float64:
+		return "a number"
+	case bool:
+		return "a bool"
+	case yaml.MapSlice:
+		return "a mapping"
+	}
+	return "a " + describe(value)
+}
@@ -0,0 +1,136 @@
+package manifest
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestCheckData(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		fix    bool
+		errors []string
+		want   string
+	}{
+		{
+			name: "valid",
+			text: "apiVersion: v1\nkind: Secret\nmetadata: {name: s}\ndata: {a.b_c-d: aGVsbG8=}\nstringData: {e: text}\n---\n" +
+				"apiVersion: v1\nkind: ConfigMap\nmetadata: {name: c}\ndata: {port: \"8080\"}\nbinaryData: {bin: AAE=}\n",
+		},
+		{
+			name: "errors",
+			text: "apiVersion: v1\nkind: Secret\nmetadata: {name: s}\ndata:\n  plain: not base64!\n  num: 3\n  bad/key: aGk=\n---\n" +
+				"apiVersion: v1\nkind: ConfigMap\nmetadata: {name: c}\ndata:\n  port: 8080\n  map: {a: b}\n",
+			errors: []string{
+				"7:3: document 1 (v1/Secret s): data.bad/key: invalid key, only alphanumerics, -, _ and . are allowed",
+				"5:3: document 1 (v1/Secret s): data.plain: value is not base64, illegal base64 data at input byte 3",
+				"6:3: document 1 (v1/Secret s): data.num: expected a base64 string, found a number",
+				"13:3: document 2 (v1/ConfigMap c): data.port: expected a string, found a number, quote it",
+				"14:3: document 2 (v1/ConfigMap c): data.map: expected a string, found a mapping",
+			},
+		},
+		{
+			name: "fixed",
+			fix:  true,
+			text: "apiVersion: v1\nkind: Secret\nmetadata: {name: s}\ndata:\n  plain: not base64!\n  ok: aGk=\n---\n" +
+				"apiVersion: v1\nkind: ConfigMap\nmetadata: {name: c}\ndata:\n  port: 8080\n  debug: true\n",
+			want: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\ndata:\n  ok: aGk=\nstringData:\n  plain: not base64!\n---\n" +
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: c\ndata:\n  port: \"8080\"\n  debug: \"true\"\n",
+		},
+		{
+			name: "other kinds ignored",
+			text: "apiVersion: v1\nkind: Service\nmetadata: {name: s}\ndata: {port: 8080}\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			documents := parse(t, test.text)
+			var errors []string
+			for _, e := range CheckData(documents, test.fix) {
+				errors = append(errors, e.Error())
+			}
+			if strings.Join(errors, "\n") != strings.Join(test.errors, "\n") {
+				t.Errorf("errors\n%s\nwant\n%s", strings.Join(errors, "\n"), strings.Join(test.errors, "\n"))
+			}
+			if len(test.want) > 0 {
+				if got := encode(t, documents); got != test.want {
+					t.Errorf("fixed\n%s\nwant\n%s", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDataSize(t *testing.T) {
+	encoded := func(n int) string { return base64.StdEncoding.EncodeToString(make([]byte, n)) }
+	tests := []struct {
+		name string
+		text string
+		size int
+	}{
+		{"secret data decoded", "kind: Secret\ndata: {key: " + encoded(10) + "}\n", 3 + 10},
+		{"secret stringData", "kind: Secret\nstringData: {key: twelve chars}\n", 3 + 12},
+		{"stringData replaces data", "kind: Secret\ndata: {key: " + encoded(100) + "}\nstringData: {key: abc}\n", 3 + 3},
+		{"configmap data with keys", "kind: ConfigMap\ndata: {a: xyz, bb: \"1\"}\n", 1 + 3 + 2 + 1},
+		{"configmap binaryData decoded", "kind: ConfigMap\nbinaryData: {bin: " + encoded(7) + "}\n", 3 + 7},
+		{"configmap fixed number", "kind: ConfigMap\ndata: {port: 8080}\n", 4 + 4},
+		{"null values", "kind: ConfigMap\ndata: {a: null}\n", 0},
+	}
+	for _, test := range tests {
+		documents := parse(t, test.text)
+		if got := dataSize(documents[0]); got != test.size {
+			t.Errorf("%s: dataSize = %d, want %d", test.name, got, test.size)
+		}
+	}
+}
+
+func TestCheckDataLimit(t *testing.T) {
+	value := strings.Repeat("x", MaxDataSize/2)
+	for _, test := range []struct {
+		name string
+		text string
+		fail bool
+	}{
+		{"configmap at the limit", "apiVersion: v1\nkind: ConfigMap\nmetadata: {name: c}\ndata:\n  a: " + value[:len(value)-1] + "\n  b: " + value[:len(value)-1] + "\n", false},
+		{"configmap keys count", "apiVersion: v1\nkind: ConfigMap\nmetadata: {name: c}\ndata:\n  a: " + value + "\n  b: " + value + "\n", true},
+		{"fixed secret over the limit", "apiVersion: v1\nkind: Secret\nmetadata: {name: s}\ndata:\n  a: " + value + "!\n  b: " + value + "!\n", true},
+	} {
+		errors := CheckData(parse(t, test.text), true)
+		if failed := len(errors) == 1 && strings.Contains(errors[0].Message, "exceeds the 1048576 byte limit"); failed != test.fail || (!test.fail && len(errors) > 0) {
+			t.Errorf("%s: errors %v", test.name, errors)
+		}
+	}
+}
+
+// a generated Secret a patch gives an invalid key is reported without a
+// stream line
+func TestCheckDataGenerated(t *testing.T) {
+	document, err := Generator{Kind: "Secret", Name: "db"}.Generate([]SecretValue{{Key: "user", Value: "admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	documents := Insert(parse(t, "apiVersion: v1\nkind: ConfigMap\nmetadata: {name: c}\n"), document)
+	patches, err := ParsePatches("patch.yaml", "target: {kind: Secret, name: db-*}\npatch:\n- {op: add, path: /data/bad key, value: eA==}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ApplyPatches(documents, patches); err != nil {
+		t.Fatal(err)
+	}
+	if err = EncodeModified(documents); err != nil {
+		t.Fatal(err)
+	}
+	if errors := Check(documents); len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	var got []string
+	for _, e := range CheckData(documents, false) {
+		got = append(got, e.Error())
+	}
+	want := "0:1: document 1 (v1/Secret " + document.Name() + "): data.bad key: invalid key, only alphanumerics, -, _ and . are allowed"
+	if strings.Join(got, "\n") != want {
+		t.Errorf("CheckData =\n%s\nwant\n%s", strings.Join(got, "\n"), want)
+	}
+}
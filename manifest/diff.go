@@ -0,0 +1,189 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// diffContext lines of context around each change of a hunk
+const diffContext = 3
+
+// serverFields the metadata the api server maintains
+var serverFields = []string{"managedFields", "resourceVersion", "uid", "creationTimestamp", "generation", "selfLink"}
+
+// lastApplied the annotation kubectl apply keeps the applied object in
+const lastApplied = "kubectl.kubernetes.io/last-applied-configuration"
+
+// StripServerFields removes status and the metadata the server
+// maintains from a live object
+func StripServerFields(object yaml.MapSlice) yaml.MapSlice {
+	object = Delete(object, "status")
+	for _, field := range serverFields {
+		object = Delete(object, "metadata", field)
+	}
+	object = Delete(object, "metadata", "annotations", lastApplied)
+	if annotations, ok := Get(object, "metadata", "annotations").(yaml.MapSlice); ok && len(annotations) == 0 {
+		object = Delete(object, "metadata", "annotations")
+	}
+	return object
+}
+
+// MaskSecrets replaces the data values of a live and a rendered Secret
+// with ***, "*** (before)" and "*** (after)" when a value changes;
+// stringData of the rendered Secret is compared as the data it becomes
+func MaskSecrets(live, rendered yaml.MapSlice) (yaml.MapSlice, yaml.MapSlice) {
+	if text := GetMap(rendered, "stringData"); len(text) > 0 {
+		data := append(yaml.MapSlice(nil), GetMap(rendered, "data")...)
+		for _, item := range text {
+			data = Set(data, base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(item.Value))), fmt.Sprint(item.Key))
+		}
+		rendered = Set(Delete(rendered, "stringData"), data, "data")
+	}
+	before, after := GetMap(live, "data"), GetMap(rendered, "data")
+	mask := func(data, other yaml.MapSlice, changed string) yaml.MapSlice {
+		masked := make(yaml.MapSlice, len(data))
+		for i, item := range data {
+			masked[i] = yaml.MapItem{Key: item.Key, Value: "***"}
+			if value := Get(other, fmt.Sprint(item.Key)); value != nil && fmt.Sprint(value) != fmt.Sprint(item.Value) {
+				masked[i].Value = "*** (" + changed + ")"
+			}
+		}
+		return masked
+	}
+	if before != nil {
+		live = Set(live, mask(before, after, "before"), "data")
+	}
+	if after != nil {
+		rendered = Set(rendered, mask(after, before, "after"), "data")
+	}
+	return live, rendered
+}
+
+// Canonical yaml of an object, keys sorted, so objects that differ
+// only in key order encode the same
+func Canonical(object yaml.MapSlice) string {
+	if object == nil {
+		return ""
+	}
+	text, err := yaml.Marshal(PlainMaps(object))
+	if err != nil {
+		return fmt.Sprintf("# %v\n", err)
+	}
+	return string(text)
+}
+
+// Diff the unified diff of before and after, empty when they are equal
+func Diff(before, after, beforeName, afterName string) string {
+	if before == after {
+		return ""
+	}
+	a, b := splitLines(before), splitLines(after)
+	type edit struct {
+		op   byte
+		line string
+	}
+	var edits []edit
+	if len(a)*len(b) > maxLineMapCells {
+		for _, line := range a {
+			edits = append(edits, edit{'-', line})
+		}
+		for _, line := range b {
+			edits = append(edits, edit{'+', line})
+		}
+	} else {
+		lcs := lcsTable(a, b)
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				edits = append(edits, edit{' ', a[i]})
+				i++
+				j++
+			case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+				edits = append(edits, edit{'-', a[i]})
+				i++
+			default:
+				edits = append(edits, edit{'+', b[j]})
+				j++
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "--- %s\n+++ %s\n", beforeName, afterName)
+	// line numbers, from 1, of the edit at index in a and b
+	lineA, lineB := make([]int, len(edits)+1), make([]int, len(edits)+1)
+	lineA[0], lineB[0] = 1, 1
+	for k, e := range edits {
+		lineA[k+1], lineB[k+1] = lineA[k], lineB[k]
+		if e.op != '+' {
+			lineA[k+1]++
+		}
+		if e.op != '-' {
+			lineB[k+1]++
+		}
+	}
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			k++
+			continue
+		}
+		// a hunk from the context before the change up to the context
+		// after the last change closer than two contexts apart
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(edits) && edits[next].op == ' ' {
+				next++
+			}
+			if next == len(edits) || next-end > 2*diffContext {
+				end += diffContext
+				if end > len(edits) {
+					end = len(edits)
+				}
+				break
+			}
+			end = next
+		}
+		countA, countB := lineA[end]-lineA[start], lineB[end]-lineB[start]
+		fmt.Fprintf(&buffer, "@@ -%s +%s @@\n", hunkRange(lineA[start], countA), hunkRange(lineB[start], countB))
+		for _, e := range edits[start:end] {
+			buffer.WriteByte(e.op)
+			buffer.WriteString(e.line)
+			buffer.WriteByte('\n')
+		}
+		k = end
+	}
+	return buffer.String()
+}
+
+// hunkRange the start,count of a hunk, start is the line before an
+// empty range
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(text string) []string {
+	if len(text) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
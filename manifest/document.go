@@ -0,0 +1,237 @@
+/*
+manifest:
+
+Operations on a rendered stream of --- separated kubernetes yaml
+documents: splitting, checking, and reading and editing the resources
+they describe.
+
+Documents are decoded into yaml.MapSlice values so mapping keys keep
+the order they were written in when a document is encoded again.
+*/
+
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Document one --- separated document of a rendered stream
+type Document struct {
+	// Index of the document in the stream, counting from 0
+	Index int
+	// Line of the stream the document text starts on, counting from 1
+	Line int
+	// Text of the document without the --- separator
+	Text string
+	// Object decoded from Text by Parse, nil for an empty document
+	Object yaml.MapSlice
+	// Modified is set when Object was edited and Text is stale
+	Modified bool
+	// Encoded is set when Text was encoded from Object, its lines no
+	// longer follow the stream
+	Encoded bool
+}
+
+var separator = regexp.MustCompile(`^---(\s.*)?$`)
+
+// Split a stream into its documents, every part between separators
+// is kept, including empty and comment only documents
+func Split(text string) (documents []*Document) {
+	lines := strings.SplitAfter(text, "\n")
+	current := &Document{Line: 1}
+	var body bytes.Buffer
+	for i, line := range lines {
+		if separator.MatchString(strings.TrimRight(line, "\r\n")) {
+			current.Text = body.String()
+			documents = append(documents, current)
+			current = &Document{Index: len(documents), Line: i + 2}
+			body.Reset()
+			continue
+		}
+		body.WriteString(line)
+	}
+	current.Text = body.String()
+	if len(documents) == 0 || len(strings.TrimSpace(current.Text)) > 0 {
+		documents = append(documents, current)
+	}
+	return
+}
+
+// Join documents back into a stream
+func Join(documents []*Document) string {
+	var buffer bytes.Buffer
+	for i, document := range documents {
+		if i > 0 {
+			buffer.WriteString("---\n")
+		}
+		buffer.WriteString(document.Text)
+		if len(document.Text) > 0 && !strings.HasSuffix(document.Text, "\n") {
+			buffer.WriteString("\n")
+		}
+	}
+	return buffer.String()
+}
+
+// Empty reports a document holding only white space or comments
+func (document *Document) Empty() bool {
+	for _, line := range strings.Split(document.Text, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse decodes Text into Object
+func (document *Document) Parse() error {
+	document.Object = nil
+	if document.Empty() {
+		return nil
+	}
+	var object interface{}
+	if err := yaml.Unmarshal([]byte(document.Text), &object); err != nil {
+		return err
+	}
+	if object == nil {
+		return nil
+	}
+	if _, ok := object.(map[interface{}]interface{}); !ok {
+		return fmt.Errorf("expected a mapping, found a %s", describe(object))
+	}
+	return yaml.Unmarshal([]byte(document.Text), &document.Object)
+}
+
+// Encode replaces Text with Object encoded as yaml. The leading and
+// trailing comment blocks of Text are kept; comments between keys are
+// lost and scalars are written as yaml.v2 reads them, yes as true,
+// quoting and flow style change.
+func (document *Document) Encode() error {
+	text, err := yaml.Marshal(document.Object)
+	if err != nil {
+		return err
+	}
+	document.Text = document.Comments() + string(text) + document.TrailingComments()
+	document.Encoded = true
+	return nil
+}
+
+// EncodeModified encodes the documents whose Object was edited
+func EncodeModified(documents []*Document) error {
+	for _, document := range documents {
+		if document.Modified {
+			if err := document.Encode(); err != nil {
+				return fmt.Errorf("document %d (%s): %v", document.Index+1, document.Identity(), err)
+			}
+			document.Modified = false
+		}
+	}
+	return nil
+}
+
+// Comments the comment lines leading the document text
+func (document *Document) Comments() string {
+	var buffer bytes.Buffer
+	for _, line := range strings.SplitAfter(document.Text, "\n") {
+		if trimmed := strings.TrimSpace(line); len(trimmed) > 0 && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			buffer.WriteString(line)
+		}
+	}
+	return buffer.String()
+}
+
+// TrailingComments the comment block ending the document text, from
+// its first comment line starting in column 0 after the last content
+// line, with the blank lines before it. Indented comment lines there
+// may belong to a block scalar and are not taken.
+func (document *Document) TrailingComments() string {
+	lines := strings.SplitAfter(document.Text, "\n")
+	start := len(lines)
+	for i := len(lines) - 1; i >= 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if len(trimmed) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		if strings.HasPrefix(lines[i], "#") {
+			start = i
+		}
+	}
+	if start == len(lines) {
+		return ""
+	}
+	for start > 0 && len(strings.TrimSpace(lines[start-1])) == 0 {
+		start--
+	}
+	var buffer bytes.Buffer
+	for _, line := range lines[start:] {
+		buffer.WriteString(line)
+	}
+	text := buffer.String()
+	if len(text) > 0 && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text
+}
+
+// APIVersion of the resource
+func (document *Document) APIVersion() string {
+	return GetString(document.Object, "apiVersion")
+}
+
+// Kind of the resource
+func (document *Document) Kind() string {
+	return GetString(document.Object, "kind")
+}
+
+// Name of the resource, metadata.name
+func (document *Document) Name() string {
+	return GetString(document.Object, "metadata", "name")
+}
+
+// Namespace of the resource, metadata.namespace
+func (document *Document) Namespace() string {
+	return GetString(document.Object, "metadata", "namespace")
+}
+
+// Group of the apiVersion, empty for the core group
+func (document *Document) Group() string {
+	if i := strings.Index(document.APIVersion(), "/"); i >= 0 {
+		return document.APIVersion()[:i]
+	}
+	return ""
+}
+
+// Identity names the resource for messages: apps/v1/Deployment ns/name
+func (document *Document) Identity() string {
+	name := document.Name()
+	if generate := GetString(document.Object, "metadata", "generateName"); len(name) == 0 && len(generate) > 0 {
+		name = generate + "*"
+	} else if len(name) == 0 {
+		name = "<unnamed>"
+	}
+	if namespace := document.Namespace(); len(namespace) > 0 {
+		name = namespace + "/" + name
+	}
+	return fmt.Sprintf("%s/%s %s", document.APIVersion(), document.Kind(), name)
+}
+
+func describe(object interface{}) string {
+	switch object.(type) {
+	case []interface{}:
+		return "sequence"
+	case string:
+		return "string"
+	}
+	return fmt.Sprintf("%T", object)
+}
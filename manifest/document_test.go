@@ -0,0 +1,87 @@
+package manifest
+
+import (
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		text  string
+		lines []int
+		texts []string
+	}{
+		{text: "a: 1\n", lines: []int{1}, texts: []string{"a: 1\n"}},
+		{text: "a: 1\n---\nb: 2\n", lines: []int{1, 3}, texts: []string{"a: 1\n", "b: 2\n"}},
+		{text: "---\na: 1\n", lines: []int{1, 2}, texts: []string{"", "a: 1\n"}},
+		{text: "a: 1\n--- # next\nb: 2\n---\n", lines: []int{1, 3}, texts: []string{"a: 1\n", "b: 2\n"}},
+		{text: "a: |\n  ----\n  ---x\nb: 2\n", lines: []int{1}, texts: []string{"a: |\n  ----\n  ---x\nb: 2\n"}},
+		{text: "----\n---x\n", lines: []int{1}, texts: []string{"----\n---x\n"}},
+	}
+	for _, test := range tests {
+		documents := Split(test.text)
+		if len(documents) != len(test.texts) {
+			t.Errorf("Split(%q) = %d documents, want %d", test.text, len(documents), len(test.texts))
+			continue
+		}
+		for i, document := range documents {
+			if document.Index != i || document.Line != test.lines[i] || document.Text != test.texts[i] {
+				t.Errorf("Split(%q)[%d] = %d %d %q, want line %d %q", test.text, i,
+					document.Index, document.Line, document.Text, test.lines[i], test.texts[i])
+			}
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "no comments",
+			text: "a: 1\nb: 2\n",
+			want: "a: 1\nb: 2\nc: 3\n",
+		},
+		{
+			name: "leading and trailing comments",
+			text: "# head\na: 1 # inline\n# between\nb: 2\n\n\n# local variables:\n# mode: yaml\n",
+			want: "# head\na: 1\nb: 2\nc: 3\n\n\n# local variables:\n# mode: yaml\n",
+		},
+		{
+			name: "indented trailing comment belongs to a block scalar",
+			text: "a: 1\nb: |\n  echo\n  # not a comment\n",
+			want: "a: 1\nb: |\n  echo\n  # not a comment\nc: 3\n",
+		},
+		{
+			name: "indented comment then a block",
+			text: "a: 1\nb: 2\n  # indented\n# tail\n",
+			want: "a: 1\nb: 2\nc: 3\n# tail\n",
+		},
+		{
+			name: "trailing comment without a newline",
+			text: "a: 1\nb: 2\n# end",
+			want: "a: 1\nb: 2\nc: 3\n# end\n",
+		},
+		{
+			name: "yaml 1.1 scalars",
+			text: "a: yes\nb: '2'\n",
+			want: "a: true\nb: \"2\"\nc: 3\n",
+		},
+	}
+	for _, test := range tests {
+		document := &Document{Text: test.text}
+		if err := document.Parse(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		document.Object = append(document.Object, yaml.MapItem{Key: "c", Value: 3})
+		if err := document.Encode(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if document.Text != test.want {
+			t.Errorf("%s: Encode =\n%s\nwant\n%s", test.name, document.Text, test.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Generator describes a ConfigMap or Secret built from mappings whose
+// name carries a hash of its content, so a change of content is a new
+// object and the workloads referring to it roll
+type Generator struct {
+	Kind      string      `yaml:"kind"`
+	Name      string      `yaml:"name"`
+	Namespace string      `yaml:"namespace"`
+	Type      string      `yaml:"type"`
+	From      interface{} `yaml:"from-mapping"`
+}
+
+// ParseGenerators reads a yaml list of generators
+func ParseGenerators(text []byte) (generators []Generator, err error) {
+	if err = yaml.Unmarshal(text, &generators); err != nil {
+		return nil, err
+	}
+	for _, g := range generators {
+		if g.Kind != "ConfigMap" && g.Kind != "Secret" {
+			return nil, fmt.Errorf("generator %s: kind must be ConfigMap or Secret, got %q", g.Name, g.Kind)
+		}
+		if len(g.Name) == 0 {
+			return nil, fmt.Errorf("generator of kind %s without a name", g.Kind)
+		}
+	}
+	return
+}
+
+// Sources the from-mapping items as key and mapping name pairs
+func (g Generator) Sources() [][2]string {
+	return ParseSources(g.From)
+}
+
+// ParseSources reads a comma separated string or a list of mapping
+// names as key and mapping name pairs; key=name stores name under key
+func ParseSources(from interface{}) (sources [][2]string) {
+	var items []string
+	switch from := from.(type) {
+	case string:
+		items = strings.Split(from, ",")
+	case []interface{}:
+		for _, item := range from {
+			items = append(items, fmt.Sprint(item))
+		}
+	}
+	for _, item := range items {
+		if item = strings.TrimSpace(item); len(item) == 0 {
+			continue
+		}
+		key, name := item, item
+		if parts := strings.SplitN(item, "=", 2); len(parts) == 2 {
+			key, name = parts[0], parts[1]
+		}
+		sources = append(sources, [2]string{key, name})
+	}
+	return
+}
+
+// Generate builds the object named name-hash from values
+func (g Generator) Generate(values []SecretValue) (*Document, error) {
+	var document *Document
+	var err error
+	if g.Kind == "Secret" {
+		secretType := g.Type
+		if len(secretType) == 0 {
+			secretType = "Opaque"
+		}
+		// data only, the hash must not depend on the data/stringData split
+		document, err = NewSecret(g.Name, g.Namespace, secretType, values, false)
+	} else {
+		document, err = NewConfigMap(g.Name, g.Namespace, values)
+	}
+	if err != nil {
+		return nil, err
+	}
+	hash, err := ContentHash(document.Object)
+	if err != nil {
+		return nil, err
+	}
+	document.Object = Set(document.Object, g.Name+"-"+hash, "metadata", "name")
+	return document, document.Encode()
+}
+
+// NewConfigMap builds a ConfigMap document, text values go under data
+// and others under binaryData; Encoded values are decoded first
+func NewConfigMap(name, namespace string, values []SecretValue) (*Document, error) {
+	var data, binary yaml.MapSlice
+	present := make(map[string]bool)
+	for _, value := range values {
+		if !SecretKey.MatchString(value.Key) {
+			return nil, fmt.Errorf("configmap %s: key %q may only hold alphanumerics, -, _ and .", name, value.Key)
+		}
+		if present[value.Key] {
+			return nil, fmt.Errorf("configmap %s: key %s is given twice", name, value.Key)
+		}
+		present[value.Key] = true
+		plain := value.Value
+		if value.Encoded {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value.Value))
+			if err != nil {
+				return nil, fmt.Errorf("configmap %s: key %s is not valid base64: %v", name, value.Key, err)
+			}
+			plain = string(decoded)
+		}
+		if IsText(plain) {
+			data = append(data, yaml.MapItem{Key: value.Key, Value: plain})
+		} else {
+			binary = append(binary, yaml.MapItem{Key: value.Key, Value: base64.StdEncoding.EncodeToString([]byte(plain))})
+		}
+	}
+	metadata := yaml.MapSlice{{Key: "name", Value: name}}
+	if len(namespace) > 0 {
+		metadata = append(metadata, yaml.MapItem{Key: "namespace", Value: namespace})
+	}
+	document := &Document{Object: yaml.MapSlice{
+		{Key: "apiVersion", Value: "v1"},
+		{Key: "kind", Value: "ConfigMap"},
+		{Key: "metadata", Value: metadata},
+	}}
+	if len(data) > 0 {
+		document.Object = append(document.Object, yaml.MapItem{Key: "data", Value: data})
+	}
+	if len(binary) > 0 {
+		document.Object = append(document.Object, yaml.MapItem{Key: "binaryData", Value: binary})
+	}
+	return document, document.Encode()
+}
+
+// ContentHash a 10 character hash of the kind, name, type and data of
+// an object, written with the alphabet kustomize uses so a hash never
+// spells a word
+func ContentHash(object yaml.MapSlice) (string, error) {
+	content := map[string]interface{}{
+		"kind": GetString(object, "kind"),
+		"name": GetString(object, "metadata", "name"),
+	}
+	for _, key := range []string{"type", "data", "binaryData", "stringData"} {
+		if value := Get(object, key); value != nil {
+			content[key] = PlainMaps(value)
+		}
+	}
+	text, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(text)
+	hash := []byte(hex.EncodeToString(sum[:])[:10])
+	for i, c := range hash {
+		switch c {
+		case '0':
+			hash[i] = 'g'
+		case '1':
+			hash[i] = 'h'
+		case '3':
+			hash[i] = 'k'
+		case 'a':
+			hash[i] = 'm'
+		case 'e':
+			hash[i] = 't'
+		}
+	}
+	return string(hash), nil
+}
+
+// RenameReferences points the references of workloads in namespace to
+// a kind and name at newName, marking the documents changed as
+// Modified. An empty namespace matches every workload.
+func RenameReferences(documents []*Document, kind, namespace, name, newName string) {
+	for _, document := range documents {
+		if document.Object == nil || !document.IsWorkload() {
+			continue
+		}
+		if len(namespace) > 0 && len(document.Namespace()) > 0 && document.Namespace() != namespace {
+			continue
+		}
+		for _, reference := range document.References() {
+			if reference.Kind == kind && reference.Name == name {
+				reference.Rename(newName)
+				document.Modified = true
+			}
+		}
+	}
+}
+
+// Insert documents ahead of the first resource of a stream, after any
+// leading comment only documents, and renumber the stream
+func Insert(documents []*Document, inserted ...*Document) []*Document {
+	at := 0
+	for at < len(documents) && documents[at].Empty() {
+		at++
+	}
+	out := make([]*Document, 0, len(documents)+len(inserted))
+	out = append(out, documents[:at]...)
+	out = append(out, inserted...)
+	out = append(out, documents[at:]...)
+	Reindex(out)
+	return out
+}
+
+// Reindex numbers documents by their position in the stream
+func Reindex(documents []*Document) {
+	for i, document := range documents {
+		document.Index = i
+	}
+}
+
+// PlainMaps converts MapSlices to maps with string keys, json encodes
+// them with sorted keys
+func PlainMaps(in interface{}) interface{} {
+	switch v := in.(type) {
+	case yaml.MapSlice:
+		out := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			out[fmt.Sprint(item.Key)] = PlainMaps(item.Value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, x := range v {
+			out[i] = PlainMaps(x)
+		}
+		return out
+	}
+	return in
+}
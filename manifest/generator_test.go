@@ -0,0 +1,267 @@
+package manifest
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, text string) []*Document {
+	documents := Split(text)
+	for _, document := range documents {
+		if err := document.Parse(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return documents
+}
+
+func encode(t *testing.T, documents []*Document) string {
+	if err := EncodeModified(documents); err != nil {
+		t.Fatal(err)
+	}
+	return Join(documents)
+}
+
+func TestParseGenerators(t *testing.T) {
+	generators, err := ParseGenerators([]byte("- kind: Secret\n  name: db\n  type: kubernetes.io/basic-auth\n  from-mapping: username=User,password=Password\n" +
+		"- kind: ConfigMap\n  name: cfg\n  namespace: team\n  from-mapping: [Host, port=Port]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(generators) != 2 || generators[0].Type != "kubernetes.io/basic-auth" || generators[1].Namespace != "team" {
+		t.Errorf("ParseGenerators = %+v", generators)
+	}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"- kind: Deployment\n  name: d\n", `generator d: kind must be ConfigMap or Secret, got "Deployment"`},
+		{"- kind: Secret\n", "generator of kind Secret without a name"},
+		{"kind: Secret\n", "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!map into []manifest.Generator"},
+	}
+	for _, test := range tests {
+		if _, err := ParseGenerators([]byte(test.text)); err == nil || err.Error() != test.want {
+			t.Errorf("ParseGenerators(%q) error %v, want %s", test.text, err, test.want)
+		}
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	tests := []struct {
+		from interface{}
+		want string
+	}{
+		{"User", "User=User"},
+		{" username=User , password=Password,,", "username=User password=Password"},
+		{[]interface{}{"Host", "port=Port"}, "Host=Host port=Port"},
+		{"a=b=c", "a=b=c"},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, source := range ParseSources(test.from) {
+			got = append(got, source[0]+"="+source[1])
+		}
+		if strings.Join(got, " ") != test.want {
+			t.Errorf("ParseSources(%v) = %v, want %s", test.from, got, test.want)
+		}
+	}
+}
+
+var generatedName = regexp.MustCompile(`^(.*)-([2456789bcdfghkmt]{10})$`)
+
+func TestGenerate(t *testing.T) {
+	values := []SecretValue{{Key: "user", Value: "admin"}, {Key: "password", Value: "s3cret"}}
+	reordered := []SecretValue{values[1], values[0]}
+	name := func(g Generator, values []SecretValue) string {
+		document, err := g.Generate(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if GetString(document.Object, "metadata", "name") != document.Name() || !strings.Contains(document.Text, "name: "+document.Name()+"\n") {
+			t.Fatalf("generated document name %s not encoded\n%s", document.Name(), document.Text)
+		}
+		return document.Name()
+	}
+	secret := Generator{Kind: "Secret", Name: "db"}
+	configMap := Generator{Kind: "ConfigMap", Name: "db"}
+	base := name(secret, values)
+	if match := generatedName.FindStringSubmatch(base); match == nil || match[1] != "db" {
+		t.Fatalf("generated name %s, want db-<hash>", base)
+	}
+	tests := []struct {
+		name   string
+		g      Generator
+		values []SecretValue
+		same   bool
+	}{
+		{"same values", secret, values, true},
+		{"key order changed", secret, reordered, true},
+		{"encoded value", secret, []SecretValue{{Key: "user", Value: "YWRtaW4=", Encoded: true}, values[1]}, true},
+		{"namespace", Generator{Kind: "Secret", Name: "db", Namespace: "team"}, values, true},
+		{"value changed", secret, []SecretValue{values[0], {Key: "password", Value: "s3cret!"}}, false},
+		{"key renamed", secret, []SecretValue{values[0], {Key: "pass", Value: "s3cret"}}, false},
+		{"type", Generator{Kind: "Secret", Name: "db", Type: "kubernetes.io/basic-auth"}, values, false},
+		{"kind", configMap, values, false},
+		{"name", Generator{Kind: "Secret", Name: "db2"}, values, false},
+	}
+	for _, test := range tests {
+		got := name(test.g, test.values)
+		if hash := generatedName.FindStringSubmatch(got)[2]; (hash == generatedName.FindStringSubmatch(base)[2]) != test.same {
+			t.Errorf("%s: %s against %s, want the same hash %v", test.name, got, base, test.same)
+		}
+	}
+	if name(configMap, values) != name(configMap, reordered) {
+		t.Error("ConfigMap hash depends on the key order")
+	}
+}
+
+func TestNewConfigMap(t *testing.T) {
+	document, err := NewConfigMap("cfg", "", []SecretValue{{Key: "text", Value: "a: 1\n"}, {Key: "bin", Value: "AP8=", Encoded: true},
+		{Key: "encoded", Value: "aGk=", Encoded: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cfg\ndata:\n  text: |\n    a: 1\n  encoded: hi\nbinaryData:\n  bin: AP8=\n"
+	if document.Text != want {
+		t.Errorf("NewConfigMap =\n%s\nwant\n%s", document.Text, want)
+	}
+	if _, err = NewConfigMap("cfg", "", []SecretValue{{Key: "a:b"}}); err == nil {
+		t.Error("NewConfigMap accepted key a:b")
+	}
+}
+
+const referencingStream = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: team
+spec:
+  template:
+    spec:
+      imagePullSecrets:
+      - name: db
+      initContainers:
+      - name: init
+        envFrom:
+        - configMapRef: {name: db}
+      containers:
+      - name: web
+        env:
+        - name: A
+          valueFrom:
+            configMapKeyRef: {name: db, key: a}
+        - name: B
+          valueFrom:
+            secretKeyRef: {name: db, key: b}
+        - name: C
+          valueFrom:
+            secretKeyRef: {name: other, key: c}
+        envFrom:
+        - secretRef: {name: db}
+        - configMapRef: {name: other}
+      volumes:
+      - name: c
+        configMap: {name: db}
+      - name: s
+        secret: {secretName: db}
+      - name: p
+        projected:
+          sources:
+          - configMap: {name: db}
+          - secret: {name: db}
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: nightly
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: job
+            envFrom:
+            - secretRef: {name: db}
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: other-namespace
+  namespace: prod
+spec:
+  containers:
+  - name: c
+    envFrom:
+    - secretRef: {name: db}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: db
+data:
+  secretRef: db
+`
+
+func TestRenameReferences(t *testing.T) {
+	documents := parse(t, referencingStream)
+	RenameReferences(documents, "Secret", "team", "db", "db-new")
+	RenameReferences(documents, "ConfigMap", "team", "db", "db-cfg")
+	modified := []bool{true, true, false, false}
+	for i, document := range documents {
+		if document.Modified != modified[i] {
+			t.Errorf("document %d Modified %v, want %v", i, document.Modified, modified[i])
+		}
+	}
+	spec := documents[0].PodSpec()
+	container := GetList(spec, "containers")[0]
+	tests := []struct {
+		site string
+		got  string
+		want string
+	}{
+		{"imagePullSecrets", GetString(GetList(spec, "imagePullSecrets")[0], "name"), "db-new"},
+		{"initContainers envFrom configMapRef", GetString(GetList(GetList(spec, "initContainers")[0], "envFrom")[0], "configMapRef", "name"), "db-cfg"},
+		{"env configMapKeyRef", GetString(GetList(container, "env")[0], "valueFrom", "configMapKeyRef", "name"), "db-cfg"},
+		{"env secretKeyRef", GetString(GetList(container, "env")[1], "valueFrom", "secretKeyRef", "name"), "db-new"},
+		{"env secretKeyRef of another secret", GetString(GetList(container, "env")[2], "valueFrom", "secretKeyRef", "name"), "other"},
+		{"env secretKeyRef key", GetString(GetList(container, "env")[1], "valueFrom", "secretKeyRef", "key"), "b"},
+		{"envFrom secretRef", GetString(GetList(container, "envFrom")[0], "secretRef", "name"), "db-new"},
+		{"envFrom configMapRef of another configmap", GetString(GetList(container, "envFrom")[1], "configMapRef", "name"), "other"},
+		{"configMap volume", GetString(GetList(spec, "volumes")[0], "configMap", "name"), "db-cfg"},
+		{"secret volume", GetString(GetList(spec, "volumes")[1], "secret", "secretName"), "db-new"},
+		{"projected configMap", GetString(GetList(GetList(spec, "volumes")[2], "projected", "sources")[0], "configMap", "name"), "db-cfg"},
+		{"projected secret", GetString(GetList(GetList(spec, "volumes")[2], "projected", "sources")[1], "secret", "name"), "db-new"},
+		{"cronjob without a namespace", GetString(GetList(GetList(documents[1].PodSpec(), "containers")[0], "envFrom")[0], "secretRef", "name"), "db-new"},
+		{"pod of another namespace", GetString(GetList(GetList(documents[2].PodSpec(), "containers")[0], "envFrom")[0], "secretRef", "name"), "db"},
+		{"not a workload", GetString(documents[3].Object, "data", "secretRef"), "db"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: %s, want %s", test.site, test.got, test.want)
+		}
+	}
+	if err := EncodeModified(documents); err != nil {
+		t.Fatal(err)
+	}
+	if text := Join(documents[:2]); strings.Contains(text, "name: db}") || strings.Contains(text, "name: db\n") {
+		t.Errorf("encoded workloads still refer to db\n%s", text)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	documents := Split("# head\n---\nkind: A\n---\nkind: B\n")
+	inserted := Insert(documents, &Document{Text: "kind: G\n"})
+	var got []string
+	for i, document := range inserted {
+		if document.Index != i {
+			t.Errorf("document %d Index %d", i, document.Index)
+		}
+		got = append(got, strings.TrimSpace(document.Text))
+	}
+	if strings.Join(got, ",") != "# head,kind: G,kind: A,kind: B" {
+		t.Errorf("Insert = %v", got)
+	}
+}
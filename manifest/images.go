@@ -0,0 +1,92 @@
+package manifest
+
+import (
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// containerLists the pod spec lists holding containers with an image
+var containerLists = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// Image of a container of a workload pod spec
+type Image struct {
+	// Container name
+	Container string
+	Image     string
+	container yaml.MapSlice
+}
+
+// Set the image of the container
+func (image *Image) Set(name string) {
+	for i := range image.container {
+		if image.container[i].Key == "image" {
+			image.container[i].Value = name
+		}
+	}
+	image.Image = name
+}
+
+// Images of the containers, init and ephemeral containers of a
+// workload
+func (document *Document) Images() (images []*Image) {
+	spec := document.PodSpec()
+	for _, list := range containerLists {
+		for _, item := range GetList(spec, list) {
+			container, _ := item.(yaml.MapSlice)
+			if image := GetString(container, "image"); len(image) > 0 {
+				images = append(images, &Image{
+					Container: GetString(container, "name"),
+					Image:     image,
+					container: container,
+				})
+			}
+		}
+	}
+	return
+}
+
+// RewriteImages sets every container image of documents to
+// rewrite(image), the documents changed are marked Modified
+func RewriteImages(documents []*Document, rewrite func(image string) (string, error)) (errors []*Error) {
+	for _, document := range documents {
+		if document.Object == nil {
+			continue
+		}
+		for _, image := range document.Images() {
+			name, err := rewrite(image.Image)
+			if err != nil {
+				n := document.valueLine("image", image.Image)
+				errors = append(errors, &Error{
+					Index:    document.Index,
+					Identity: document.Identity(),
+					Line:     document.streamLine(n),
+					Column:   document.column(n),
+					Message:  "container " + image.Container + ": " + err.Error(),
+				})
+				continue
+			}
+			if name != image.Image {
+				image.Set(name)
+				document.Modified = true
+			}
+		}
+	}
+	return
+}
+
+// valueLine the line of the document, counting from 1, holding key
+// with value, or the first content line
+func (document *Document) valueLine(key, value string) int {
+	for i, line := range strings.Split(document.Text, "\n") {
+		line = strings.TrimLeft(strings.TrimSpace(line), "- ")
+		if !hasKey(line, key) {
+			continue
+		}
+		text := strings.TrimSpace(line[strings.Index(line, ":")+1:])
+		if strings.Trim(text, `"'`) == value {
+			return i + 1
+		}
+	}
+	return document.keyLine(nil)
+}
@@ -0,0 +1,186 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// clusterScoped the built in kinds that have no namespace
+var clusterScoped = map[string]bool{
+	"APIService":                       true,
+	"CertificateSigningRequest":        true,
+	"ClusterIssuer":                    true,
+	"ClusterRole":                      true,
+	"ClusterRoleBinding":               true,
+	"ComponentStatus":                  true,
+	"CSIDriver":                        true,
+	"CSINode":                          true,
+	"CustomResourceDefinition":         true,
+	"FlowSchema":                       true,
+	"IngressClass":                     true,
+	"MutatingWebhookConfiguration":     true,
+	"Namespace":                        true,
+	"Node":                             true,
+	"PersistentVolume":                 true,
+	"PodSecurityPolicy":                true,
+	"PriorityClass":                    true,
+	"PriorityLevelConfiguration":       true,
+	"RuntimeClass":                     true,
+	"StorageClass":                     true,
+	"ValidatingAdmissionPolicy":        true,
+	"ValidatingAdmissionPolicyBinding": true,
+	"ValidatingWebhookConfiguration":   true,
+	"VolumeAttachment":                 true,
+}
+
+// Scopes knows which kinds are cluster scoped, the built in kinds and
+// the custom kinds defined in a stream
+type Scopes map[string]bool
+
+// NewScopes adds the cluster scoped CustomResourceDefinitions of
+// documents to the built in kinds
+func NewScopes(documents []*Document) Scopes {
+	scopes := make(Scopes)
+	for kind := range clusterScoped {
+		scopes[kind] = true
+	}
+	for _, document := range documents {
+		if document.Kind() == "CustomResourceDefinition" && GetString(document.Object, "spec", "scope") == "Cluster" {
+			scopes[GetString(document.Object, "spec", "names", "kind")] = true
+		}
+	}
+	return scopes
+}
+
+// Namespaced reports if a document is of a namespaced kind, unknown
+// kinds are taken to be namespaced
+func (scopes Scopes) Namespaced(document *Document) bool {
+	return !scopes[document.Kind()]
+}
+
+// immutableTemplate the workloads whose pod template is not labeled, a
+// CronJob's jobTemplate may change, only the Jobs it creates may not
+var immutableTemplate = map[string]bool{"Job": true}
+
+// Namespace the namespace a document is created in, its own or
+// namespace when it has none, empty for a cluster scoped kind
+func (scopes Scopes) Namespace(document *Document, namespace string) string {
+	if !scopes.Namespaced(document) {
+		return ""
+	}
+	if len(document.Namespace()) > 0 {
+		return document.Namespace()
+	}
+	return namespace
+}
+
+// ParsePairs reads comma separated key=value pairs, keeping their order
+func ParsePairs(text string) (pairs yaml.MapSlice, err error) {
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); len(item) == 0 {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("expected key=value, got %q", item)
+		}
+		pairs = append(pairs, yaml.MapItem{Key: parts[0], Value: parts[1]})
+	}
+	return
+}
+
+// SetNamespace sets metadata.namespace on every namespaced resource,
+// returning a warning for each explicit namespace it replaces
+func SetNamespace(documents []*Document, namespace string) (warnings []*Error) {
+	scopes := NewScopes(documents)
+	for _, document := range documents {
+		if document.Object == nil || !scopes.Namespaced(document) || document.Namespace() == namespace {
+			continue
+		}
+		metadata := GetMap(document.Object, "metadata")
+		if Get(metadata, "namespace") == nil {
+			metadata = insertAfter(metadata, "name", yaml.MapItem{Key: "namespace", Value: namespace})
+		} else {
+			n := document.keyLine([]string{"metadata", "namespace"})
+			warnings = append(warnings, &Error{
+				Index:    document.Index,
+				Identity: document.Identity(),
+				Line:     document.streamLine(n),
+				Column:   document.column(n),
+				Message:  fmt.Sprintf("namespace %s replaced by %s", document.Namespace(), namespace),
+				Warning:  true,
+			})
+			metadata = Set(metadata, namespace, "namespace")
+		}
+		document.Object = Set(document.Object, metadata, "metadata")
+		document.Modified = true
+	}
+	return
+}
+
+// AddLabels merges labels into the metadata of every resource, the pod
+// template of every workload and the selectors that may change on a
+// live object: a Service's spec.selector and a ReplicationController's
+// spec.selector. The selectors of apps/v1 workloads are immutable once
+// created and are left alone, as are the pod templates of Jobs: a Job's
+// spec.template can not be changed once created, so a new label would
+// fail to apply over an existing Job. A CronJob's pod template is
+// labeled, the Jobs it creates from then on carry the label.
+func AddLabels(documents []*Document, labels yaml.MapSlice) {
+	if len(labels) == 0 {
+		return
+	}
+	for _, document := range documents {
+		if document.Object == nil {
+			continue
+		}
+		document.Object = merge(document.Object, labels, "metadata", "labels")
+		if path := document.PodTemplatePath(); path != nil && !immutableTemplate[document.Kind()] {
+			document.Object = merge(document.Object, labels, append(path, "metadata", "labels")...)
+		}
+		switch document.Kind() {
+		case "Service", "ReplicationController":
+			if GetMap(document.Object, "spec", "selector") != nil {
+				document.Object = merge(document.Object, labels, "spec", "selector")
+			}
+		}
+		document.Modified = true
+	}
+}
+
+// AddAnnotations merges annotations into the metadata of every resource
+func AddAnnotations(documents []*Document, annotations yaml.MapSlice) {
+	if len(annotations) == 0 {
+		return
+	}
+	for _, document := range documents {
+		if document.Object == nil {
+			continue
+		}
+		document.Object = merge(document.Object, annotations, "metadata", "annotations")
+		document.Modified = true
+	}
+}
+
+// insertAfter adds item following the key after, or at the end
+func insertAfter(mapping yaml.MapSlice, after string, item yaml.MapItem) yaml.MapSlice {
+	for i := range mapping {
+		if fmt.Sprint(mapping[i].Key) == after {
+			out := append(yaml.MapSlice{}, mapping[:i+1]...)
+			out = append(out, item)
+			return append(out, mapping[i+1:]...)
+		}
+	}
+	return append(mapping, item)
+}
+
+// merge pairs into the mapping at path, replacing existing keys
+func merge(object yaml.MapSlice, pairs yaml.MapSlice, path ...string) yaml.MapSlice {
+	mapping := GetMap(object, path...)
+	for _, pair := range pairs {
+		mapping = Set(mapping, pair.Value, fmt.Sprint(pair.Key))
+	}
+	return Set(object, mapping, path...)
+}
@@ -0,0 +1,162 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestSetNamespace(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		want     string
+		warnings []string
+	}{
+		{
+			name: "added after name",
+			text: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cfg\n  labels: {a: b}\n",
+			want: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cfg\n  namespace: prod\n  labels:\n    a: b\n",
+		},
+		{
+			name: "same namespace unchanged",
+			text: "kind: ConfigMap\nmetadata: {name: cfg, namespace: prod}\n",
+			want: "kind: ConfigMap\nmetadata: {name: cfg, namespace: prod}\n",
+		},
+		{
+			name:     "different namespace replaced with a warning",
+			text:     "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\n  namespace: dev\n",
+			want:     "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\n  namespace: prod\n",
+			warnings: []string{"5:3: warning: document 1 (v1/Secret dev/s): namespace dev replaced by prod"},
+		},
+		{
+			name: "cluster scoped kinds left alone",
+			text: "kind: Namespace\nmetadata: {name: dev}\n---\nkind: ClusterRole\nmetadata: {name: r, namespace: dev}\n",
+			want: "kind: Namespace\nmetadata: {name: dev}\n---\nkind: ClusterRole\nmetadata: {name: r, namespace: dev}\n",
+		},
+		{
+			name: "cluster scoped custom kind",
+			text: "kind: CustomResourceDefinition\nmetadata: {name: widgets.example.com}\n" +
+				"spec: {scope: Cluster, names: {kind: Widget}}\n---\nkind: Widget\nmetadata: {name: w}\n---\nkind: Gadget\nmetadata: {name: g}\n",
+			want: "kind: CustomResourceDefinition\nmetadata: {name: widgets.example.com}\n" +
+				"spec: {scope: Cluster, names: {kind: Widget}}\n---\nkind: Widget\nmetadata: {name: w}\n---\n" +
+				"kind: Gadget\nmetadata:\n  name: g\n  namespace: prod\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			documents := parse(t, test.text)
+			var warnings []string
+			for _, e := range SetNamespace(documents, "prod") {
+				if !e.Warning {
+					t.Errorf("%v is not a warning", e)
+				}
+				warnings = append(warnings, e.Error())
+			}
+			if strings.Join(warnings, "\n") != strings.Join(test.warnings, "\n") {
+				t.Errorf("warnings %q, want %q", warnings, test.warnings)
+			}
+			if got := encode(t, documents); got != test.want {
+				t.Errorf("SetNamespace =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAddLabels(t *testing.T) {
+	labels := yaml.MapSlice{{Key: "team", Value: "web"}}
+	tests := []struct {
+		name string
+		text string
+		want map[string]string
+	}{
+		{
+			name: "deployment template labeled, selector left alone",
+			text: "kind: Deployment\nmetadata: {name: d}\nspec:\n  selector: {matchLabels: {app: d}}\n  template:\n    metadata: {labels: {app: d}}\n",
+			want: map[string]string{
+				"metadata.labels.team":               "web",
+				"spec.template.metadata.labels.team": "web",
+				"spec.template.metadata.labels.app":  "d",
+				"spec.selector.matchLabels.team":     "",
+				"spec.selector.matchLabels.app":      "d",
+			},
+		},
+		{
+			name: "service selector labeled",
+			text: "kind: Service\nmetadata: {name: s}\nspec: {selector: {app: d}}\n",
+			want: map[string]string{"metadata.labels.team": "web", "spec.selector.team": "web"},
+		},
+		{
+			name: "service without selector",
+			text: "kind: Service\nmetadata: {name: s}\nspec: {type: ExternalName}\n",
+			want: map[string]string{"metadata.labels.team": "web", "spec.selector.team": ""},
+		},
+		{
+			name: "job template left alone",
+			text: "kind: Job\nmetadata: {name: j}\nspec:\n  template:\n    metadata: {labels: {app: j}}\n",
+			want: map[string]string{"metadata.labels.team": "web", "spec.template.metadata.labels.team": ""},
+		},
+		{
+			name: "cronjob job template labeled",
+			text: "kind: CronJob\nmetadata: {name: c}\nspec:\n  jobTemplate:\n    spec:\n      template:\n        metadata: {labels: {app: c}}\n",
+			want: map[string]string{"metadata.labels.team": "web", "spec.jobTemplate.spec.template.metadata.labels.team": "web",
+				"spec.jobTemplate.spec.template.metadata.labels.app": "c"},
+		},
+		{
+			name: "existing label replaced",
+			text: "kind: ConfigMap\nmetadata: {name: cfg, labels: {team: db}}\n",
+			want: map[string]string{"metadata.labels.team": "web"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			documents := parse(t, test.text)
+			AddLabels(documents, labels)
+			for path, want := range test.want {
+				if got := GetString(documents[0].Object, strings.Split(path, ".")...); got != want {
+					t.Errorf("%s = %q, want %q", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAddAnnotations(t *testing.T) {
+	documents := parse(t, "kind: ConfigMap\nmetadata: {name: cfg, annotations: {a: \"1\"}}\n---\n# comment only\n")
+	AddAnnotations(documents, yaml.MapSlice{{Key: "owner", Value: "ops"}, {Key: "a", Value: "2"}})
+	want := "kind: ConfigMap\nmetadata:\n  name: cfg\n  annotations:\n    a: \"2\"\n    owner: ops\n---\n# comment only\n"
+	if got := encode(t, documents); got != want {
+		t.Errorf("AddAnnotations =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParsePairs(t *testing.T) {
+	tests := []struct {
+		text string
+		want yaml.MapSlice
+		err  bool
+	}{
+		{"", nil, false},
+		{"a=1, b=x=y ,", yaml.MapSlice{{Key: "a", Value: "1"}, {Key: "b", Value: "x=y"}}, false},
+		{"a=", yaml.MapSlice{{Key: "a", Value: ""}}, false},
+		{"a", nil, true},
+		{"=1", nil, true},
+	}
+	for _, test := range tests {
+		got, err := ParsePairs(test.text)
+		if (err != nil) != test.err {
+			t.Errorf("ParsePairs(%q) error %v", test.text, err)
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("ParsePairs(%q) = %v, want %v", test.text, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("ParsePairs(%q) = %v, want %v", test.text, got, test.want)
+			}
+		}
+	}
+}
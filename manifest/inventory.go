@@ -0,0 +1,143 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// InventoryLabel labels every resource of a render with the id of its
+// inventory
+const InventoryLabel = "k8s-template/inventory-id"
+
+// InventoryKey the data key of the inventory ConfigMap listing the
+// resources, one Entry a line
+const InventoryKey = "inventory"
+
+// Entry one resource of an inventory, written group/Kind/namespace/name
+// with an empty group for the core api and an empty namespace for
+// cluster scoped resources
+type Entry struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (entry Entry) String() string {
+	return strings.Join([]string{entry.Group, entry.Kind, entry.Namespace, entry.Name}, "/")
+}
+
+// ParseEntry reads an Entry from its String form
+func ParseEntry(text string) (entry Entry, err error) {
+	parts := strings.Split(strings.TrimSpace(text), "/")
+	if len(parts) != 4 || len(parts[1]) == 0 || len(parts[3]) == 0 {
+		return entry, fmt.Errorf("invalid inventory entry %q, expected group/Kind/namespace/name", text)
+	}
+	return Entry{Group: parts[0], Kind: parts[1], Namespace: parts[2], Name: parts[3]}, nil
+}
+
+// EntryOf the inventory entry of a document, a namespaced resource
+// without a namespace is created in namespace
+func EntryOf(document *Document, scopes Scopes, namespace string) Entry {
+	return Entry{Group: document.Group(), Kind: document.Kind(), Namespace: scopes.Namespace(document, namespace), Name: document.Name()}
+}
+
+// AddInventory labels every resource of documents with id and appends
+// the inventory ConfigMap name in namespace listing them, namespace is
+// also that of the namespaced resources without one
+func AddInventory(documents []*Document, name, namespace, id string) []*Document {
+	scopes := NewScopes(documents)
+	var entries []string
+	for _, document := range documents {
+		if document.Object == nil || isInventory(document, name, namespace) {
+			continue
+		}
+		labels := Set(GetMap(document.Object, "metadata", "labels"), id, InventoryLabel)
+		document.Object = Set(document.Object, labels, "metadata", "labels")
+		document.Modified = true
+		entries = append(entries, EntryOf(document, scopes, namespace).String())
+	}
+	sort.Strings(entries)
+	inventory := &Document{Object: yaml.MapSlice{
+		{Key: "apiVersion", Value: "v1"},
+		{Key: "kind", Value: "ConfigMap"},
+		{Key: "metadata", Value: yaml.MapSlice{
+			{Key: "name", Value: name},
+			{Key: "namespace", Value: namespace},
+			{Key: "labels", Value: yaml.MapSlice{{Key: InventoryLabel, Value: id}}},
+		}},
+		{Key: "data", Value: yaml.MapSlice{{Key: InventoryKey, Value: strings.Join(entries, "\n") + "\n"}}},
+	}, Modified: true}
+	var out []*Document
+	for _, document := range documents {
+		if !isInventory(document, name, namespace) {
+			out = append(out, document)
+		}
+	}
+	out = append(out, inventory)
+	Reindex(out)
+	return out
+}
+
+// isInventory reports the rendered document is the inventory itself
+func isInventory(document *Document, name, namespace string) bool {
+	return document.Object != nil && document.Kind() == "ConfigMap" && document.Name() == name &&
+		(len(document.Namespace()) == 0 || document.Namespace() == namespace)
+}
+
+// ReadInventory the entries of the inventory ConfigMaps of documents,
+// or when there is none, of the resources of documents, those
+// namespaced without a namespace in namespace
+func ReadInventory(documents []*Document, namespace string) (entries []Entry, err error) {
+	found := false
+	for _, document := range documents {
+		if document.Object == nil || document.Kind() != "ConfigMap" ||
+			len(GetString(document.Object, "metadata", "labels", InventoryLabel)) == 0 ||
+			Get(document.Object, "data", InventoryKey) == nil {
+			continue
+		}
+		found = true
+		for _, line := range strings.Split(GetString(document.Object, "data", InventoryKey), "\n") {
+			if len(strings.TrimSpace(line)) == 0 {
+				continue
+			}
+			entry, err := ParseEntry(line)
+			if err != nil {
+				return nil, fmt.Errorf("document %d (%s): %v", document.Index+1, document.Identity(), err)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	if found {
+		return
+	}
+	scopes := NewScopes(documents)
+	for _, document := range documents {
+		if document.Object != nil {
+			entries = append(entries, EntryOf(document, scopes, namespace))
+		}
+	}
+	return
+}
+
+// PrunePlan the entries of previous missing from current, in reverse
+// install order, the order to delete them in
+func PrunePlan(previous, current []Entry) (prune []Entry) {
+	kept := make(map[Entry]bool)
+	for _, entry := range current {
+		kept[entry] = true
+	}
+	for _, entry := range previous {
+		if !kept[entry] {
+			kept[entry] = true
+			prune = append(prune, entry)
+		}
+	}
+	sort.SliceStable(prune, func(i, j int) bool {
+		return InstallRank(prune[i].Kind) > InstallRank(prune[j].Kind)
+	})
+	return
+}
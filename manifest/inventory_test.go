@@ -0,0 +1,123 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+const inventoryText = "apiVersion: v1\nkind: Service\nmetadata: {name: web}\n---\n" +
+	"apiVersion: apps/v1\nkind: Deployment\nmetadata: {name: web, namespace: other}\n---\n" +
+	"apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata: {name: reader, namespace: ignored}\n---\n" +
+	"apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata: {name: widgets.example.com}\n" +
+	"spec: {group: example.com, scope: Cluster, names: {kind: Widget}}\n---\n" +
+	"apiVersion: example.com/v1\nkind: Widget\nmetadata: {name: w}\n"
+
+func TestAddInventory(t *testing.T) {
+	documents := parse(t, inventoryText+"---\napiVersion: v1\nkind: ConfigMap\nmetadata: {name: inv}\ndata: {inventory: stale}\n")
+	documents = AddInventory(documents, "inv", "prod", "prod-inv")
+	if len(documents) != 6 {
+		t.Fatalf("%d documents, want 6", len(documents))
+	}
+	for i, document := range documents {
+		if document.Index != i {
+			t.Errorf("document %d has index %d", i, document.Index)
+		}
+		if got := GetString(document.Object, "metadata", "labels", InventoryLabel); got != "prod-inv" {
+			t.Errorf("%s: label %q", document.Identity(), got)
+		}
+	}
+	inventory := documents[5]
+	if inventory.Identity() != "v1/ConfigMap prod/inv" {
+		t.Errorf("inventory %s", inventory.Identity())
+	}
+	want := "/Service/prod/web\n" +
+		"apiextensions.k8s.io/CustomResourceDefinition//widgets.example.com\n" +
+		"apps/Deployment/other/web\n" +
+		"example.com/Widget//w\n" +
+		"rbac.authorization.k8s.io/ClusterRole//reader\n"
+	if got := GetString(inventory.Object, "data", InventoryKey); got != want {
+		t.Errorf("inventory\n%s\nwant\n%s", got, want)
+	}
+
+	entries, err := ReadInventory(documents, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, entry := range entries {
+		lines = append(lines, entry.String())
+	}
+	if got := strings.Join(lines, "\n") + "\n"; got != want {
+		t.Errorf("ReadInventory\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestReadInventoryResources(t *testing.T) {
+	entries, err := ReadInventory(parse(t, inventoryText), "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/Service/staging/web",
+		"apps/Deployment/other/web",
+		"rbac.authorization.k8s.io/ClusterRole//reader",
+		"apiextensions.k8s.io/CustomResourceDefinition//widgets.example.com",
+		"example.com/Widget//w",
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("entries %v, want %v", entries, want)
+	}
+	for i, entry := range entries {
+		if entry.String() != want[i] {
+			t.Errorf("entry %d %s, want %s", i, entry, want[i])
+		}
+	}
+}
+
+func TestReadInventoryInvalid(t *testing.T) {
+	documents := parse(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: inv\n  labels: {k8s-template/inventory-id: x}\ndata: {inventory: \"a/b\"}\n")
+	if _, err := ReadInventory(documents, "default"); err == nil || !strings.Contains(err.Error(), "invalid inventory entry") {
+		t.Errorf("error %v", err)
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		text string
+		want Entry
+		err  bool
+	}{
+		{"apps/Deployment/prod/web", Entry{Group: "apps", Kind: "Deployment", Namespace: "prod", Name: "web"}, false},
+		{" /Namespace//prod ", Entry{Kind: "Namespace", Name: "prod"}, false},
+		{"apps/Deployment/web", Entry{}, true},
+		{"apps//prod/web", Entry{}, true},
+		{"apps/Deployment/prod/", Entry{}, true},
+	}
+	for _, test := range tests {
+		got, err := ParseEntry(test.text)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("ParseEntry(%q) = %v, %v", test.text, got, err)
+		}
+	}
+}
+
+func TestPrunePlan(t *testing.T) {
+	entry := func(text string) Entry {
+		e, err := ParseEntry(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	previous := []Entry{entry("/Namespace//app"), entry("apps/Deployment/app/web"), entry("/Service/app/web"),
+		entry("/ConfigMap/app/cfg"), entry("/Service/app/web")}
+	current := []Entry{entry("/Service/app/web")}
+	var got []string
+	for _, e := range PrunePlan(previous, current) {
+		got = append(got, e.String())
+	}
+	want := "apps/Deployment/app/web /ConfigMap/app/cfg /Namespace//app"
+	if strings.Join(got, " ") != want {
+		t.Errorf("PrunePlan = %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/davidwalter0/transform"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Output formats of a rendered stream
+const (
+	// FormatYAML the --- separated documents as rendered
+	FormatYAML = "yaml"
+	// FormatJSON each resource as an indented json object
+	FormatJSON = "json"
+	// FormatJSONStream each resource as json on a line of its own
+	FormatJSONStream = "json-stream"
+	// FormatList the resources as the items of a single v1 List
+	FormatList = "list"
+)
+
+// Formats the output formats Format accepts
+var Formats = []string{FormatYAML, FormatJSON, FormatJSONStream, FormatList}
+
+// Format documents as one of Formats. Json output keeps the key order
+// of the yaml and leaves <, > and & unescaped, comments are dropped.
+func Format(documents []*Document, format string) (string, error) {
+	if err := CheckFormat(format); err != nil {
+		return "", err
+	} else if format == FormatYAML {
+		return Join(documents), nil
+	}
+	var buffer bytes.Buffer
+	var items [][]byte
+	for _, document := range documents {
+		if document.Object == nil {
+			continue
+		}
+		text, err := document.JSON(format == FormatJSON)
+		if err != nil {
+			return "", fmt.Errorf("document %d (%s): %v", document.Index+1, document.Identity(), err)
+		}
+		if format == FormatList {
+			items = append(items, text)
+			continue
+		}
+		buffer.Write(text)
+		buffer.WriteString("\n")
+	}
+	if format == FormatList {
+		var list bytes.Buffer
+		list.WriteString(`{"apiVersion":"v1","kind":"List","items":[`)
+		list.Write(bytes.Join(items, []byte(",")))
+		list.WriteString("]}")
+		if err := json.Indent(&buffer, list.Bytes(), "", "  "); err != nil {
+			return "", err
+		}
+		buffer.WriteString("\n")
+	}
+	return buffer.String(), nil
+}
+
+// CheckFormat reports a format that is not one of Formats
+func CheckFormat(format string) error {
+	for _, known := range Formats {
+		if format == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// JSON encoding of the document object in the key order of the yaml,
+// indented when indent is set
+func (document *Document) JSON(indent bool) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := encodeJSON(&buffer, document.Object); err != nil {
+		return nil, err
+	}
+	if !indent {
+		return buffer.Bytes(), nil
+	}
+	var out bytes.Buffer
+	err := json.Indent(&out, buffer.Bytes(), "", "  ")
+	return out.Bytes(), err
+}
+
+// encodeJSON writes value as compact json, keys read by yaml as ints,
+// bools or floats are written as their text as kubectl does
+func encodeJSON(buffer *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		buffer.WriteString("{")
+		for i, item := range v {
+			if i > 0 {
+				buffer.WriteString(",")
+			}
+			var key string
+			switch k := item.Key.(type) {
+			case string:
+				key = k
+			case int, int64, uint64, bool:
+				key = fmt.Sprint(k)
+			case float64:
+				key = strconv.FormatFloat(k, 'g', -1, 64)
+			default:
+				return fmt.Errorf("expected a string map key, found %T", item.Key)
+			}
+			if err := encodeJSON(buffer, key); err != nil {
+				return err
+			}
+			buffer.WriteString(":")
+			if err := encodeJSON(buffer, item.Value); err != nil {
+				return err
+			}
+		}
+		buffer.WriteString("}")
+		return nil
+	case []interface{}:
+		buffer.WriteString("[")
+		for i, item := range v {
+			if i > 0 {
+				buffer.WriteString(",")
+			}
+			if err := encodeJSON(buffer, item); err != nil {
+				return err
+			}
+		}
+		buffer.WriteString("]")
+		return nil
+	}
+	value, err := transform.TransformData(value)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err = encoder.Encode(value); err != nil {
+		return err
+	}
+	// Encode terminates each value with a newline
+	buffer.Truncate(buffer.Len() - 1)
+	return nil
+}
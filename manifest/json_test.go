@@ -0,0 +1,134 @@
+package manifest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const jsonStream = `# leading comment only document
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  annotations:
+    url: http://x/?a=1&b=<2>
+data:
+  z: "1"
+  w: yes
+  1: one
+---
+# between
+---
+apiVersion: v1
+kind: Service
+metadata: {name: b}
+spec:
+  ports: [{port: 80}]
+`
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		format string
+		want   string
+	}{
+		{"yaml is the stream as is", jsonStream, FormatYAML, jsonStream},
+		{"json", jsonStream, FormatJSON, `{
+  "apiVersion": "v1",
+  "kind": "ConfigMap",
+  "metadata": {
+    "name": "a",
+    "annotations": {
+      "url": "http://x/?a=1&b=<2>"
+    }
+  },
+  "data": {
+    "z": "1",
+    "w": true,
+    "1": "one"
+  }
+}
+{
+  "apiVersion": "v1",
+  "kind": "Service",
+  "metadata": {
+    "name": "b"
+  },
+  "spec": {
+    "ports": [
+      {
+        "port": 80
+      }
+    ]
+  }
+}
+`},
+		{"json stream", jsonStream, FormatJSONStream,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a","annotations":{"url":"http://x/?a=1&b=<2>"}},"data":{"z":"1","w":true,"1":"one"}}` + "\n" +
+				`{"apiVersion":"v1","kind":"Service","metadata":{"name":"b"},"spec":{"ports":[{"port":80}]}}` + "\n"},
+		{"list", "apiVersion: v1\nkind: ConfigMap\nmetadata: {name: a}\n---\n# c\n---\napiVersion: v1\nkind: ConfigMap\nmetadata: {name: b}\n", FormatList, `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {
+      "apiVersion": "v1",
+      "kind": "ConfigMap",
+      "metadata": {
+        "name": "a"
+      }
+    },
+    {
+      "apiVersion": "v1",
+      "kind": "ConfigMap",
+      "metadata": {
+        "name": "b"
+      }
+    }
+  ]
+}
+`},
+		{"comments only json", "# a\n---\n# b\n", FormatJSON, ""},
+		{"comments only json stream", "# a\n", FormatJSONStream, ""},
+		{"comments only list", "# a\n---\n\n", FormatList, "{\n  \"apiVersion\": \"v1\",\n  \"kind\": \"List\",\n  \"items\": []\n}\n"},
+		{"comments only yaml", "# a\n---\n# b\n", FormatYAML, "# a\n---\n# b\n"},
+	}
+	for _, test := range tests {
+		got, err := Format(parse(t, test.text), test.format)
+		if err != nil || got != test.want {
+			t.Errorf("%s: Format =\n%s%v\nwant\n%s", test.name, got, err, test.want)
+			continue
+		}
+		if test.format == FormatYAML {
+			continue
+		}
+		// every line of a stream and the whole of the others is json
+		values := []string{got}
+		if test.format == FormatJSONStream {
+			values = strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+		}
+		decoder := json.NewDecoder(strings.NewReader(strings.Join(values, "\n")))
+		for decoder.More() {
+			var value interface{}
+			if err := decoder.Decode(&value); err != nil {
+				t.Errorf("%s: %v", test.name, err)
+				break
+			}
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	if _, err := Format(nil, "xml"); err == nil || err.Error() != `unknown output format "xml", expected one of yaml, json, json-stream, list` {
+		t.Errorf("Format xml error %v", err)
+	}
+	documents := parse(t, "apiVersion: v1\nkind: ConfigMap\nmetadata: {name: a}\n")
+	documents[0].Object = append(documents[0].Object, yaml.MapItem{Key: nil, Value: "x"})
+	if _, err := Format(documents, FormatJSON); err == nil || err.Error() != "document 1 (v1/ConfigMap a): expected a string map key, found <nil>" {
+		t.Errorf("Format of a list key error %v", err)
+	}
+}
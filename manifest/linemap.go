@@ -0,0 +1,100 @@
+package manifest
+
+import (
+	"strings"
+)
+
+// maxLineMapCells bounds the longest common subsequence table, larger
+// inputs map lines one to one
+const maxLineMapCells = 16 * 1024 * 1024
+
+// LineMap maps lines of a rendered stream back to the template lines
+// that produced them. Lines common to both, found as the longest
+// common subsequence, anchor the map; rendered lines between anchors,
+// the output of template actions, map to the template lines between
+// the same anchors.
+type LineMap struct {
+	// anchors pairs of rendered and template lines, counting from 1
+	anchors [][2]int
+	last    int
+}
+
+// NewLineMap builds the map of rendered to template lines
+func NewLineMap(template, rendered string) *LineMap {
+	t := strings.Split(template, "\n")
+	r := strings.Split(rendered, "\n")
+	m := &LineMap{last: len(t)}
+	if len(t)*len(r) > maxLineMapCells {
+		return m
+	}
+	lcs := lcsTable(r, t)
+	for i, j := 0, 0; i < len(r) && j < len(t); {
+		switch {
+		case r[i] == t[j] && len(strings.TrimSpace(r[i])) > 0:
+			m.anchors = append(m.anchors, [2]int{i + 1, j + 1})
+			i++
+			j++
+		case r[i] == t[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return m
+}
+
+// Template returns the template line that produced rendered line
+func (m *LineMap) Template(line int) int {
+	if m == nil || len(m.anchors) == 0 {
+		if m != nil && line > m.last && m.last > 0 {
+			return m.last
+		}
+		return line
+	}
+	// the anchors bracketing line
+	before, after := [2]int{0, 0}, [2]int{-1, m.last + 1}
+	for _, anchor := range m.anchors {
+		if anchor[0] <= line {
+			before = anchor
+		} else {
+			after = anchor
+			break
+		}
+	}
+	if before[0] == line {
+		return before[1]
+	}
+	n := before[1] + line - before[0]
+	if after[0] >= 0 && n >= after[1] {
+		n = after[1] - 1
+	}
+	if n <= before[1] {
+		n = before[1] + 1
+	}
+	return n
+}
+
+// lcsTable of a and b, lcs[i][j] the length of the longest common
+// subsequence of a[i:] and b[j:]
+func lcsTable(a, b []string) [][]int32 {
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs
+}
@@ -0,0 +1,77 @@
+package manifest
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+)
+
+func TestLineMap(t *testing.T) {
+	templateText := "a: 1\nb: {{ .B }}\nc:\n{{- range .C }}\n- {{ . }}\n{{- end }}\nd: 4\ne: 5\n"
+	rendered := "a: 1\nb: 2\nc:\n- x\n- y\n- z\nd: 4\ne: 5\n"
+	lines := NewLineMap(templateText, rendered)
+	tests := []struct {
+		rendered int
+		template int
+	}{
+		{1, 1},
+		// the output of an action maps to the line of the action
+		{2, 2},
+		{3, 3},
+		// range output between anchors maps to the lines between them
+		{4, 4},
+		{5, 5},
+		{6, 6},
+		{7, 7},
+		{8, 8},
+	}
+	for _, test := range tests {
+		if got := lines.Template(test.rendered); got != test.template {
+			t.Errorf("Template(%d) = %d, want %d", test.rendered, got, test.template)
+		}
+	}
+	if got := (*LineMap)(nil).Template(7); got != 7 {
+		t.Errorf("nil Template(7) = %d", got)
+	}
+	if got := NewLineMap("a\nb\n", "x\ny\nz\nw\n").Template(4); got != 3 {
+		t.Errorf("Template past the template end = %d, want 3", got)
+	}
+}
+
+// an error in the Nth document of the rendered stream is reported at
+// the template line that produced it
+func TestCheckTemplateLine(t *testing.T) {
+	templateText := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: keys
+data:
+{{- range .Keys }}
+  {{ . }}: "1"
+{{- end }}
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: {{ .Name }}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  labels:
+    app: web
+`
+	var rendered bytes.Buffer
+	values := map[string]interface{}{"Keys": []string{"a", "b", "c", "d", "e", "f"}, "Name": "s"}
+	if err := template.Must(template.New("t").Parse(templateText)).Execute(&rendered, values); err != nil {
+		t.Fatal(err)
+	}
+	errors := Check(Split(rendered.String()))
+	if len(errors) != 1 || errors[0].Index != 2 {
+		t.Fatalf("Check = %v", errors)
+	}
+	lines := NewLineMap(templateText, rendered.String())
+	if errors[0].Line != 20 || lines.Template(errors[0].Line) != 17 {
+		t.Errorf("error at rendered line %d, template line %d, want 20 and 17", errors[0].Line, lines.Template(errors[0].Line))
+	}
+}
@@ -0,0 +1,90 @@
+package manifest
+
+import (
+	"fmt"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Get the value at path in a decoded object, nil when missing
+func Get(object interface{}, path ...string) interface{} {
+	for _, key := range path {
+		mapping, ok := object.(yaml.MapSlice)
+		if !ok {
+			return nil
+		}
+		object = nil
+		for _, item := range mapping {
+			if fmt.Sprint(item.Key) == key {
+				object = item.Value
+				break
+			}
+		}
+	}
+	return object
+}
+
+// GetString the scalar at path written as a string, empty when missing
+func GetString(object interface{}, path ...string) string {
+	switch value := Get(object, path...).(type) {
+	case nil, yaml.MapSlice, []interface{}:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// GetMap the mapping at path, nil when missing or not a mapping
+func GetMap(object interface{}, path ...string) yaml.MapSlice {
+	mapping, _ := Get(object, path...).(yaml.MapSlice)
+	return mapping
+}
+
+// GetList the sequence at path, nil when missing or not a sequence
+func GetList(object interface{}, path ...string) []interface{} {
+	list, _ := Get(object, path...).([]interface{})
+	return list
+}
+
+// Set value at path, creating missing mappings; the updated object is
+// returned as a MapSlice may grow
+func Set(object yaml.MapSlice, value interface{}, path ...string) yaml.MapSlice {
+	if len(path) == 0 {
+		return object
+	}
+	for i, item := range object {
+		if fmt.Sprint(item.Key) == path[0] {
+			if len(path) == 1 {
+				object[i].Value = value
+			} else {
+				child, _ := item.Value.(yaml.MapSlice)
+				object[i].Value = Set(child, value, path[1:]...)
+			}
+			return object
+		}
+	}
+	if len(path) == 1 {
+		return append(object, yaml.MapItem{Key: path[0], Value: value})
+	}
+	return append(object, yaml.MapItem{Key: path[0], Value: Set(nil, value, path[1:]...)})
+}
+
+// Delete the key at the end of path
+func Delete(object yaml.MapSlice, path ...string) yaml.MapSlice {
+	if len(path) == 0 {
+		return object
+	}
+	for i, item := range object {
+		if fmt.Sprint(item.Key) != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return append(object[:i:i], object[i+1:]...)
+		}
+		if child, ok := item.Value.(yaml.MapSlice); ok {
+			object[i].Value = Delete(child, path[1:]...)
+		}
+		break
+	}
+	return object
+}
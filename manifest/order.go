@@ -0,0 +1,75 @@
+package manifest
+
+import "sort"
+
+// installOrder ranks kinds so a resource follows those it depends on,
+// kinds not listed are installed last in the order they were written
+var installOrder = map[string]int{}
+
+func init() {
+	for rank, kinds := range [][]string{
+		{"Namespace"},
+		{"ResourceQuota", "LimitRange", "PriorityClass"},
+		{"CustomResourceDefinition"},
+		{"ServiceAccount"},
+		{"ClusterRole", "Role"},
+		{"ClusterRoleBinding", "RoleBinding"},
+		{"Secret"},
+		{"ConfigMap"},
+		{"StorageClass", "PersistentVolume"},
+		{"PersistentVolumeClaim"},
+		{"Service"},
+		{"Pod", "ReplicationController", "ReplicaSet", "Deployment", "DaemonSet", "StatefulSet", "Job", "CronJob"},
+		{"HorizontalPodAutoscaler", "PodDisruptionBudget"},
+		{"Ingress"},
+		{"APIService", "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration"},
+	} {
+		for _, kind := range kinds {
+			installOrder[kind] = rank
+		}
+	}
+}
+
+// InstallRank of a kind, kinds without a rank sort after all others
+func InstallRank(kind string) int {
+	if rank, ok := installOrder[kind]; ok {
+		return rank
+	}
+	return len(installOrder)
+}
+
+// SortInstallOrder orders documents so dependencies are created first,
+// Namespaces, CRDs, ServiceAccounts, RBAC, Secrets, ConfigMaps, volume
+// claims, Services, workloads, Ingresses then webhooks. The sort is
+// stable; leading comment only documents stay at the top and any other
+// comment only document moves with the document after it.
+func SortInstallOrder(documents []*Document) []*Document {
+	type group struct {
+		documents []*Document
+		rank      int
+	}
+	var head, pending []*Document
+	var groups []group
+	for _, document := range documents {
+		switch {
+		case document.Object != nil:
+			groups = append(groups, group{append(pending, document), InstallRank(document.Kind())})
+			pending = nil
+		case len(groups) == 0:
+			head = append(head, document)
+		default:
+			pending = append(pending, document)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].rank < groups[j].rank
+	})
+	out := make([]*Document, 0, len(documents))
+	out = append(out, head...)
+	for _, group := range groups {
+		out = append(out, group.documents...)
+	}
+	out = append(out, pending...)
+	Reindex(out)
+	return out
+}
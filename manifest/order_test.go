@@ -0,0 +1,69 @@
+package manifest
+
+import (
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestSortInstallOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		labels yaml.MapSlice
+		want   string
+	}{
+		{
+			name: "unmodified",
+			text: "# head\n---\n# deployment\nkind: Deployment\nmetadata: {name: web}\n# end web\n---\n" +
+				"# about the config\n---\nkind: ConfigMap\nmetadata: {name: cfg} # inline\n---\nkind: Namespace\nmetadata: {name: ns}\n",
+			want: "# head\n---\nkind: Namespace\nmetadata: {name: ns}\n---\n" +
+				"# about the config\n---\nkind: ConfigMap\nmetadata: {name: cfg} # inline\n---\n" +
+				"# deployment\nkind: Deployment\nmetadata: {name: web}\n# end web\n",
+		},
+		{
+			name:   "modified documents keep their comment blocks",
+			labels: yaml.MapSlice{{Key: "team", Value: "web"}},
+			text: "# ingress\nkind: Ingress\nmetadata:\n  name: web\n\n# end web\n---\n" +
+				"kind: Service\nmetadata:\n  name: web\n# end service\n---\n# trailing document\n",
+			want: "kind: Service\nmetadata:\n  name: web\n  labels:\n    team: web\n# end service\n---\n" +
+				"# ingress\nkind: Ingress\nmetadata:\n  name: web\n  labels:\n    team: web\n\n# end web\n---\n" +
+				"# trailing document\n",
+		},
+	}
+	for _, test := range tests {
+		documents := Split(test.text)
+		if errors := Check(documents); len(errors) > 0 {
+			for _, e := range errors {
+				if e.Message != "missing apiVersion" {
+					t.Fatalf("%s: %v", test.name, e)
+				}
+			}
+		}
+		if len(test.labels) > 0 {
+			AddLabels(documents, test.labels)
+			if err := EncodeModified(documents); err != nil {
+				t.Fatal(err)
+			}
+		}
+		documents = SortInstallOrder(documents)
+		if got := Join(documents); got != test.want {
+			t.Errorf("%s: SortInstallOrder =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+		for i, document := range documents {
+			if document.Index != i {
+				t.Errorf("%s: document %d has index %d", test.name, i, document.Index)
+			}
+		}
+	}
+}
+
+func TestInstallRank(t *testing.T) {
+	kinds := []string{"Namespace", "CustomResourceDefinition", "ServiceAccount", "ClusterRole", "Secret",
+		"ConfigMap", "PersistentVolumeClaim", "Service", "Deployment", "Ingress", "ValidatingWebhookConfiguration", "Widget"}
+	for i := 1; i < len(kinds); i++ {
+		if InstallRank(kinds[i-1]) > InstallRank(kinds[i]) {
+			t.Errorf("%s ranks after %s", kinds[i-1], kinds[i])
+		}
+	}
+}
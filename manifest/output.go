@@ -0,0 +1,170 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/davidwalter0/k8s-template/atomicfile"
+)
+
+// DefaultPathPattern names the file of a resource written by WriteDir
+const DefaultPathPattern = "{{ .Namespace }}/{{ .Kind | lower }}-{{ .Name }}.yaml"
+
+// RecordFile in an output directory lists the files of the last write,
+// the files a later write with prune may remove
+const RecordFile = ".k8s-template-files"
+
+// ClusterDirectory is the Namespace field of cluster scoped resources,
+// an underscore keeps it apart from any namespace name
+const ClusterDirectory = "_cluster"
+
+// PathFields of a document available to the path pattern
+type PathFields struct {
+	APIVersion string
+	Group      string
+	Kind       string
+	Name       string
+	// Namespace of the resource, default when a namespaced resource
+	// has none and _cluster for cluster scoped resources
+	Namespace string
+	// Index of the document in the stream, counting from 0
+	Index int
+}
+
+// NewPathPattern parses a text/template naming output files from
+// PathFields, with the functions lower and upper
+func NewPathPattern(pattern string) (*template.Template, error) {
+	return template.New("path").Funcs(template.FuncMap{
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+	}).Option("missingkey=error").Parse(pattern)
+}
+
+// Paths of the non empty documents, relative to the output directory,
+// an error if a path leaves the directory or two documents share one
+func Paths(documents []*Document, pattern *template.Template) (map[*Document]string, error) {
+	scopes := NewScopes(documents)
+	paths := make(map[*Document]string)
+	owners := make(map[string]*Document)
+	for _, document := range documents {
+		if document.Object == nil {
+			continue
+		}
+		fields := PathFields{
+			APIVersion: document.APIVersion(),
+			Group:      document.Group(),
+			Kind:       document.Kind(),
+			Name:       document.Name(),
+			Namespace:  scopes.Namespace(document, "default"),
+			Index:      document.Index,
+		}
+		if !scopes.Namespaced(document) {
+			fields.Namespace = ClusterDirectory
+		}
+		var buffer bytes.Buffer
+		if err := pattern.Execute(&buffer, fields); err != nil {
+			return nil, fmt.Errorf("document %d (%s): %v", document.Index+1, document.Identity(), err)
+		}
+		path := filepath.Clean(buffer.String())
+		if outside(path) {
+			return nil, fmt.Errorf("document %d (%s): path %q is outside the output directory", document.Index+1, document.Identity(), buffer.String())
+		}
+		if owner, ok := owners[path]; ok {
+			return nil, fmt.Errorf("document %d (%s) and document %d (%s) are both written to %s",
+				owner.Index+1, owner.Identity(), document.Index+1, document.Identity(), path)
+		}
+		owners[path] = document
+		paths[document] = path
+	}
+	return paths, nil
+}
+
+// WriteDir writes each resource of documents to its own file under
+// dir, named by pattern. Files are replaced atomically, Secrets are
+// written with mode 0600. With prune the files listed by the record
+// of the previous write that are not written again are removed.
+func WriteDir(dir string, documents []*Document, pattern *template.Template, prune bool) (written []string, err error) {
+	paths, err := Paths(documents, pattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, document := range documents {
+		path, ok := paths[document]
+		if !ok {
+			continue
+		}
+		filename := filepath.Join(dir, path)
+		if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return written, err
+		}
+		var perm os.FileMode = 0644
+		if document.Kind() == "Secret" {
+			perm = 0600
+		}
+		text := document.Text
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		if err = atomicfile.WriteFile(filename, []byte(text), perm); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	if prune {
+		if err = removeStale(dir, written); err != nil {
+			return written, err
+		}
+	}
+	sort.Strings(written)
+	record := strings.Join(written, "\n")
+	if len(record) > 0 {
+		record += "\n"
+	}
+	return written, atomicfile.WriteFile(filepath.Join(dir, RecordFile), []byte(record), 0644)
+}
+
+// removeStale removes the files of the previous record not in written
+// and the directories left empty
+func removeStale(dir string, written []string) error {
+	file, err := os.Open(filepath.Join(dir, RecordFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	keep := make(map[string]bool)
+	for _, path := range written {
+		keep[path] = true
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		path := filepath.Clean(strings.TrimSpace(scanner.Text()))
+		if keep[path] || outside(path) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(dir, path)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		// remove parents emptied by the removal, stopping at dir or
+		// the first directory that still holds files
+		for parent := filepath.Dir(path); parent != "."; parent = filepath.Dir(parent) {
+			if os.Remove(filepath.Join(dir, parent)) != nil {
+				break
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// outside reports a cleaned path that does not name a file under the
+// directory it is relative to
+func outside(path string) bool {
+	return filepath.IsAbs(path) || path == "." || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator))
+}
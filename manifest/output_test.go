@@ -0,0 +1,179 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const outputStream = `# a comment only document
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: team
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+  namespace: team
+stringData:
+  password: x
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`
+
+// files under dir and their modes, the record file excluded
+func files(t *testing.T, dir string) map[string]os.FileMode {
+	found := make(map[string]os.FileMode)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() == RecordFile {
+			return err
+		}
+		relative, _ := filepath.Rel(dir, path)
+		found[relative] = info.Mode().Perm()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestWriteDir(t *testing.T) {
+	dir := t.TempDir()
+	pattern, err := NewPathPattern(DefaultPathPattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, err := WriteDir(dir, parse(t, outputStream), pattern, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]os.FileMode{
+		"_cluster/namespace-team.yaml": 0644,
+		"team/secret-db.yaml":          0600,
+		"default/deployment-web.yaml":  0644,
+	}
+	got := files(t, dir)
+	if len(got) != len(want) || len(written) != len(want) {
+		t.Errorf("WriteDir wrote %v, files %v, want %v", written, got, want)
+	}
+	for path, mode := range want {
+		if got[path] != mode {
+			t.Errorf("%s mode %v, want %v", path, got[path], mode)
+		}
+	}
+	text, _ := ioutil.ReadFile(filepath.Join(dir, "team", "secret-db.yaml"))
+	if !strings.HasPrefix(string(text), "apiVersion: v1\nkind: Secret\n") || !strings.HasSuffix(string(text), "password: x\n") {
+		t.Errorf("secret-db.yaml =\n%s", text)
+	}
+	record, _ := ioutil.ReadFile(filepath.Join(dir, RecordFile))
+	if string(record) != "_cluster/namespace-team.yaml\ndefault/deployment-web.yaml\nteam/secret-db.yaml\n" {
+		t.Errorf("record =\n%s", record)
+	}
+}
+
+func TestWriteDirPrune(t *testing.T) {
+	pattern, _ := NewPathPattern(DefaultPathPattern)
+	// the second write drops the Secret and so the team directory
+	second := strings.Replace(outputStream, "kind: Secret\nmetadata:\n  name: db\n  namespace: team\n", "kind: ConfigMap\nmetadata:\n  name: cfg\n", 1)
+	tests := []struct {
+		prune bool
+		want  []string
+	}{
+		{true, []string{"_cluster/namespace-team.yaml", "default/configmap-cfg.yaml", "default/deployment-web.yaml", "unrecorded.yaml"}},
+		{false, []string{"_cluster/namespace-team.yaml", "default/configmap-cfg.yaml", "default/deployment-web.yaml", "team/secret-db.yaml", "unrecorded.yaml"}},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		if _, err := WriteDir(dir, parse(t, outputStream), pattern, true); err != nil {
+			t.Fatal(err)
+		}
+		// files the record does not list are never removed
+		if err := ioutil.WriteFile(filepath.Join(dir, "unrecorded.yaml"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := WriteDir(dir, parse(t, second), pattern, test.prune); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for path := range files(t, dir) {
+			got = append(got, path)
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("prune %v left %v, want %v", test.prune, got, test.want)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "team")); test.prune != os.IsNotExist(err) {
+			t.Errorf("prune %v: team directory %v", test.prune, err)
+		}
+	}
+}
+
+func TestWriteDirPruneOutside(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(dir, "keep.yaml")
+	if err := ioutil.WriteFile(outside, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(out, RecordFile), []byte("../keep.yaml\n"+outside+"\n.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pattern, _ := NewPathPattern(DefaultPathPattern)
+	if _, err := WriteDir(out, parse(t, outputStream), pattern, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("prune removed a file outside the output directory: %v", err)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	documents := parse(t, outputStream)
+	tests := []struct {
+		pattern string
+		want    string
+		err     string
+	}{
+		{"{{ .Index }}-{{ .Kind | upper }}.yaml", "1-NAMESPACE.yaml 2-SECRET.yaml 3-DEPLOYMENT.yaml", ""},
+		{"{{ .APIVersion }}/{{ .Name }}", "v1/team v1/db apps/v1/web", ""},
+		{"all.yaml", "", "document 2 (v1/Namespace team) and document 3 (v1/Secret team/db) are both written to all.yaml"},
+		{"../{{ .Name }}", "", `document 2 (v1/Namespace team): path "../team" is outside the output directory`},
+		{"/tmp/{{ .Name }}", "", `path "/tmp/team" is outside the output directory`},
+		{"{{ .Missing }}", "", "can't evaluate field Missing"},
+	}
+	for _, test := range tests {
+		pattern, err := NewPathPattern(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths, err := Paths(documents, pattern)
+		if len(test.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Paths(%s) error %v, want %s", test.pattern, err, test.err)
+			}
+			continue
+		}
+		var got []string
+		for _, document := range documents {
+			if path, ok := paths[document]; ok {
+				got = append(got, path)
+			}
+		}
+		if err != nil || strings.Join(got, " ") != test.want {
+			t.Errorf("Paths(%s) = %v, %v, want %s", test.pattern, got, err, test.want)
+		}
+	}
+}
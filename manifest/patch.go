@@ -0,0 +1,636 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Patch edits the rendered resources its target selects, either with
+// json 6902 Operations or a strategic merge style Merge mapping
+type Patch struct {
+	// Source and Line of the patch document, for messages
+	Source string
+	Line   int
+	Target Target
+	// Operations of a json 6902 patch
+	Operations []Operation
+	// Merge mapping of a strategic merge patch
+	Merge yaml.MapSlice
+}
+
+// Target selects resources; empty fields match any resource, Name is a
+// glob, LabelSelector holds key=value, key!=value, key and !key terms
+type Target struct {
+	Group         string
+	Version       string
+	Kind          string
+	Name          string
+	Namespace     string
+	LabelSelector string
+}
+
+// Operation one json 6902 operation
+type Operation struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+// ParsePatches reads the patches of a yaml stream or sequence. A
+// document holds target: and patch:, a sequence patch being a json
+// 6902 patch and a mapping a strategic merge patch; a document naming a
+// resource, kind and metadata.name, without a target is a strategic
+// merge patch of that resource.
+func ParsePatches(source, text string) (patches []*Patch, err error) {
+	for _, document := range Split(text) {
+		if document.Empty() {
+			continue
+		}
+		var entries []yaml.MapSlice
+		if err = yaml.Unmarshal([]byte(document.Text), &entries); err != nil {
+			var entry yaml.MapSlice
+			if err = yaml.Unmarshal([]byte(document.Text), &entry); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", source, document.Line, err)
+			}
+			entries = []yaml.MapSlice{entry}
+		}
+		for _, entry := range entries {
+			patch, err := parsePatch(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", source, document.Line, err)
+			}
+			patch.Source, patch.Line = source, document.Line
+			patches = append(patches, patch)
+		}
+	}
+	return
+}
+
+func parsePatch(mapping yaml.MapSlice) (*Patch, error) {
+	patch := &Patch{}
+	if Get(mapping, "target") == nil {
+		if len(GetString(mapping, "kind")) == 0 || len(GetString(mapping, "metadata", "name")) == 0 {
+			return nil, fmt.Errorf("a patch needs a target:, or the kind and metadata.name of the resource it merges into")
+		}
+		patch.Target = Target{Kind: GetString(mapping, "kind"), Name: GetString(mapping, "metadata", "name"),
+			Namespace: GetString(mapping, "metadata", "namespace")}
+		patch.Target.Group, patch.Target.Version = splitAPIVersion(GetString(mapping, "apiVersion"))
+		patch.Merge = mapping
+		return patch, nil
+	}
+	target := GetMap(mapping, "target")
+	patch.Target = Target{
+		Group:         GetString(target, "group"),
+		Version:       GetString(target, "version"),
+		Kind:          GetString(target, "kind"),
+		Name:          GetString(target, "name"),
+		Namespace:     GetString(target, "namespace"),
+		LabelSelector: GetString(target, "labelSelector"),
+	}
+	if apiVersion := GetString(target, "apiVersion"); len(apiVersion) > 0 {
+		patch.Target.Group, patch.Target.Version = splitAPIVersion(apiVersion)
+	}
+	if _, err := parseSelector(patch.Target.LabelSelector); err != nil {
+		return nil, err
+	}
+	body := Get(mapping, "patch")
+	if text, ok := body.(string); ok {
+		// kustomize writes the patch as a block string
+		var operations []yaml.MapSlice
+		var merge yaml.MapSlice
+		if err := yaml.Unmarshal([]byte(text), &operations); err == nil {
+			list := make([]interface{}, len(operations))
+			for i, operation := range operations {
+				list[i] = operation
+			}
+			body = list
+		} else if err = yaml.Unmarshal([]byte(text), &merge); err != nil {
+			return nil, fmt.Errorf("patch: %v", err)
+		} else {
+			body = merge
+		}
+	}
+	switch v := body.(type) {
+	case yaml.MapSlice:
+		patch.Merge = v
+	case []interface{}:
+		for i, item := range v {
+			operation := Operation{
+				Op:    GetString(item, "op"),
+				Path:  GetString(item, "path"),
+				From:  GetString(item, "from"),
+				Value: Get(item, "value"),
+			}
+			switch operation.Op {
+			case "add", "replace", "test":
+				if !has(GetMap(item), "value") {
+					return nil, fmt.Errorf("operation %d: %s needs a value", i+1, operation.Op)
+				}
+			case "move", "copy":
+				if _, err := pointer(operation.From); err != nil {
+					return nil, fmt.Errorf("operation %d: from: %v", i+1, err)
+				}
+			case "remove":
+			default:
+				return nil, fmt.Errorf("operation %d: unknown op %q", i+1, operation.Op)
+			}
+			if _, err := pointer(operation.Path); err != nil {
+				return nil, fmt.Errorf("operation %d: %v", i+1, err)
+			}
+			patch.Operations = append(patch.Operations, operation)
+		}
+	default:
+		return nil, fmt.Errorf("patch: expected a json 6902 sequence or a strategic merge mapping")
+	}
+	return patch, nil
+}
+
+// String names the patch and its target for messages
+func (patch *Patch) String() string {
+	var terms []string
+	for _, term := range [][2]string{
+		{"group", patch.Target.Group}, {"version", patch.Target.Version}, {"kind", patch.Target.Kind},
+		{"name", patch.Target.Name}, {"namespace", patch.Target.Namespace}, {"labelSelector", patch.Target.LabelSelector},
+	} {
+		if len(term[1]) > 0 {
+			terms = append(terms, term[0]+"="+term[1])
+		}
+	}
+	return fmt.Sprintf("%s:%d: patch of %s", patch.Source, patch.Line, strings.Join(terms, " "))
+}
+
+// Matches reports the patch targets the resource of document
+func (patch *Patch) Matches(document *Document) bool {
+	target := patch.Target
+	group, version := splitAPIVersion(document.APIVersion())
+	switch {
+	case document.Object == nil:
+		return false
+	case len(target.Group) > 0 && target.Group != group,
+		len(target.Version) > 0 && target.Version != version,
+		len(target.Kind) > 0 && target.Kind != document.Kind(),
+		len(target.Namespace) > 0 && target.Namespace != document.Namespace():
+		return false
+	}
+	if len(target.Name) > 0 {
+		if ok, _ := path.Match(target.Name, document.Name()); !ok {
+			return false
+		}
+	}
+	selector, _ := parseSelector(target.LabelSelector)
+	labels := GetMap(document.Object, "metadata", "labels")
+	for _, term := range selector {
+		value := Get(labels, term.key)
+		switch term.op {
+		case "=":
+			if value == nil || fmt.Sprint(value) != term.value {
+				return false
+			}
+		case "!=":
+			if value != nil && fmt.Sprint(value) == term.value {
+				return false
+			}
+		case "exists":
+			if value == nil {
+				return false
+			}
+		case "!":
+			if value != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Apply the patch to document
+func (patch *Patch) Apply(document *Document) error {
+	if patch.Merge != nil {
+		merged, _ := mergeValue(document.Object, patch.Merge, "").(yaml.MapSlice)
+		if merged == nil {
+			return fmt.Errorf("a patch cannot delete the resource")
+		}
+		document.Object = merged
+	}
+	for i, operation := range patch.Operations {
+		object, err := operation.apply(document.Object)
+		if err != nil {
+			return fmt.Errorf("operation %d, %s %s: %v", i+1, operation.Op, operation.Path, err)
+		}
+		mapping, ok := object.(yaml.MapSlice)
+		if !ok {
+			return fmt.Errorf("operation %d, %s %s: the resource is no longer a mapping", i+1, operation.Op, operation.Path)
+		}
+		document.Object = mapping
+	}
+	document.Modified = true
+	return nil
+}
+
+// ApplyPatches applies each patch to the documents it matches, in
+// order; a patch matching no document is an error
+func ApplyPatches(documents []*Document, patches []*Patch) error {
+	for _, patch := range patches {
+		matched := false
+		for _, document := range documents {
+			if !patch.Matches(document) {
+				continue
+			}
+			matched = true
+			if err := patch.Apply(document); err != nil {
+				return fmt.Errorf("%s: document %d (%s): %v", patch, document.Index+1, document.Identity(), err)
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: matches no resource", patch)
+		}
+	}
+	return nil
+}
+
+func splitAPIVersion(apiVersion string) (group, version string) {
+	if i := strings.Index(apiVersion, "/"); i >= 0 {
+		return apiVersion[:i], apiVersion[i+1:]
+	}
+	return "", apiVersion
+}
+
+type selectorTerm struct {
+	key, op, value string
+}
+
+// parseSelector reads key=value, key==value, key!=value, key and !key
+// terms separated by commas
+func parseSelector(text string) (terms []selectorTerm, err error) {
+	for _, term := range strings.Split(text, ",") {
+		term = strings.TrimSpace(term)
+		switch {
+		case len(term) == 0:
+			continue
+		case strings.Contains(term, "!="):
+			parts := strings.SplitN(term, "!=", 2)
+			terms = append(terms, selectorTerm{strings.TrimSpace(parts[0]), "!=", strings.TrimSpace(parts[1])})
+		case strings.Contains(term, "="):
+			parts := strings.SplitN(strings.Replace(term, "==", "=", 1), "=", 2)
+			terms = append(terms, selectorTerm{strings.TrimSpace(parts[0]), "=", strings.TrimSpace(parts[1])})
+		case strings.HasPrefix(term, "!"):
+			terms = append(terms, selectorTerm{strings.TrimSpace(term[1:]), "!", ""})
+		default:
+			terms = append(terms, selectorTerm{term, "exists", ""})
+		}
+		if last := terms[len(terms)-1]; len(last.key) == 0 || strings.ContainsAny(last.key+last.value, " ()") {
+			return nil, fmt.Errorf("labelSelector %q: unsupported term %q, use key=value, key!=value, key or !key", text, term)
+		}
+	}
+	return
+}
+
+// has reports mapping holds key, even with a null value
+func has(mapping yaml.MapSlice, key string) bool {
+	for _, item := range mapping {
+		if fmt.Sprint(item.Key) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// pointer splits a json pointer into its unescaped tokens
+func pointer(text string) ([]string, error) {
+	if len(text) == 0 {
+		return nil, nil
+	}
+	if !strings.HasPrefix(text, "/") {
+		return nil, fmt.Errorf("path %q is not a json pointer starting with /", text)
+	}
+	tokens := strings.Split(text[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// apply the operation to object, returning the updated object
+func (operation Operation) apply(object interface{}) (interface{}, error) {
+	path, _ := pointer(operation.Path)
+	switch operation.Op {
+	case "add":
+		return insert(object, path, copyValue(operation.Value), false)
+	case "replace":
+		return insert(object, path, copyValue(operation.Value), true)
+	case "remove":
+		object, _, err := remove(object, path)
+		return object, err
+	case "test":
+		value, err := lookup(object, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(value, operation.Value) {
+			return nil, fmt.Errorf("test failed, found %s", scalarOrJSON(value))
+		}
+		return object, nil
+	case "move", "copy":
+		from, _ := pointer(operation.From)
+		var value interface{}
+		var err error
+		if operation.Op == "move" {
+			if strings.HasPrefix(operation.Path+"/", operation.From+"/") && operation.Path != operation.From {
+				return nil, fmt.Errorf("cannot move %s into itself", operation.From)
+			}
+			object, value, err = remove(object, from)
+		} else {
+			value, err = lookup(object, from)
+			value = copyValue(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("from: %v", err)
+		}
+		return insert(object, path, value, false)
+	}
+	return nil, fmt.Errorf("unknown op %q", operation.Op)
+}
+
+// lookup the value at path
+func lookup(object interface{}, path []string) (interface{}, error) {
+	for i, token := range path {
+		switch v := object.(type) {
+		case yaml.MapSlice:
+			if !has(v, token) {
+				return nil, fmt.Errorf("/%s does not exist", strings.Join(path[:i+1], "/"))
+			}
+			object = Get(v, token)
+		case []interface{}:
+			n, err := index(token, len(v)-1)
+			if err != nil {
+				return nil, fmt.Errorf("/%s: %v", strings.Join(path[:i+1], "/"), err)
+			}
+			object = v[n]
+		default:
+			return nil, fmt.Errorf("/%s: %s is not a container", strings.Join(path[:i+1], "/"), describe(object))
+		}
+	}
+	return object, nil
+}
+
+// insert value at path, an existing value is replaced, a list element
+// inserted before; with replace the path must exist
+func insert(object interface{}, path []string, value interface{}, replace bool) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+	switch v := object.(type) {
+	case yaml.MapSlice:
+		if len(path) == 1 {
+			if replace && !has(v, token) {
+				return nil, fmt.Errorf("/%s does not exist", token)
+			}
+			return Set(v, value, token), nil
+		}
+		if !has(v, token) {
+			return nil, fmt.Errorf("/%s does not exist", token)
+		}
+		child, err := insert(Get(v, token), path[1:], value, replace)
+		if err != nil {
+			return nil, prefix(token, err)
+		}
+		return Set(v, child, token), nil
+	case []interface{}:
+		if len(path) == 1 && !replace {
+			n := len(v)
+			if token != "-" {
+				var err error
+				if n, err = index(token, len(v)); err != nil {
+					return nil, fmt.Errorf("/%s: %v", token, err)
+				}
+			}
+			v = append(v, nil)
+			copy(v[n+1:], v[n:])
+			v[n] = value
+			return v, nil
+		}
+		n, err := index(token, len(v)-1)
+		if err != nil {
+			return nil, fmt.Errorf("/%s: %v", token, err)
+		}
+		child, err := insert(v[n], path[1:], value, replace)
+		if err != nil {
+			return nil, prefix(token, err)
+		}
+		v[n] = child
+		return v, nil
+	}
+	return nil, fmt.Errorf("/%s: %s is not a container", token, describe(object))
+}
+
+// remove the value at path, returning the updated object and the value
+func remove(object interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole resource")
+	}
+	token := path[0]
+	switch v := object.(type) {
+	case yaml.MapSlice:
+		if !has(v, token) {
+			return nil, nil, fmt.Errorf("/%s does not exist", token)
+		}
+		if len(path) == 1 {
+			return Delete(v, token), Get(v, token), nil
+		}
+		child, value, err := remove(Get(v, token), path[1:])
+		if err != nil {
+			return nil, nil, prefix(token, err)
+		}
+		return Set(v, child, token), value, nil
+	case []interface{}:
+		n, err := index(token, len(v)-1)
+		if err != nil {
+			return nil, nil, fmt.Errorf("/%s: %v", token, err)
+		}
+		if len(path) == 1 {
+			value := v[n]
+			return append(v[:n:n], v[n+1:]...), value, nil
+		}
+		child, value, err := remove(v[n], path[1:])
+		if err != nil {
+			return nil, nil, prefix(token, err)
+		}
+		v[n] = child
+		return v, value, nil
+	}
+	return nil, nil, fmt.Errorf("/%s: %s is not a container", token, describe(object))
+}
+
+// index parses a list index no greater than last
+func index(token string, last int) (int, error) {
+	n, err := strconv.Atoi(token)
+	if err != nil || n < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%q is not a list index", token)
+	}
+	if n > last {
+		return 0, fmt.Errorf("index %d is out of range", n)
+	}
+	return n, nil
+}
+
+func prefix(token string, err error) error {
+	return fmt.Errorf("/%s%s", token, err.Error())
+}
+
+func equal(a, b interface{}) bool {
+	x, errx := json.Marshal(PlainMaps(a))
+	y, erry := json.Marshal(PlainMaps(b))
+	return errx == nil && erry == nil && string(x) == string(y)
+}
+
+func scalarOrJSON(value interface{}) string {
+	text, err := json.Marshal(PlainMaps(value))
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(text)
+}
+
+// copyValue a deep copy, so a patch matching several resources shares
+// nothing between them
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		out := make(yaml.MapSlice, len(v))
+		for i, item := range v {
+			out[i] = yaml.MapItem{Key: item.Key, Value: copyValue(item.Value)}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, x := range v {
+			out[i] = copyValue(x)
+		}
+		return out
+	}
+	return value
+}
+
+// mergeKeys the key identifying the elements of lists merged by key
+// rather than replaced, by field name
+var mergeKeys = map[string][]string{
+	"containers":          {"name"},
+	"initContainers":      {"name"},
+	"ephemeralContainers": {"name"},
+	"env":                 {"name"},
+	"volumes":             {"name"},
+	"imagePullSecrets":    {"name"},
+	"volumeMounts":        {"mountPath"},
+	"volumeDevices":       {"devicePath"},
+	"ports":               {"containerPort", "port"},
+	"hostAliases":         {"ip"},
+}
+
+// mergeValue merges patch into original the way a strategic merge
+// patch does: mappings merge key by key, a null deletes its key, lists
+// of mergeKeys fields merge element by element and other values replace
+func mergeValue(original, patch interface{}, field string) interface{} {
+	switch p := patch.(type) {
+	case yaml.MapSlice:
+		o, ok := original.(yaml.MapSlice)
+		directive := GetString(p, "$patch")
+		if !ok || directive == "replace" {
+			return strip(p)
+		}
+		if directive == "delete" {
+			return nil
+		}
+		o = copyValue(o).(yaml.MapSlice)
+		for _, item := range p {
+			key := fmt.Sprint(item.Key)
+			switch {
+			case strings.HasPrefix(key, "$"):
+			case item.Value == nil:
+				o = Delete(o, key)
+			default:
+				merged := mergeValue(Get(o, key), item.Value, key)
+				if merged == nil {
+					o = Delete(o, key)
+				} else {
+					o = Set(o, merged, key)
+				}
+			}
+		}
+		return o
+	case []interface{}:
+		o, ok := original.([]interface{})
+		key := listKey(field, p)
+		if !ok || len(key) == 0 {
+			return strip(p)
+		}
+		o = copyValue(o).([]interface{})
+		for _, element := range p {
+			value := GetString(element, key)
+			n := -1
+			for i, existing := range o {
+				if len(value) > 0 && GetString(existing, key) == value {
+					n = i
+					break
+				}
+			}
+			switch {
+			case GetString(element, "$patch") == "delete":
+				if n >= 0 {
+					o = append(o[:n:n], o[n+1:]...)
+				}
+			case n >= 0:
+				o[n] = mergeValue(o[n], element, "")
+			default:
+				o = append(o, strip(element))
+			}
+		}
+		return o
+	}
+	return patch
+}
+
+// listKey the merge key of a list field, when every patch element is a
+// mapping holding it
+func listKey(field string, patch []interface{}) string {
+	for _, key := range mergeKeys[field] {
+		found := len(patch) > 0
+		for _, element := range patch {
+			if len(GetString(element, key)) == 0 && GetString(element, "$patch") != "delete" {
+				found = false
+				break
+			}
+		}
+		if found {
+			return key
+		}
+	}
+	return ""
+}
+
+// strip a copy of value without $ directives
+func strip(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		var out yaml.MapSlice
+		for _, item := range v {
+			if key := fmt.Sprint(item.Key); !strings.HasPrefix(key, "$") {
+				out = append(out, yaml.MapItem{Key: item.Key, Value: strip(item.Value)})
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, x := range v {
+			out = append(out, strip(x))
+		}
+		return out
+	}
+	return value
+}
@@ -0,0 +1,232 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+const patchDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels: {tier: front}
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:1
+        env:
+        - {name: A, value: "1"}
+        - {name: B, value: "2"}
+        ports:
+        - {containerPort: 80}
+      - name: debug
+        image: busybox
+      volumes:
+      - name: data
+        emptyDir: {}
+`
+
+func TestApplyPatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  []string
+	}{
+		{"json 6902 replace and add", `
+target: {kind: Deployment, name: web}
+patch:
+- {op: replace, path: /spec/replicas, value: 3}
+- {op: add, path: /metadata/annotations, value: {a/b: c}}
+- {op: add, path: /spec/template/spec/containers/0/env/-, value: {name: C, value: "3"}}
+- {op: add, path: /spec/template/spec/containers/0/env/0, value: {name: Z, value: "0"}}
+`, []string{"replicas: 3", "annotations:\n    a/b: c", "env:\n        - name: Z\n          value: \"0\"\n        - name: A", "- name: C\n          value: \"3\"\n        ports"}},
+		{"json 6902 remove, move, copy and test", `
+target: {kind: Deployment}
+patch:
+- {op: test, path: /spec/template/spec/containers/1/name, value: debug}
+- {op: remove, path: /spec/template/spec/containers/1}
+- {op: copy, from: /metadata/labels, path: /spec/template/metadata}
+- {op: move, from: /spec/replicas, path: /spec/minReadySeconds}
+`, []string{"minReadySeconds: 1", "    metadata:\n      tier: front\n  minReadySeconds: 1\n", "!name: debug", "!replicas"}},
+		{"json pointer escapes", `
+target: {kind: Deployment}
+patch:
+- {op: add, path: /metadata/labels/app.kubernetes.io~1name, value: web}
+- {op: add, path: /metadata/labels/a~0b, value: x}
+`, []string{"app.kubernetes.io/name: web", "a~b: x"}},
+		{"block string patch", `
+target: {kind: Deployment}
+patch: |
+  - op: replace
+    path: /spec/replicas
+    value: 5
+`, []string{"replicas: 5"}},
+		{"strategic merge by merge keys", `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web}
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:2
+        env:
+        - {name: B, value: "20"}
+        - {name: D, value: "4"}
+        ports:
+        - {containerPort: 80, protocol: TCP}
+      volumes:
+      - name: cache
+        emptyDir: {}
+`, []string{"image: web:2", "- name: A\n          value: \"1\"\n        - name: B\n          value: \"20\"\n        - name: D", "protocol: TCP", "image: busybox", "- name: data", "- name: cache"}},
+		{"strategic merge directives and null", `
+target: {kind: Deployment}
+patch:
+  metadata:
+    labels: null
+  spec:
+    template:
+      spec:
+        containers:
+        - name: debug
+          $patch: delete
+        - name: web
+          env:
+          - {name: A, $patch: delete}
+        volumes:
+        - name: data
+          $patch: replace
+          hostPath: {path: /data}
+`, []string{"!labels", "!debug", "!name: A", "- name: B", "hostPath:\n          path: /data", "!emptyDir: {}"}},
+		{"replace directive on a mapping", `
+target: {kind: Deployment}
+patch:
+  spec:
+    template:
+      $patch: replace
+      spec:
+        containers: [{name: only}]
+`, []string{"containers:\n      - name: only\n", "!image"}},
+		{"list without a merge key replaced", `
+target: {kind: Deployment}
+patch:
+  spec:
+    template:
+      spec:
+        containers:
+        - name: web
+          args: [b]
+`, []string{"args:\n        - b", "image: web:1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patches, err := ParsePatches("patch.yaml", test.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			documents := parse(t, patchDeployment)
+			if err = ApplyPatches(documents, patches); err != nil {
+				t.Fatal(err)
+			}
+			got := encode(t, documents)
+			for _, want := range test.want {
+				if strings.HasPrefix(want, "!") {
+					if strings.Contains(got, want[1:]) {
+						t.Errorf("patched resource holds %q\n%s", want[1:], got)
+					}
+				} else if !strings.Contains(got, want) {
+					t.Errorf("patched resource without %q\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPatchErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{"no target", "patch: []\n", "patch.yaml:1: a patch needs a target:"},
+		{"unknown op", "target: {kind: Deployment}\npatch:\n- {op: merge, path: /a}\n", `operation 1: unknown op "merge"`},
+		{"missing value", "target: {kind: Deployment}\npatch:\n- {op: add, path: /a}\n", "operation 1: add needs a value"},
+		{"bad pointer", "target: {kind: Deployment}\npatch:\n- {op: remove, path: a}\n", `path "a" is not a json pointer`},
+		{"bad selector", "target: {labelSelector: \"tier in (a)\"}\npatch: {}\n", "unsupported term"},
+		{"scalar patch", "target: {kind: Deployment}\npatch: 3\n", "expected a json 6902 sequence or a strategic merge mapping"},
+		{"no match", "target: {kind: StatefulSet}\npatch: {}\n", "patch.yaml:1: patch of kind=StatefulSet: matches no resource"},
+		{"failed test", "---\ntarget: {kind: Deployment}\npatch:\n- {op: test, path: /spec/replicas, value: 2}\n",
+			"patch.yaml:2: patch of kind=Deployment: document 1 (apps/v1/Deployment web): operation 1, test /spec/replicas: test failed, found 1"},
+		{"missing path", "target: {kind: Deployment}\npatch:\n- {op: replace, path: /spec/paused, value: true}\n", "replace /spec/paused: /spec/paused does not exist"},
+		{"index out of range", "target: {kind: Deployment}\npatch:\n- {op: remove, path: /spec/template/spec/containers/2}\n",
+			"/spec/template/spec/containers/2: index 2 is out of range"},
+		{"leading zero index", "target: {kind: Deployment}\npatch:\n- {op: remove, path: /spec/template/spec/containers/01}\n", `"01" is not a list index`},
+		{"move into itself", "target: {kind: Deployment}\npatch:\n- {op: move, from: /spec, path: /spec/x}\n", "cannot move /spec into itself"},
+		{"not a container", "target: {kind: Deployment}\npatch:\n- {op: add, path: /spec/replicas/x, value: 1}\n", "/spec/replicas/x: int is not a container"},
+		{"delete the resource", "target: {kind: Deployment}\npatch: {$patch: delete}\n", "a patch cannot delete the resource"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patches, err := ParsePatches("patch.yaml", test.patch)
+			if err == nil {
+				err = ApplyPatches(parse(t, patchDeployment), patches)
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestPatchMatches(t *testing.T) {
+	documents := parse(t, "apiVersion: apps/v1\nkind: Deployment\nmetadata: {name: web-a, namespace: prod, labels: {tier: front, canary: \"true\"}}\n---\n"+
+		"apiVersion: apps/v1\nkind: Deployment\nmetadata: {name: web-b, namespace: dev, labels: {tier: front}}\n---\n"+
+		"apiVersion: v1\nkind: Service\nmetadata: {name: web-a, namespace: prod}\n---\n"+
+		"apiVersion: extensions/v1beta1\nkind: Deployment\nmetadata: {name: old}\n")
+	tests := []struct {
+		target Target
+		want   string
+	}{
+		{Target{}, "web-a web-b web-a old"},
+		{Target{Kind: "Deployment"}, "web-a web-b old"},
+		{Target{Group: "apps"}, "web-a web-b"},
+		{Target{Version: "v1beta1"}, "old"},
+		{Target{Group: "", Version: "v1", Kind: "Service"}, "web-a"},
+		{Target{Name: "web-*"}, "web-a web-b web-a"},
+		{Target{Name: "web-?", Namespace: "dev"}, "web-b"},
+		{Target{LabelSelector: "tier=front"}, "web-a web-b"},
+		{Target{LabelSelector: "tier==front,!canary"}, "web-b"},
+		{Target{LabelSelector: "canary"}, "web-a"},
+		{Target{LabelSelector: "tier!=front"}, "web-a old"},
+	}
+	for _, test := range tests {
+		patch := &Patch{Target: test.target}
+		var names []string
+		for _, document := range documents {
+			if patch.Matches(document) {
+				names = append(names, document.Name())
+			}
+		}
+		if got := strings.Join(names, " "); got != test.want {
+			t.Errorf("%+v matches %s, want %s", test.target, got, test.want)
+		}
+	}
+}
+
+func TestParsePatchesSequence(t *testing.T) {
+	patches, err := ParsePatches("p.yaml", "- target: {kind: A}\n  patch: {x: 1}\n- target: {apiVersion: apps/v1}\n  patch: [{op: remove, path: /x}]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 2 || patches[0].Merge == nil || len(patches[1].Operations) != 1 ||
+		patches[1].Target.Group != "apps" || patches[1].Target.Version != "v1" {
+		t.Errorf("ParsePatches = %+v", patches)
+	}
+	if got := patches[1].String(); got != "p.yaml:1: patch of group=apps version=v1" {
+		t.Errorf("String = %s", got)
+	}
+}
@@ -0,0 +1,179 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// SecretKey the characters allowed in Secret and ConfigMap keys
+var SecretKey = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// secretTypeKeys the keys a Secret of a type must hold
+var secretTypeKeys = map[string][]string{
+	"Opaque":                              nil,
+	"kubernetes.io/tls":                   {"tls.crt", "tls.key"},
+	"kubernetes.io/dockerconfigjson":      {".dockerconfigjson"},
+	"kubernetes.io/dockercfg":             {".dockercfg"},
+	"kubernetes.io/basic-auth":            nil,
+	"kubernetes.io/ssh-auth":              {"ssh-privatekey"},
+	"kubernetes.io/service-account-token": nil,
+	"bootstrap.kubernetes.io/token":       {"token-id", "token-secret"},
+}
+
+// SecretValue one key of a Secret, an Encoded value is already base64
+type SecretValue struct {
+	Key     string
+	Value   string
+	Encoded bool
+}
+
+// NewSecret builds a Secret document. Encoded values and values that
+// are not plain text go under data, base64 encoded; text values go
+// under stringData when stringData is set.
+func NewSecret(name, namespace, secretType string, values []SecretValue, stringData bool) (*Document, error) {
+	required, known := secretTypeKeys[secretType]
+	if !known && !strings.Contains(secretType, "/") {
+		return nil, fmt.Errorf("secret %s: unknown type %s", name, secretType)
+	}
+	if len(name) == 0 {
+		return nil, fmt.Errorf("secret: a name is required")
+	}
+
+	var data, text yaml.MapSlice
+	present := make(map[string]bool)
+	for _, value := range values {
+		if !SecretKey.MatchString(value.Key) {
+			return nil, fmt.Errorf("secret %s: key %q may only hold alphanumerics, -, _ and .", name, value.Key)
+		}
+		if present[value.Key] {
+			return nil, fmt.Errorf("secret %s: key %s is given twice", name, value.Key)
+		}
+		present[value.Key] = true
+
+		plain := value.Value
+		if value.Encoded {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value.Value))
+			if err != nil {
+				return nil, fmt.Errorf("secret %s: key %s is not valid base64: %v", name, value.Key, err)
+			}
+			plain = string(decoded)
+		}
+		if value.Key == ".dockerconfigjson" && !json.Valid([]byte(plain)) {
+			return nil, fmt.Errorf("secret %s: key .dockerconfigjson is not json", name)
+		}
+		switch {
+		case value.Encoded:
+			data = append(data, yaml.MapItem{Key: value.Key, Value: strings.TrimSpace(value.Value)})
+		case stringData && IsText(plain):
+			text = append(text, yaml.MapItem{Key: value.Key, Value: plain})
+		default:
+			data = append(data, yaml.MapItem{Key: value.Key, Value: base64.StdEncoding.EncodeToString([]byte(plain))})
+		}
+	}
+	for _, key := range required {
+		if !present[key] {
+			return nil, fmt.Errorf("secret %s: type %s requires key %s", name, secretType, key)
+		}
+	}
+
+	metadata := yaml.MapSlice{{Key: "name", Value: name}}
+	if len(namespace) > 0 {
+		metadata = append(metadata, yaml.MapItem{Key: "namespace", Value: namespace})
+	}
+	document := &Document{Object: yaml.MapSlice{
+		{Key: "apiVersion", Value: "v1"},
+		{Key: "kind", Value: "Secret"},
+		{Key: "metadata", Value: metadata},
+		{Key: "type", Value: secretType},
+	}}
+	if len(data) > 0 {
+		document.Object = append(document.Object, yaml.MapItem{Key: "data", Value: data})
+	}
+	if len(text) > 0 {
+		document.Object = append(document.Object, yaml.MapItem{Key: "stringData", Value: text})
+	}
+	return document, document.Encode()
+}
+
+// IsText reports if value is utf-8 without control characters other
+// than white space, so it survives as a yaml string
+func IsText(value string) bool {
+	if !utf8.ValidString(value) {
+		return false
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// DockerAuth one registry credential of a .dockerconfigjson, in the
+// field order kubectl writes
+type DockerAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// DockerConfig the .dockerconfigjson payload
+type DockerConfig struct {
+	Auths map[string]DockerAuth `json:"auths"`
+}
+
+// String the compact json, without html escapes in passwords
+func (config DockerConfig) String() string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(config)
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// DockerConfigJson the .dockerconfigjson payload of a kubernetes.io/dockerconfigjson
+// secret for one registry, email is optional
+// .dockerconfigjson: {{ dockerConfigJson "registry:5000" .User .Password | base64Encode }}
+func DockerConfigJson(registry, username, password string, email ...string) (string, error) {
+	if len(registry) == 0 {
+		return "", fmt.Errorf("dockerConfigJson: a registry is required")
+	}
+	if len(email) > 1 {
+		return "", fmt.Errorf("dockerConfigJson: expected registry, username, password and an optional email")
+	}
+	auth := DockerAuth{
+		Username: username,
+		Password: password,
+		Auth:     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+	}
+	if len(email) == 1 {
+		auth.Email = email[0]
+	}
+	return DockerConfig{Auths: map[string]DockerAuth{registry: auth}}.String(), nil
+}
+
+// DockerConfigJsonMerge merges .dockerconfigjson payloads into one, a
+// registry in a later payload replaces the same registry in an earlier
+// {{ dockerConfigJsonMerge (dockerConfigJson "a.io" .U .P) (dockerConfigJson "b.io" .U .P) }}
+func DockerConfigJsonMerge(configs ...string) (string, error) {
+	merged := DockerConfig{Auths: make(map[string]DockerAuth)}
+	for _, text := range configs {
+		var config DockerConfig
+		if err := json.Unmarshal([]byte(text), &config); err != nil {
+			return "", fmt.Errorf("dockerConfigJsonMerge: %v", err)
+		}
+		for registry, auth := range config.Auths {
+			merged.Auths[registry] = auth
+		}
+	}
+	return merged.String(), nil
+}
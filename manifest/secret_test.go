@@ -0,0 +1,201 @@
+package manifest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewSecret(t *testing.T) {
+	binary := string([]byte{0x00, 0xff, 0x10, 'a'})
+	tests := []struct {
+		name       string
+		secretType string
+		values     []SecretValue
+		stringData bool
+		want       string
+	}{
+		{"text and binary split", "Opaque", []SecretValue{{Key: "user", Value: "admin"}, {Key: "blob", Value: binary},
+			{Key: "motd", Value: "line 1\n\tline 2\r\n"}}, true,
+			"data:\n  blob: AP8QYQ==\nstringData:\n  user: admin\n  motd: \"line 1\\n\\tline 2\\r\\n\"\n"},
+		{"everything under data without stringData", "Opaque", []SecretValue{{Key: "user", Value: "admin"}, {Key: "blob", Value: binary}}, false,
+			"data:\n  user: YWRtaW4=\n  blob: AP8QYQ==\n"},
+		{"encoded values stay under data", "Opaque", []SecretValue{{Key: "user", Value: " YWRtaW4=\n", Encoded: true}}, true,
+			"data:\n  user: YWRtaW4=\n"},
+		{"empty values", "Opaque", []SecretValue{{Key: "a", Value: ""}, {Key: "b", Value: "", Encoded: true}}, true,
+			"data:\n  b: \"\"\nstringData:\n  a: \"\"\n"},
+		{"empty value without stringData", "Opaque", []SecretValue{{Key: "a", Value: ""}}, false,
+			"data:\n  a: \"\"\n"},
+		{"no values", "Opaque", nil, true, "type: Opaque\n"},
+		{"typed", "kubernetes.io/tls", []SecretValue{{Key: "tls.crt", Value: "c"}, {Key: "tls.key", Value: "k"}}, false,
+			"type: kubernetes.io/tls\ndata:\n  tls.crt: Yw==\n  tls.key: aw==\n"},
+		{"custom type", "example.com/token", []SecretValue{{Key: "t", Value: "x"}}, true,
+			"type: example.com/token\nstringData:\n  t: x\n"},
+	}
+	for _, test := range tests {
+		document, err := NewSecret("s", "team", test.secretType, test.values, test.stringData)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !strings.HasPrefix(document.Text, "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\n  namespace: team\ntype: ") ||
+			!strings.HasSuffix(document.Text, test.want) {
+			t.Errorf("%s: NewSecret =\n%s\nwant it to end with\n%s", test.name, document.Text, test.want)
+		}
+	}
+}
+
+// values round trip through the data a Secret holds
+func TestNewSecretRoundTrip(t *testing.T) {
+	values := []string{"", "admin", "p@ss:word\n", string([]byte{0, 1, 2, 0xfe, 0xff}), "ünïcode ✓", strings.Repeat("x", 1000)}
+	for _, stringData := range []bool{true, false} {
+		var secretValues []SecretValue
+		for i, value := range values {
+			secretValues = append(secretValues, SecretValue{Key: string(rune('a' + i)), Value: value})
+		}
+		secretValues = append(secretValues, SecretValue{Key: "encoded", Value: base64.StdEncoding.EncodeToString([]byte(values[3])), Encoded: true})
+		document, err := NewSecret("s", "", "Opaque", secretValues, stringData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		documents := Split(document.Text)
+		if errors := Check(documents); len(errors) > 0 {
+			t.Fatal(errors)
+		}
+		object := documents[0].Object
+		for _, value := range secretValues {
+			var got string
+			if text := Get(object, "stringData", value.Key); text != nil {
+				got = text.(string)
+			} else {
+				decoded, err := base64.StdEncoding.DecodeString(GetString(object, "data", value.Key))
+				if err != nil {
+					t.Fatalf("%s: %v", value.Key, err)
+				}
+				got = string(decoded)
+			}
+			want := value.Value
+			if value.Encoded {
+				want = values[3]
+			}
+			if got != want {
+				t.Errorf("stringData %v: key %s = %q, want %q", stringData, value.Key, got, want)
+			}
+		}
+	}
+}
+
+func TestNewSecretErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		secretType string
+		values     []SecretValue
+		want       string
+	}{
+		{"s", "Bogus", nil, "secret s: unknown type Bogus"},
+		{"", "Opaque", nil, "secret: a name is required"},
+		{"s", "Opaque", []SecretValue{{Key: "a/b", Value: "x"}}, `secret s: key "a/b" may only hold alphanumerics, -, _ and .`},
+		{"s", "Opaque", []SecretValue{{Key: "", Value: "x"}}, `secret s: key "" may only hold alphanumerics, -, _ and .`},
+		{"s", "Opaque", []SecretValue{{Key: "a", Value: "x"}, {Key: "a", Value: "y"}}, "secret s: key a is given twice"},
+		{"s", "Opaque", []SecretValue{{Key: "a", Value: "not base64!", Encoded: true}}, "secret s: key a is not valid base64: illegal base64 data at input byte 3"},
+		{"s", "kubernetes.io/tls", []SecretValue{{Key: "tls.crt", Value: "c"}}, "secret s: type kubernetes.io/tls requires key tls.key"},
+		{"s", "kubernetes.io/dockerconfigjson", []SecretValue{{Key: ".dockerconfigjson", Value: "{"}}, "secret s: key .dockerconfigjson is not json"},
+	}
+	for _, test := range tests {
+		if _, err := NewSecret(test.name, "", test.secretType, test.values, true); err == nil || err.Error() != test.want {
+			t.Errorf("NewSecret(%s, %s) error %v, want %s", test.name, test.secretType, err, test.want)
+		}
+	}
+}
+
+func TestIsText(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"", true},
+		{"plain", true},
+		{"tabs\tand\r\nnewlines\n", true},
+		{"ünïcode ✓", true},
+		{"nul\x00", false},
+		{"bell\a", false},
+		{"escape\x1b[0m", false},
+		{"del\x7f", false},
+		{"c1\u0085", false},
+		{string([]byte{0xff, 0xfe}), false},
+	}
+	for _, test := range tests {
+		if got := IsText(test.value); got != test.want {
+			t.Errorf("IsText(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestDockerConfigJson(t *testing.T) {
+	tests := []struct {
+		registry, username, password string
+		email                        []string
+		want                         string
+	}{
+		{"registry:5000", "user", "pass", nil,
+			`{"auths":{"registry:5000":{"username":"user","password":"pass","auth":"dXNlcjpwYXNz"}}}`},
+		{"r.io", "user", "p<&>ss:word", []string{"ops@example.com"},
+			`{"auths":{"r.io":{"username":"user","password":"p<&>ss:word","email":"ops@example.com","auth":"dXNlcjpwPCY+c3M6d29yZA=="}}}`},
+		{"r.io", "", "", nil, `{"auths":{"r.io":{"auth":"Og=="}}}`},
+	}
+	for _, test := range tests {
+		got, err := DockerConfigJson(test.registry, test.username, test.password, test.email...)
+		if err != nil || got != test.want {
+			t.Errorf("DockerConfigJson(%s, %s, %s) = %s, %v, want %s", test.registry, test.username, test.password, got, err, test.want)
+			continue
+		}
+		var config DockerConfig
+		if err = json.Unmarshal([]byte(got), &config); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(config.Auths[test.registry].Auth)
+		if err != nil || string(decoded) != test.username+":"+test.password {
+			t.Errorf("auth decodes to %q, %v", decoded, err)
+		}
+	}
+	if _, err := DockerConfigJson("", "u", "p"); err == nil || err.Error() != "dockerConfigJson: a registry is required" {
+		t.Errorf("DockerConfigJson without a registry error %v", err)
+	}
+	if _, err := DockerConfigJson("r.io", "u", "p", "a@b", "c@d"); err == nil {
+		t.Error("DockerConfigJson accepted two emails")
+	}
+}
+
+func TestDockerConfigJsonMerge(t *testing.T) {
+	a, _ := DockerConfigJson("a.io", "ua", "pa")
+	b, _ := DockerConfigJson("b.io", "ub", "pb")
+	b2, _ := DockerConfigJson("b.io", "ub2", "pb2", "b@b.io")
+	tests := []struct {
+		name    string
+		configs []string
+		want    string
+	}{
+		{"none", nil, `{"auths":{}}`},
+		{"one", []string{a}, a},
+		{"two registries", []string{b, a},
+			`{"auths":{"a.io":{"username":"ua","password":"pa","auth":"dWE6cGE="},"b.io":{"username":"ub","password":"pb","auth":"dWI6cGI="}}}`},
+		{"a later duplicate registry replaces the earlier", []string{a, b, b2},
+			`{"auths":{"a.io":{"username":"ua","password":"pa","auth":"dWE6cGE="},"b.io":{"username":"ub2","password":"pb2","email":"b@b.io","auth":"dWIyOnBiMg=="}}}`},
+		{"merged payloads merge again", []string{`{"auths":{"a.io":{"auth":"eDp5"}}}`, a}, a},
+	}
+	for _, test := range tests {
+		got, err := DockerConfigJsonMerge(test.configs...)
+		if err != nil || got != test.want {
+			t.Errorf("%s: DockerConfigJsonMerge = %s, %v, want %s", test.name, got, err, test.want)
+		}
+	}
+	if _, err := DockerConfigJsonMerge(a, "{"); err == nil || !strings.HasPrefix(err.Error(), "dockerConfigJsonMerge: ") {
+		t.Errorf("DockerConfigJsonMerge of bad json error %v", err)
+	}
+	// the merged payload is a valid dockerconfigjson Secret key
+	merged, _ := DockerConfigJsonMerge(a, b)
+	if _, err := NewSecret("pull", "", "kubernetes.io/dockerconfigjson", []SecretValue{{Key: ".dockerconfigjson", Value: merged}}, false); err != nil {
+		t.Error(err)
+	}
+}
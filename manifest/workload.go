@@ -0,0 +1,102 @@
+package manifest
+
+import (
+	yaml "gopkg.in/yaml.v2"
+)
+
+// podSpecPaths where each workload kind keeps its pod spec
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"PodTemplate":           {"template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// IsWorkload reports if the resource holds a pod spec
+func (document *Document) IsWorkload() bool {
+	_, ok := podSpecPaths[document.Kind()]
+	return ok
+}
+
+// PodSpec of a workload, nil for other kinds
+func (document *Document) PodSpec() yaml.MapSlice {
+	path, ok := podSpecPaths[document.Kind()]
+	if !ok {
+		return nil
+	}
+	return GetMap(document.Object, path...)
+}
+
+// PodTemplatePath the path of the pod template metadata holder, the
+// object whose metadata labels the pods, nil for a bare Pod
+func (document *Document) PodTemplatePath() []string {
+	path, ok := podSpecPaths[document.Kind()]
+	if !ok || len(path) < 2 {
+		return nil
+	}
+	return append([]string(nil), path[:len(path)-1]...)
+}
+
+// Reference from a pod spec to a ConfigMap or Secret
+type Reference struct {
+	// Kind ConfigMap or Secret
+	Kind string
+	Name string
+	// holder the mapping holding the name under key
+	holder yaml.MapSlice
+	key    string
+}
+
+// Rename the referenced object in the pod spec
+func (reference *Reference) Rename(name string) {
+	for i := range reference.holder {
+		if reference.holder[i].Key == reference.key {
+			reference.holder[i].Value = name
+		}
+	}
+	reference.Name = name
+}
+
+// References from the pod spec of a workload to ConfigMaps and
+// Secrets: volumes, projected volumes, env, envFrom and image pull
+// secrets
+func (document *Document) References() (references []*Reference) {
+	spec := document.PodSpec()
+	if spec == nil {
+		return nil
+	}
+	add := func(kind string, holder yaml.MapSlice, key string) {
+		if name := GetString(holder, key); len(name) > 0 {
+			references = append(references, &Reference{Kind: kind, Name: name, holder: holder, key: key})
+		}
+	}
+	for _, volume := range GetList(spec, "volumes") {
+		add("ConfigMap", GetMap(volume, "configMap"), "name")
+		add("Secret", GetMap(volume, "secret"), "secretName")
+		for _, source := range GetList(volume, "projected", "sources") {
+			add("ConfigMap", GetMap(source, "configMap"), "name")
+			add("Secret", GetMap(source, "secret"), "name")
+		}
+	}
+	for _, group := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		for _, container := range GetList(spec, group) {
+			for _, env := range GetList(container, "env") {
+				add("ConfigMap", GetMap(env, "valueFrom", "configMapKeyRef"), "name")
+				add("Secret", GetMap(env, "valueFrom", "secretKeyRef"), "name")
+			}
+			for _, from := range GetList(container, "envFrom") {
+				add("ConfigMap", GetMap(from, "configMapRef"), "name")
+				add("Secret", GetMap(from, "secretRef"), "name")
+			}
+		}
+	}
+	for _, secret := range GetList(spec, "imagePullSecrets") {
+		add("Secret", GetMap(secret), "name")
+	}
+	return
+}
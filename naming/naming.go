@@ -0,0 +1,106 @@
+/*
+naming:
+
+Sanitize text into valid kubernetes object names and label values.
+
+Names too long for their field are truncated and suffixed with a short
+hash of the full text, so two long names sharing a prefix stay
+distinct and the same input always yields the same name.
+*/
+
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Field length limits
+const (
+	DNSLabelMax     = 63
+	DNSSubdomainMax = 253
+	LabelValueMax   = 63
+	hashLength      = 8
+)
+
+// Truncate text to at most n characters; a truncated text ends in - and
+// a hash of the whole text
+func Truncate(n int, text string) string {
+	if len(text) <= n {
+		return text
+	}
+	sum := sha256.Sum256([]byte(text))
+	hash := hex.EncodeToString(sum[:])[:hashLength]
+	if n <= hashLength {
+		return hash[:n]
+	}
+	prefix := strings.TrimRight(text[:n-hashLength-1], "-._")
+	if len(prefix) == 0 {
+		return hash
+	}
+	return prefix + "-" + hash
+}
+
+// DNSLabel rfc 1123 label: lower case alphanumerics and -, starting
+// and ending alphanumeric, at most 63 characters
+func DNSLabel(text string) string {
+	return Truncate(DNSLabelMax, sanitize(strings.ToLower(text), isLabelChar, '-', "-"))
+}
+
+// DNSSubdomain rfc 1123 subdomain: dot separated labels, at most 253
+// characters
+func DNSSubdomain(text string) string {
+	text = sanitize(strings.ToLower(text), func(c byte) bool { return c == '.' || isLabelChar(c) }, '-', "-.")
+	var labels []string
+	for _, label := range strings.Split(text, ".") {
+		if label = strings.Trim(label, "-"); len(label) > 0 {
+			labels = append(labels, Truncate(DNSLabelMax, label))
+		}
+	}
+	text = Truncate(DNSSubdomainMax, strings.Join(labels, "."))
+	// the hash suffix of a truncated subdomain lengthens its last label
+	labels = strings.Split(text, ".")
+	labels[len(labels)-1] = Truncate(DNSLabelMax, labels[len(labels)-1])
+	return strings.Join(labels, ".")
+}
+
+// LabelValue at most 63 alphanumerics, -, _ or ., starting and ending
+// alphanumeric, or empty
+func LabelValue(text string) string {
+	return Truncate(LabelValueMax, sanitize(text, isLabelValueChar, '_', "-_."))
+}
+
+// ServiceFQDN the cluster dns name of a service
+func ServiceFQDN(name, namespace, clusterDomain string) string {
+	return name + "." + namespace + ".svc." + strings.Trim(clusterDomain, ".")
+}
+
+// sanitize replaces characters failing valid with replacement,
+// collapses runs of replacements and trims trim from both ends
+func sanitize(text string, valid func(byte) bool, replacement byte, trim string) string {
+	out := make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if !valid(c) {
+			c = replacement
+		}
+		if c == replacement && len(out) > 0 && out[len(out)-1] == replacement {
+			continue
+		}
+		out = append(out, c)
+	}
+	return strings.Trim(string(out), trim)
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+}
+
+func isLabelChar(c byte) bool {
+	return isAlphanumeric(c) || c == '-'
+}
+
+func isLabelValueChar(c byte) bool {
+	return isAlphanumeric(c) || (c >= 'A' && c <= 'Z') || c == '-' || c == '_' || c == '.'
+}
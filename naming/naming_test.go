@@ -0,0 +1,141 @@
+package naming
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	dnsLabel     = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	dnsSubdomain = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	labelValue   = regexp.MustCompile(`^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$`)
+)
+
+func TestDNSLabel(t *testing.T) {
+	long := strings.Repeat("a", 70)
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"web", "web"},
+		{"My_App.Service", "my-app-service"},
+		{"--web--", "web"},
+		{"a   b", "a-b"},
+		{"Über Service!", "ber-service"},
+		{strings.Repeat("x", 63), strings.Repeat("x", 63)},
+		{long, ""},
+		{long + "b", ""},
+		{strings.Repeat("a-", 40), ""},
+	}
+	seen := make(map[string]string)
+	for _, test := range tests {
+		got := DNSLabel(test.text)
+		if len(test.want) > 0 && got != test.want {
+			t.Errorf("DNSLabel(%q) = %q, want %q", test.text, got, test.want)
+		}
+		if !dnsLabel.MatchString(got) || len(got) > DNSLabelMax {
+			t.Errorf("DNSLabel(%q) = %q is not a dns label", test.text, got)
+		}
+		if DNSLabel(test.text) != got {
+			t.Errorf("DNSLabel(%q) is not stable", test.text)
+		}
+		if other, ok := seen[got]; ok && len(test.text) > DNSLabelMax {
+			t.Errorf("DNSLabel(%q) and DNSLabel(%q) are both %q", test.text, other, got)
+		}
+		seen[got] = test.text
+	}
+	if got := DNSLabel(long); len(got) != DNSLabelMax || !strings.HasPrefix(got, strings.Repeat("a", 54)+"-") {
+		t.Errorf("DNSLabel of 70 characters = %q, want 54 characters, - and a hash", got)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		n    int
+		text string
+		len  int
+	}{
+		{10, "short", 5},
+		{10, "exactly-10", 10},
+		{10, "longer-than-ten", 10},
+		{8, "longer-than-eight", 8},
+		{4, "longer-than-four", 4},
+		{12, "ab--------------", 11},
+	}
+	for _, test := range tests {
+		got := Truncate(test.n, test.text)
+		if len(got) != test.len {
+			t.Errorf("Truncate(%d, %q) = %q, want length %d", test.n, test.text, got, test.len)
+		}
+		if strings.HasSuffix(got, "-") || strings.Contains(got, "--") && len(test.text) > test.n {
+			t.Errorf("Truncate(%d, %q) = %q", test.n, test.text, got)
+		}
+	}
+}
+
+func TestDNSSubdomain(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"Web.Example.COM", "web.example.com"},
+		{"a..b", "a.b"},
+		{".-a-.b.", "a.b"},
+		{"my_app.svc", "my-app.svc"},
+		{strings.Repeat("a", 70) + ".com", ""},
+		{strings.Repeat(strings.Repeat("b", 60)+".", 5), ""},
+	}
+	for _, test := range tests {
+		got := DNSSubdomain(test.text)
+		if len(test.want) > 0 && got != test.want {
+			t.Errorf("DNSSubdomain(%q) = %q, want %q", test.text, got, test.want)
+		}
+		if !dnsSubdomain.MatchString(got) || len(got) > DNSSubdomainMax {
+			t.Errorf("DNSSubdomain(%q) = %q is not a dns subdomain", test.text, got)
+		}
+		for _, label := range strings.Split(got, ".") {
+			if len(label) > DNSLabelMax {
+				t.Errorf("DNSSubdomain(%q) holds label %q over %d characters", test.text, label, DNSLabelMax)
+			}
+		}
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"v1.2.3", "v1.2.3"},
+		{"My App", "My_App"},
+		{"-_.x._-", "x"},
+		{"a/b:c", "a_b_c"},
+		{strings.Repeat("Z", 80), ""},
+	}
+	for _, test := range tests {
+		got := LabelValue(test.text)
+		if len(test.want) > 0 && got != test.want || len(test.text) == 0 && len(got) > 0 {
+			t.Errorf("LabelValue(%q) = %q, want %q", test.text, got, test.want)
+		}
+		if !labelValue.MatchString(got) || len(got) > LabelValueMax {
+			t.Errorf("LabelValue(%q) = %q is not a label value", test.text, got)
+		}
+	}
+}
+
+func TestServiceFQDN(t *testing.T) {
+	tests := []struct {
+		name, namespace, domain, want string
+	}{
+		{"web", "prod", "cluster.local", "web.prod.svc.cluster.local"},
+		{"web", "prod", ".cluster.local.", "web.prod.svc.cluster.local"},
+	}
+	for _, test := range tests {
+		if got := ServiceFQDN(test.name, test.namespace, test.domain); got != test.want {
+			t.Errorf("ServiceFQDN = %q, want %q", got, test.want)
+		}
+	}
+}
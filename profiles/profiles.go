@@ -0,0 +1,184 @@
+/*
+profiles:
+
+Select mapping values per environment. A profile names values for
+mappings and may extend another profile, every chain ending in the
+default profile whose values are the plain mapping values.
+
+	profiles:
+	  test:
+	    values:
+	      Replicas: 1
+	  prod:
+	    extends: test
+	    values:
+	      Replicas: 3
+
+A mapping may also carry its own profile values
+
+	- name: Replicas
+	  value: 1
+	  profiles:
+	    prod: 3
+*/
+
+package profiles
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default the profile every chain ends in
+const Default = "default"
+
+// Profile the values of a profile and the profile it extends
+type Profile struct {
+	Name    string
+	Extends string
+	Values  map[string]interface{}
+}
+
+// Profiles by name
+type Profiles map[string]*Profile
+
+// Parse the profiles: section of a mappings file, decoded from json
+func Parse(section interface{}) (Profiles, error) {
+	profiles := make(Profiles)
+	if section == nil {
+		return profiles, nil
+	}
+	definitions, ok := section.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("profiles: expected a mapping of profile names")
+	}
+	for name, definition := range definitions {
+		p := &Profile{Name: name, Values: make(map[string]interface{})}
+		fields, ok := definition.(map[string]interface{})
+		if !ok && definition != nil {
+			return nil, fmt.Errorf("profiles: %s: expected a mapping holding extends: and values:", name)
+		}
+		for key, value := range fields {
+			switch key {
+			case "extends":
+				if p.Extends, ok = value.(string); !ok {
+					return nil, fmt.Errorf("profiles: %s: extends: expected a profile name", name)
+				}
+			case "values":
+				values, ok := value.(map[string]interface{})
+				if !ok && value != nil {
+					return nil, fmt.Errorf("profiles: %s: values: expected a mapping of mapping names", name)
+				}
+				for k, v := range values {
+					p.Values[k] = v
+				}
+			default:
+				return nil, fmt.Errorf("profiles: %s: unknown field %s, expected extends or values", name, key)
+			}
+		}
+		if name == Default && len(p.Extends) > 0 {
+			return nil, fmt.Errorf("profiles: %s may not extend another profile", Default)
+		}
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+// Chain the profiles name resolves through, name first and Default
+// last; known reports profiles named only by mappings
+func (profiles Profiles) Chain(name string, known map[string]bool) (chain []string, err error) {
+	seen := make(map[string]bool)
+	for {
+		if seen[name] {
+			return nil, fmt.Errorf("profile %s: extends cycle %s -> %s", chain[0], strings.Join(chain, " -> "), name)
+		}
+		seen[name] = true
+		p, defined := profiles[name]
+		if !defined && name != Default && !known[name] {
+			if len(chain) > 0 {
+				return nil, fmt.Errorf("profile %s extends undefined profile %s", chain[len(chain)-1], name)
+			}
+			return nil, fmt.Errorf("profile %s is not defined, defined profiles: %s", name, strings.Join(profiles.names(known), ", "))
+		}
+		chain = append(chain, name)
+		if name == Default {
+			return chain, nil
+		}
+		name = Default
+		if defined && len(p.Extends) > 0 {
+			name = p.Extends
+		}
+	}
+}
+
+// names the defined profiles, sorted
+func (profiles Profiles) names(known map[string]bool) []string {
+	all := make(map[string]bool)
+	for name := range profiles {
+		all[name] = true
+	}
+	for name := range known {
+		all[name] = true
+	}
+	names := []string{Default}
+	for name := range all {
+		if name != Default {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// Select the value of the mapping name for chain: the first profile of
+// the chain setting it, in the mapping's own profiles: or the profiles:
+// section, else the mapping's value; found is false when nothing sets it
+func (profiles Profiles) Select(chain []string, name string, mapping map[string]interface{}) (value string, found bool, err error) {
+	own, _ := mapping["profiles"].(map[string]interface{})
+	for _, p := range chain {
+		if v, ok := own[p]; ok {
+			return scalar(name, p, v)
+		}
+		if profile, ok := profiles[p]; ok {
+			if v, ok := profile.Values[name]; ok {
+				return scalar(name, p, v)
+			}
+		}
+	}
+	if v, ok := mapping["value"]; ok {
+		return scalar(name, "", v)
+	}
+	return "", false, nil
+}
+
+// Names the profiles mappings set values for in their own profiles:
+func Names(mappings []map[string]interface{}) map[string]bool {
+	names := make(map[string]bool)
+	for _, mapping := range mappings {
+		own, _ := mapping["profiles"].(map[string]interface{})
+		for name := range own {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// scalar a json decoded mapping value as text, null is unset
+func scalar(name, p string, value interface{}) (string, bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return v, true, nil
+	case bool:
+		return strconv.FormatBool(v), true, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true, nil
+	}
+	if len(p) > 0 {
+		return "", false, fmt.Errorf("mapping %s: profile %s: expected a scalar value", name, p)
+	}
+	return "", false, fmt.Errorf("mapping %s: expected a scalar value", name)
+}
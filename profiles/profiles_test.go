@@ -0,0 +1,162 @@
+package profiles
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, text string) interface{} {
+	var section interface{}
+	if err := json.Unmarshal([]byte(text), &section); err != nil {
+		t.Fatal(err)
+	}
+	return section
+}
+
+const section = `{
+  "test": {"values": {"Replicas": 1, "Debug": true}},
+  "stage": {"extends": "test", "values": {"Host": "stage.example.com"}},
+  "prod": {"extends": "stage", "values": {"Replicas": 3, "Host": "example.com", "Debug": null}},
+  "dev": null
+}`
+
+func TestParse(t *testing.T) {
+	profiles, err := Parse(decode(t, section))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 4 || profiles["prod"].Extends != "stage" || profiles["test"].Values["Replicas"] != float64(1) || len(profiles["dev"].Values) != 0 {
+		t.Errorf("Parse = %+v", profiles)
+	}
+	if profiles, err = Parse(nil); err != nil || len(profiles) != 0 {
+		t.Errorf("Parse(nil) = %v, %v", profiles, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`["prod"]`, "profiles: expected a mapping of profile names"},
+		{`{"prod": 3}`, "profiles: prod: expected a mapping holding extends: and values:"},
+		{`{"prod": {"extends": 3}}`, "profiles: prod: extends: expected a profile name"},
+		{`{"prod": {"values": [1]}}`, "profiles: prod: values: expected a mapping of mapping names"},
+		{`{"prod": {"value": {}}}`, "profiles: prod: unknown field value, expected extends or values"},
+		{`{"default": {"extends": "prod"}}`, "profiles: default may not extend another profile"},
+	}
+	for _, test := range tests {
+		if _, err := Parse(decode(t, test.text)); err == nil || err.Error() != test.want {
+			t.Errorf("Parse(%s) error %v, want %s", test.text, err, test.want)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	profiles, err := Parse(decode(t, section))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cycle, _ := Parse(decode(t, `{"a": {"extends": "b"}, "b": {"extends": "c"}, "c": {"extends": "a"}, "x": {"extends": "missing"}}`))
+	known := map[string]bool{"qa": true}
+	tests := []struct {
+		profiles Profiles
+		name     string
+		want     string
+		err      string
+	}{
+		{profiles, "prod", "prod stage test default", ""},
+		{profiles, "test", "test default", ""},
+		{profiles, "dev", "dev default", ""},
+		{profiles, "default", "default", ""},
+		{profiles, "qa", "qa default", ""},
+		{profiles, "nope", "", "profile nope is not defined, defined profiles: default, dev, prod, qa, stage, test"},
+		{cycle, "a", "", "profile a: extends cycle a -> b -> c -> a"},
+		{cycle, "x", "", "profile x extends undefined profile missing"},
+	}
+	for _, test := range tests {
+		chain, err := test.profiles.Chain(test.name, known)
+		if len(test.err) > 0 {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Chain(%s) error %v, want %s", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil || strings.Join(chain, " ") != test.want {
+			t.Errorf("Chain(%s) = %v, %v, want %s", test.name, chain, err, test.want)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	profiles, err := Parse(decode(t, section))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappings := decode(t, `{
+  "Replicas": {"value": 2, "profiles": {"stage": 4}},
+  "Host": {"value": "localhost"},
+  "Debug": {"value": false},
+  "Port": {"value": "8080", "profiles": {"prod": 443}},
+  "Ratio": {"value": 0.25},
+  "Unset": {},
+  "List": {"value": [1]},
+  "BadProfile": {"value": 1, "profiles": {"test": {"a": 1}}}
+}`).(map[string]interface{})
+	tests := []struct {
+		profile, name string
+		value         string
+		found         bool
+		err           string
+	}{
+		// the first profile of the chain setting a value wins, its own
+		// profiles: before the profiles: section
+		{"prod", "Replicas", "3", true, ""},
+		{"stage", "Replicas", "4", true, ""},
+		{"test", "Replicas", "1", true, ""},
+		{"default", "Replicas", "2", true, ""},
+		{"dev", "Replicas", "2", true, ""},
+		{"prod", "Host", "example.com", true, ""},
+		{"stage", "Host", "stage.example.com", true, ""},
+		{"test", "Host", "localhost", true, ""},
+		{"prod", "Port", "443", true, ""},
+		{"stage", "Port", "8080", true, ""},
+		{"test", "Debug", "true", true, ""},
+		// null in a profile unsets the value
+		{"prod", "Debug", "", false, ""},
+		{"default", "Debug", "false", true, ""},
+		{"default", "Ratio", "0.25", true, ""},
+		{"prod", "Unset", "", false, ""},
+		{"default", "List", "", false, "mapping List: expected a scalar value"},
+		{"prod", "BadProfile", "", false, "mapping BadProfile: profile test: expected a scalar value"},
+	}
+	for _, test := range tests {
+		chain, err := profiles.Chain(test.profile, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, found, err := profiles.Select(chain, test.name, mappings[test.name].(map[string]interface{}))
+		if len(test.err) > 0 {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Select(%s, %s) error %v, want %s", test.profile, test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil || value != test.value || found != test.found {
+			t.Errorf("Select(%s, %s) = %q, %v, %v, want %q, %v", test.profile, test.name, value, found, err, test.value, test.found)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	mappings := []map[string]interface{}{
+		{"value": 1, "profiles": map[string]interface{}{"qa": 1, "prod": 2}},
+		{"value": 2},
+		{"profiles": map[string]interface{}{"canary": 3}},
+	}
+	names := Names(mappings)
+	if len(names) != 3 || !names["qa"] || !names["prod"] || !names["canary"] {
+		t.Errorf("Names = %v", names)
+	}
+}
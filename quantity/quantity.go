@@ -0,0 +1,210 @@
+/*
+quantity:
+
+Kubernetes resource quantities, 512Mi, 500m, 1e3, with the parsing
+and canonical formatting rules of the api server:
+
+- the suffix style of a quantity, binary (Ki, Mi ...), decimal (m, k,
+  M ...) or exponent (e3), is kept through arithmetic, the left hand
+  side operand decides
+- a binary quantity that is fractional or smaller than 1024 is
+  written in decimal
+- values are rounded up, away from zero, to nano units
+- decimal quantities use the largest suffix, a power of 1000, that
+  leaves an integer: 1500m stays 1500m, 1000m is written 1, 0.5 is
+  written 500m
+*/
+
+package quantity
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Format of the quantity suffix
+type Format string
+
+// Formats
+const (
+	BinarySI        Format = "BinarySI"
+	DecimalSI       Format = "DecimalSI"
+	DecimalExponent Format = "DecimalExponent"
+)
+
+// Quantity a value held in nano units with the format it is written in
+type Quantity struct {
+	nano   *big.Int
+	Format Format
+}
+
+var (
+	nanoPerUnit = big.NewInt(1000000000)
+	decimalSI   = map[string]int{"n": -9, "u": -6, "m": -3, "": 0, "k": 3, "M": 6, "G": 9, "T": 12, "P": 15, "E": 18}
+	binarySI    = map[string]uint{"Ki": 10, "Mi": 20, "Gi": 30, "Ti": 40, "Pi": 50, "Ei": 60}
+	siSuffix    = map[int]string{-9: "n", -6: "u", -3: "m", 0: "", 3: "k", 6: "M", 9: "G", 12: "T", 15: "P", 18: "E"}
+	binSuffix   = []string{"", "Ki", "Mi", "Gi", "Ti", "Pi", "Ei"}
+)
+
+// Parse a quantity, 128974848, 129e6, 129M, 123Mi, 100m
+func Parse(text string) (q Quantity, err error) {
+	text = strings.TrimSpace(text)
+	number, suffix := split(text)
+	if len(strings.Trim(number, "+-.")) == 0 || strings.Count(number, ".") > 1 {
+		return q, fmt.Errorf("quantity %q: expected a number with an optional suffix", text)
+	}
+	if strings.HasSuffix(number, ".") {
+		number += "0"
+	}
+	value, ok := new(big.Rat).SetString(number)
+	if !ok {
+		return q, fmt.Errorf("quantity %q: invalid number %q", text, number)
+	}
+
+	scale := new(big.Rat).SetInt64(1)
+	if shift, ok := binarySI[suffix]; ok {
+		q.Format = BinarySI
+		scale.SetInt(new(big.Int).Lsh(big.NewInt(1), shift))
+	} else if exponent, ok := decimalSI[suffix]; ok {
+		q.Format = DecimalSI
+		scale = pow10(exponent)
+	} else if len(suffix) > 1 && (suffix[0] == 'e' || suffix[0] == 'E') {
+		var exponent int
+		if _, err = fmt.Sscanf(suffix[1:], "%d", &exponent); err != nil || fmt.Sprint(exponent) != strings.TrimPrefix(suffix[1:], "+") {
+			return q, fmt.Errorf("quantity %q: invalid exponent %q", text, suffix)
+		}
+		q.Format = DecimalExponent
+		scale = pow10(exponent)
+	} else {
+		return q, fmt.Errorf("quantity %q: unknown suffix %q", text, suffix)
+	}
+	q.nano = roundUp(value.Mul(value, scale).Mul(value, new(big.Rat).SetInt(nanoPerUnit)))
+	return q, nil
+}
+
+// MustParse panics when text is not a quantity
+func MustParse(text string) Quantity {
+	q, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// split text into the number and the suffix
+func split(text string) (number, suffix string) {
+	i := 0
+	if i < len(text) && (text[i] == '+' || text[i] == '-') {
+		i++
+	}
+	for i < len(text) && (text[i] == '.' || (text[i] >= '0' && text[i] <= '9')) {
+		i++
+	}
+	return text[:i], text[i:]
+}
+
+func pow10(exponent int) *big.Rat {
+	n := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exponent))), nil)
+	if exponent < 0 {
+		return new(big.Rat).SetFrac(big.NewInt(1), n)
+	}
+	return new(big.Rat).SetInt(n)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// roundUp rounds r away from zero to an integer
+func roundUp(r *big.Rat) *big.Int {
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if m.Sign() != 0 {
+		q.Add(q, big.NewInt(int64(m.Sign())))
+	}
+	return q
+}
+
+func (q Quantity) value() *big.Int {
+	if q.nano == nil {
+		return new(big.Int)
+	}
+	return q.nano
+}
+
+// Add returns q + o in the format of q
+func (q Quantity) Add(o Quantity) Quantity {
+	return Quantity{nano: new(big.Int).Add(q.value(), o.value()), Format: q.Format}
+}
+
+// Sub returns q - o in the format of q
+func (q Quantity) Sub(o Quantity) Quantity {
+	return Quantity{nano: new(big.Int).Sub(q.value(), o.value()), Format: q.Format}
+}
+
+// Mul returns q * factor rounded up to nano units in the format of q
+func (q Quantity) Mul(factor *big.Rat) Quantity {
+	r := new(big.Rat).SetInt(q.value())
+	return Quantity{nano: roundUp(r.Mul(r, factor)), Format: q.Format}
+}
+
+// Cmp returns -1, 0 or 1 when q is less than, equal or greater than o
+func (q Quantity) Cmp(o Quantity) int {
+	return q.value().Cmp(o.value())
+}
+
+// Value rounded up to an integer, bytes or cores
+func (q Quantity) Value() int64 {
+	return roundUp(new(big.Rat).SetFrac(q.value(), nanoPerUnit)).Int64()
+}
+
+// MilliValue rounded up to an integer number of thousandths
+func (q Quantity) MilliValue() int64 {
+	return roundUp(new(big.Rat).SetFrac(q.value(), big.NewInt(1000000))).Int64()
+}
+
+// String the canonical form the api server writes
+func (q Quantity) String() string {
+	n := new(big.Int).Set(q.value())
+	if n.Sign() == 0 {
+		return "0"
+	}
+	sign := ""
+	if n.Sign() < 0 {
+		sign = "-"
+		n.Neg(n)
+	}
+
+	format := q.Format
+	if format == BinarySI {
+		units, rest := new(big.Int).QuoRem(n, nanoPerUnit, new(big.Int))
+		if rest.Sign() != 0 || units.Cmp(big.NewInt(1024)) < 0 {
+			format = DecimalSI
+		} else {
+			i := 0
+			k := big.NewInt(1024)
+			for i+1 < len(binSuffix) && new(big.Int).Rem(units, k).Sign() == 0 {
+				units.Quo(units, k)
+				i++
+			}
+			return sign + units.String() + binSuffix[i]
+		}
+	}
+
+	exponent := -9
+	thousand := big.NewInt(1000)
+	for exponent < 18 && new(big.Int).Rem(n, thousand).Sign() == 0 {
+		n.Quo(n, thousand)
+		exponent += 3
+	}
+	if format == DecimalExponent {
+		if exponent == 0 {
+			return sign + n.String()
+		}
+		return fmt.Sprintf("%s%se%d", sign, n.String(), exponent)
+	}
+	return sign + n.String() + siSuffix[exponent]
+}
@@ -0,0 +1,113 @@
+package quantity
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"0", "0"},
+		{"0Mi", "0"},
+		{"512Mi", "512Mi"},
+		{"1024Mi", "1Gi"},
+		{"1536Mi", "1536Mi"},
+		{"1.5Gi", "1536Mi"},
+		{"0.5Ki", "512"},
+		{"1023", "1023"},
+		{"1000m", "1"},
+		{"1500m", "1500m"},
+		{"0.5", "500m"},
+		{"100m", "100m"},
+		{"-100m", "-100m"},
+		{"1.1m", "1100u"},
+		{"0.1n", "1n"},
+		{"-0.1n", "-1n"},
+		{"129M", "129M"},
+		{"129e6", "129e6"},
+		{"1e3", "1e3"},
+		{"1E3", "1e3"},
+		{"100e-3", "100e-3"},
+		{"128974848", "128974848"},
+		{"12000k", "12M"},
+		{"+5", "5"},
+		{"5.", "5"},
+		{" 2Gi ", "2Gi"},
+	}
+	for _, test := range tests {
+		q, err := Parse(test.text)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.text, err)
+			continue
+		}
+		if got := q.String(); got != test.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{"", "Mi", "-", ".", "1..2", "1.2.3", "12Q", "1mi", "1e", "1e3.5", "1e+x", "e3"} {
+		if q, err := Parse(text); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", text, q)
+		}
+	}
+}
+
+func TestValues(t *testing.T) {
+	tests := []struct {
+		text  string
+		value int64
+		milli int64
+	}{
+		{"1", 1, 1000},
+		{"1.5", 2, 1500},
+		{"100m", 1, 100},
+		{"0.1m", 1, 1},
+		{"1Ki", 1024, 1024000},
+		{"-1.5", -2, -1500},
+	}
+	for _, test := range tests {
+		q := MustParse(test.text)
+		if q.Value() != test.value || q.MilliValue() != test.milli {
+			t.Errorf("%s: Value %d MilliValue %d, want %d %d", test.text, q.Value(), q.MilliValue(), test.value, test.milli)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Quantity
+		want string
+	}{
+		{"binary add", MustParse("1Gi").Add(MustParse("512Mi")), "1536Mi"},
+		{"left operand format", MustParse("500m").Add(MustParse("1Ki")), "1024500m"},
+		{"sub", MustParse("1").Sub(MustParse("500m")), "500m"},
+		{"sub below zero", MustParse("100m").Sub(MustParse("1")), "-900m"},
+		{"mul", MustParse("100m").Mul(big.NewRat(3, 2)), "150m"},
+		{"mul rounds up", MustParse("1n").Mul(big.NewRat(1, 3)), "1n"},
+		{"mul binary", MustParse("1Gi").Mul(big.NewRat(1, 2)), "512Mi"},
+	}
+	for _, test := range tests {
+		if got := test.got.String(); got != test.want {
+			t.Errorf("%s = %s, want %s", test.name, got, test.want)
+		}
+	}
+	cmp := []struct {
+		a, b string
+		want int
+	}{
+		{"1Gi", "1024Mi", 0},
+		{"1G", "1Gi", -1},
+		{"1", "999m", 1},
+	}
+	for _, test := range cmp {
+		if got := MustParse(test.a).Cmp(MustParse(test.b)); got != test.want {
+			t.Errorf("Cmp(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+redact:
+
+Mask secret values in diagnostic text. Values registered with Add are
+replaced, wherever they appear, with a fingerprint naming the value
+and a short HMAC-SHA256 of it, so two secrets, or two mentions of one,
+can be told apart without their text.
+
+	[redacted DbPassword hmac:9c1f0e7a]
+
+The HMAC key is the Redactor's, random unless New is given one, so a
+fingerprint cannot be searched for in a dictionary of guessable values
+without the key. Fingerprints are comparable between texts masked by
+Redactors given the same key, and only within one Redactor otherwise.
+*/
+
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MinLength values shorter than this are masked by name in dumps but
+// not searched for in free text, where they would match everywhere
+const MinLength = 4
+
+// KeySize the length of the random HMAC key of New(nil)
+const KeySize = 32
+
+// Redactor the secret values to mask
+type Redactor struct {
+	key      []byte
+	mutex    sync.RWMutex
+	names    map[string]bool
+	values   map[string]string
+	replacer *strings.Replacer
+}
+
+// New an empty Redactor fingerprinting with the HMAC key, a random
+// one when key is empty
+func New(key []byte) *Redactor {
+	if len(key) == 0 {
+		key = make([]byte, KeySize)
+		if _, err := rand.Read(key); err != nil {
+			panic(fmt.Sprintf("redact: reading a random key: %v", err))
+		}
+	}
+	return &Redactor{key: key, names: make(map[string]bool), values: make(map[string]string)}
+}
+
+// Fingerprint the text shown in place of the secret value of name, the
+// first 8 hex digits of its HMAC-SHA256 under the Redactor's key
+func (r *Redactor) Fingerprint(name, value string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(value))
+	return fmt.Sprintf("[redacted %s hmac:%s]", name, hex.EncodeToString(mac.Sum(nil))[:8])
+}
+
+// Add the secret value of name; its base64 encoding and each of its
+// lines are masked too
+func (r *Redactor) Add(name, value string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.names[name] = true
+	forms := []string{value, strings.TrimSpace(value), base64.StdEncoding.EncodeToString([]byte(value))}
+	if strings.Contains(value, "\n") {
+		forms = append(forms, strings.Split(value, "\n")...)
+	}
+	for _, form := range forms {
+		form = strings.TrimRight(form, "\r")
+		if len(strings.TrimSpace(form)) < MinLength {
+			continue
+		}
+		if _, ok := r.values[form]; !ok {
+			r.values[form] = r.Fingerprint(name, value)
+			r.replacer = nil
+		}
+	}
+}
+
+// Secret reports values of name are masked
+func (r *Redactor) Secret(name string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.names[name]
+}
+
+// Value the text shown for the value of name: its fingerprint when
+// name is secret, else value with any secret it holds masked
+func (r *Redactor) Value(name, value string) string {
+	if r.Secret(name) {
+		return r.Fingerprint(name, value)
+	}
+	return r.String(value)
+}
+
+// String text with every secret value masked, longest values first so
+// a value holding another is masked whole
+func (r *Redactor) String(text string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.values) == 0 {
+		return text
+	}
+	if r.replacer == nil {
+		values := make([]string, 0, len(r.values))
+		for value := range r.values {
+			values = append(values, value)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if len(values[i]) != len(values[j]) {
+				return len(values[i]) > len(values[j])
+			}
+			return values[i] < values[j]
+		})
+		pairs := make([]string, 0, 2*len(values))
+		for _, value := range values {
+			pairs = append(pairs, value, r.values[value])
+		}
+		r.replacer = strings.NewReplacer(pairs...)
+	}
+	return r.replacer.Replace(text)
+}
+
+// Writer masks what is written to w; a value split across two writes
+// is not found, loggers write each message whole
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return &writer{r, w}
+}
+
+type writer struct {
+	redactor *Redactor
+	w        io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.redactor.String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,131 @@
+package redact
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var key = []byte("test key")
+
+func TestFingerprint(t *testing.T) {
+	r := New(key)
+	fingerprint := r.Fingerprint("DbPassword", "password")
+	if !regexp.MustCompile(`^\[redacted DbPassword hmac:[0-9a-f]{8}\]$`).MatchString(fingerprint) {
+		t.Errorf("Fingerprint = %s", fingerprint)
+	}
+	sum := sha256.Sum256([]byte("password"))
+	tests := []struct {
+		name  string
+		other string
+		equal bool
+	}{
+		{"same key and value", New(key).Fingerprint("DbPassword", "password"), true},
+		{"other value", r.Fingerprint("DbPassword", "passw0rd"), false},
+		{"other key", New([]byte("other key")).Fingerprint("DbPassword", "password"), false},
+		{"random key", New(nil).Fingerprint("DbPassword", "password"), false},
+		{"unkeyed sha256", "[redacted DbPassword hmac:" + hex.EncodeToString(sum[:])[:8] + "]", false},
+	}
+	for _, test := range tests {
+		if (test.other == fingerprint) != test.equal {
+			t.Errorf("%s: %s against %s, want equal %v", test.name, test.other, fingerprint, test.equal)
+		}
+	}
+	if a, b := New(nil), New(nil); bytes.Equal(a.key, b.key) || len(a.key) != KeySize {
+		t.Errorf("random keys %x and %x", a.key, b.key)
+	}
+}
+
+// fingerprints under one key are stable across Redactors and runs
+func TestFingerprintStable(t *testing.T) {
+	a, b := New([]byte("stable")), New([]byte("stable"))
+	tests := []struct {
+		name, value string
+	}{
+		{"DbPassword", "password"},
+		{"HOSTNAME", "test-host"},
+		{"Empty", ""},
+	}
+	for _, test := range tests {
+		if x, y := a.Fingerprint(test.name, test.value), b.Fingerprint(test.name, test.value); x != y {
+			t.Errorf("Fingerprint(%s) = %s and %s under the same key", test.name, x, y)
+		}
+	}
+	if got := a.Fingerprint("DbPassword", "password"); got != "[redacted DbPassword hmac:1b3ef13c]" {
+		t.Errorf("Fingerprint = %s", got)
+	}
+}
+
+func TestString(t *testing.T) {
+	r := New(key)
+	r.Add("Password", "hunter22")
+	r.Add("Key", "-----BEGIN KEY-----\r\nMIIBOgIBAAJBAKj34GkxFhD9\r\n-----END KEY-----\r\n")
+	r.Add("Pin", "123")
+	r.Add("Token", "hunter22-token")
+	password := r.Fingerprint("Password", "hunter22")
+	pem := r.Fingerprint("Key", "-----BEGIN KEY-----\r\nMIIBOgIBAAJBAKj34GkxFhD9\r\n-----END KEY-----\r\n")
+	token := r.Fingerprint("Token", "hunter22-token")
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"no secret here", "no secret here"},
+		{"password hunter22.", "password " + password + "."},
+		{"base64 aHVudGVyMjI=", "base64 " + password},
+		{"twice hunter22 hunter22", "twice " + password + " " + password},
+		// a value holding another is masked whole
+		{"token hunter22-token", "token " + token},
+		{"line MIIBOgIBAAJBAKj34GkxFhD9 of a key", "line " + pem + " of a key"},
+		// values shorter than MinLength are not searched for
+		{"pin 123", "pin 123"},
+	}
+	for _, test := range tests {
+		if got := r.String(test.text); got != test.want {
+			t.Errorf("String(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+	if got := New(key).String("hunter22"); got != "hunter22" {
+		t.Errorf("String without secrets = %q", got)
+	}
+}
+
+func TestValue(t *testing.T) {
+	r := New(key)
+	r.Add("Pin", "123")
+	r.Add("Password", "hunter22")
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"Pin", "123", r.Fingerprint("Pin", "123")},
+		{"Password", "hunter22", r.Fingerprint("Password", "hunter22")},
+		{"URL", "postgres://admin:hunter22@db", "postgres://admin:" + r.Fingerprint("Password", "hunter22") + "@db"},
+		{"Host", "db", "db"},
+	}
+	for _, test := range tests {
+		if got := r.Value(test.name, test.value); got != test.want {
+			t.Errorf("Value(%s, %s) = %s, want %s", test.name, test.value, got, test.want)
+		}
+	}
+	if !r.Secret("Pin") || r.Secret("Host") {
+		t.Error("Secret of Pin false or of Host true")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	r := New(key)
+	var buffer bytes.Buffer
+	w := r.Writer(&buffer)
+	r.Add("Password", "hunter22")
+	text := "error: bad password hunter22\n"
+	if n, err := w.Write([]byte(text)); n != len(text) || err != nil {
+		t.Errorf("Write = %d, %v, want %d", n, err, len(text))
+	}
+	if got := buffer.String(); strings.Contains(got, "hunter22") || !strings.Contains(got, r.Fingerprint("Password", "hunter22")) {
+		t.Errorf("written %q", got)
+	}
+}
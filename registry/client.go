@@ -0,0 +1,319 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestTypes accepted for a tag, indexes first so a multi platform
+// image pins to its index rather than one platform
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// Client resolves image references through the registry v2 api
+type Client struct {
+	// HTTP client for https registries
+	HTTP *http.Client
+	// Insecure registries, host[:port], are reached over https without
+	// certificate verification, falling back to plain http; localhost
+	// and loopback registries are always insecure
+	Insecure map[string]bool
+	// Credentials of a registry, empty for anonymous access
+	Credentials func(registry string) (username, password string)
+	// Hosts maps a registry to the host serving its api,
+	// docker.io to registry-1.docker.io
+	Hosts map[string]string
+
+	mutex   sync.Mutex
+	digests map[string]string
+	tokens  map[string]string
+	schemes map[string]string
+}
+
+// NewClient a Client for the insecure registries
+func NewClient(insecure ...string) *Client {
+	client := &Client{
+		HTTP:     &http.Client{Timeout: 30 * time.Second},
+		Insecure: make(map[string]bool),
+		Hosts:    map[string]string{DockerHub: "registry-1.docker.io"},
+	}
+	for _, registry := range insecure {
+		client.Insecure[registry] = true
+	}
+	return client
+}
+
+// Pin returns image with the digest its tag resolves to appended,
+// nginx:1.25@sha256:..., an image with a digest is returned as is
+func (client *Client) Pin(image string) (string, error) {
+	reference, err := ParseReference(image)
+	if err != nil {
+		return image, err
+	}
+	if len(reference.Digest) > 0 {
+		return image, nil
+	}
+	if reference.Digest, err = client.Digest(reference); err != nil {
+		return image, err
+	}
+	return reference.String(), nil
+}
+
+// Digest of the manifest the registry serves for reference
+func (client *Client) Digest(reference Reference) (string, error) {
+	key := reference.Canonical() + ":" + reference.Version()
+	client.mutex.Lock()
+	digest, ok := client.digests[key]
+	client.mutex.Unlock()
+	if ok {
+		return digest, nil
+	}
+	path := "/v2/" + reference.Repository + "/manifests/" + reference.Version()
+	response, err := client.do("HEAD", reference, path)
+	if err == nil && len(response.Header.Get("Docker-Content-Digest")) == 0 {
+		// registries need not send the digest for HEAD, hash the body
+		response.Body.Close()
+		response, err = client.do("GET", reference, path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("image %s: %v", reference, err)
+	}
+	defer response.Body.Close()
+	digest = response.Header.Get("Docker-Content-Digest")
+	if len(digest) == 0 {
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return "", fmt.Errorf("image %s: %v", reference, err)
+		}
+		sum := sha256.Sum256(body)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	if !digestPattern.MatchString(digest) {
+		return "", fmt.Errorf("image %s: registry returned an invalid digest %q", reference, digest)
+	}
+	client.mutex.Lock()
+	if client.digests == nil {
+		client.digests = make(map[string]string)
+	}
+	client.digests[key] = digest
+	client.mutex.Unlock()
+	return digest, nil
+}
+
+// do sends a manifest request, answering an authentication challenge
+// once, and returns a 200 response
+func (client *Client) do(method string, reference Reference, path string) (*http.Response, error) {
+	response, err := client.send(method, reference, path, client.token(reference))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusUnauthorized {
+		challenge := response.Header.Get("WWW-Authenticate")
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		authorization, err := client.authorize(reference, challenge)
+		if err != nil {
+			return nil, err
+		}
+		if response, err = client.send(method, reference, path, authorization); err != nil {
+			return nil, err
+		}
+	}
+	if response.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		if response.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%s not found in %s", reference.Version(), reference.Canonical())
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, path, response.Status)
+	}
+	return response, nil
+}
+
+// send the request over the scheme that last worked for the registry,
+// trying https then http for an insecure registry
+func (client *Client) send(method string, reference Reference, path, authorization string) (*http.Response, error) {
+	schemes := []string{"https"}
+	insecure := client.insecure(reference.Registry)
+	client.mutex.Lock()
+	scheme, known := client.schemes[reference.Registry]
+	client.mutex.Unlock()
+	switch {
+	case known:
+		schemes = []string{scheme}
+	case insecure:
+		schemes = []string{"https", "http"}
+	}
+	var err error
+	for _, scheme := range schemes {
+		var request *http.Request
+		request, err = http.NewRequest(method, scheme+"://"+client.host(reference.Registry)+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+		if len(authorization) > 0 {
+			request.Header.Set("Authorization", authorization)
+		}
+		var response *http.Response
+		if response, err = client.httpClient(insecure).Do(request); err == nil {
+			client.mutex.Lock()
+			if client.schemes == nil {
+				client.schemes = make(map[string]string)
+			}
+			client.schemes[reference.Registry] = scheme
+			client.mutex.Unlock()
+			return response, nil
+		}
+	}
+	return nil, err
+}
+
+var challengeParameter = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// authorize answers a WWW-Authenticate challenge, fetching a bearer
+// token from the realm it names or using basic credentials
+func (client *Client) authorize(reference Reference, challenge string) (string, error) {
+	username, password := "", ""
+	if client.Credentials != nil {
+		username, password = client.Credentials(reference.Registry)
+	}
+	scheme := strings.ToLower(strings.SplitN(strings.TrimSpace(challenge), " ", 2)[0])
+	switch scheme {
+	case "basic":
+		if len(username) == 0 && len(password) == 0 {
+			return "", fmt.Errorf("registry %s requires credentials", reference.Registry)
+		}
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.SetBasicAuth(username, password)
+		return request.Header.Get("Authorization"), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("registry %s: unsupported authentication %q", reference.Registry, challenge)
+	}
+	parameters := make(map[string]string)
+	for _, match := range challengeParameter.FindAllStringSubmatch(challenge, -1) {
+		parameters[strings.ToLower(match[1])] = match[2]
+	}
+	realm, err := url.Parse(parameters["realm"])
+	if err != nil || len(parameters["realm"]) == 0 {
+		return "", fmt.Errorf("registry %s: challenge without a realm %q", reference.Registry, challenge)
+	}
+	query := realm.Query()
+	if service := parameters["service"]; len(service) > 0 {
+		query.Set("service", service)
+	}
+	scope := parameters["scope"]
+	if len(scope) == 0 {
+		scope = "repository:" + reference.Repository + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	request, err := http.NewRequest("GET", realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if len(username) > 0 || len(password) > 0 {
+		request.SetBasicAuth(username, password)
+	}
+	response, err := client.httpClient(client.insecure(realm.Host)).Do(request)
+	if err != nil {
+		return "", fmt.Errorf("registry %s: token: %v", reference.Registry, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry %s: token: %s", reference.Registry, response.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("registry %s: token: %v", reference.Registry, err)
+	}
+	if len(token.Token) == 0 {
+		token.Token = token.AccessToken
+	}
+	if len(token.Token) == 0 {
+		return "", fmt.Errorf("registry %s: token: empty token", reference.Registry)
+	}
+	authorization := "Bearer " + token.Token
+	client.mutex.Lock()
+	if client.tokens == nil {
+		client.tokens = make(map[string]string)
+	}
+	client.tokens[reference.Canonical()] = authorization
+	client.mutex.Unlock()
+	return authorization, nil
+}
+
+// token cached for the repository of reference
+func (client *Client) token(reference Reference) string {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.tokens[reference.Canonical()]
+}
+
+// host serving the api of registry
+func (client *Client) host(registry string) string {
+	if host, ok := client.Hosts[registry]; ok {
+		return host
+	}
+	return registry
+}
+
+// insecure reports a registry reached without certificate checks
+func (client *Client) insecure(registry string) bool {
+	if client.Insecure[registry] {
+		return true
+	}
+	host := registry
+	if h, _, err := net.SplitHostPort(registry); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// httpClient for secure or insecure registries
+func (client *Client) httpClient(insecure bool) *http.Client {
+	base := client.HTTP
+	if base == nil {
+		base = http.DefaultClient
+	}
+	if !insecure {
+		return base
+	}
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	if t, ok := base.Transport.(*http.Transport); ok {
+		transport = t.Clone()
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
+	return &http.Client{Transport: transport, Timeout: base.Timeout, CheckRedirect: base.CheckRedirect, Jar: base.Jar}
+}
@@ -0,0 +1,182 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/davidwalter0/k8s-template/manifest"
+)
+
+const manifestBody = `{"schemaVersion": 2}`
+
+// fakeRegistry serves the manifests of tags behind a bearer token
+// challenge, sending Docker-Content-Digest for HEAD only when digestHead
+type fakeRegistry struct {
+	*httptest.Server
+	digestHead bool
+	tags       map[string]string
+
+	mutex    sync.Mutex
+	requests []string
+	tokens   int
+}
+
+func newFakeRegistry(t *testing.T, digestHead bool) *fakeRegistry {
+	registry := &fakeRegistry{digestHead: digestHead, tags: map[string]string{"team/web:1.0": manifestBody}}
+	registry.Server = httptest.NewServer(http.HandlerFunc(registry.serve))
+	t.Cleanup(registry.Close)
+	return registry
+}
+
+func (registry *fakeRegistry) serve(w http.ResponseWriter, r *http.Request) {
+	registry.mutex.Lock()
+	registry.requests = append(registry.requests, r.Method+" "+r.URL.Path)
+	registry.mutex.Unlock()
+	if r.URL.Path == "/token" {
+		if r.URL.Query().Get("service") != "fake" || !strings.HasPrefix(r.URL.Query().Get("scope"), "repository:team/") {
+			http.Error(w, "bad token request "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		registry.mutex.Lock()
+		registry.tokens++
+		registry.mutex.Unlock()
+		fmt.Fprint(w, `{"token": "secret"}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+registry.URL+`/token",service="fake"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+		http.Error(w, "missing Accept", http.StatusBadRequest)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/", 2)
+	body, ok := registry.tags[strings.Join(parts, ":")]
+	if len(parts) != 2 || !ok {
+		http.Error(w, `{"errors": [{"code": "MANIFEST_UNKNOWN"}]}`, http.StatusNotFound)
+		return
+	}
+	if r.Method == "GET" || registry.digestHead {
+		w.Header().Set("Docker-Content-Digest", digestOf(body))
+	}
+	if r.Method == "GET" {
+		fmt.Fprint(w, body)
+	}
+}
+
+func (registry *fakeRegistry) host() string {
+	return strings.TrimPrefix(registry.URL, "http://")
+}
+
+func digestOf(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestPin(t *testing.T) {
+	for _, digestHead := range []bool{true, false} {
+		registry := newFakeRegistry(t, digestHead)
+		client := NewClient()
+		image := registry.host() + "/team/web:1.0"
+		want := image + "@" + digestOf(manifestBody)
+		for i := 0; i < 2; i++ {
+			got, err := client.Pin(image)
+			if err != nil {
+				t.Fatalf("digest on HEAD %v: %v", digestHead, err)
+			}
+			if got != want {
+				t.Errorf("digest on HEAD %v: Pin = %s, want %s", digestHead, got, want)
+			}
+		}
+		want = "HEAD /v2/team/web/manifests/1.0,GET /token,HEAD /v2/team/web/manifests/1.0"
+		if !digestHead {
+			want += ",GET /v2/team/web/manifests/1.0"
+		}
+		if got := strings.Join(registry.requests, ","); got != want {
+			t.Errorf("digest on HEAD %v: requests %s, want %s, the second Pin cached", digestHead, got, want)
+		}
+		if registry.tokens != 1 {
+			t.Errorf("digest on HEAD %v: %d tokens", digestHead, registry.tokens)
+		}
+	}
+}
+
+func TestPinErrors(t *testing.T) {
+	registry := newFakeRegistry(t, true)
+	client := NewClient()
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{registry.host() + "/team/web:2.0", "image " + registry.host() + "/team/web:2.0: 2.0 not found in " + registry.host() + "/team/web"},
+		{registry.host() + "/team/api:1.0", "not found in " + registry.host() + "/team/api"},
+		{registry.host() + "/Team/web:1.0", "invalid repository Team/web"},
+	}
+	for _, test := range tests {
+		got, err := client.Pin(test.image)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Pin(%s) error %v, want %q", test.image, err, test.want)
+		}
+		if got != test.image {
+			t.Errorf("Pin(%s) = %s on error", test.image, got)
+		}
+	}
+	digest := "sha256:" + strings.Repeat("a", 64)
+	if got, err := client.Pin(registry.host() + "/team/gone@" + digest); err != nil || !strings.HasSuffix(got, digest) {
+		t.Errorf("Pin of a digest = %s, %v, want it unchanged without a request", got, err)
+	}
+}
+
+func TestRewriteImages(t *testing.T) {
+	registry := newFakeRegistry(t, true)
+	client := NewClient()
+	text := "apiVersion: apps/v1\nkind: Deployment\nmetadata: {name: web}\nspec:\n  template:\n    spec:\n" +
+		"      containers:\n      - name: web\n        image: " + registry.host() + "/team/web:1.0\n" +
+		"      - name: sidecar\n        image: " + registry.host() + "/team/sidecar:1.0\n"
+	documents := manifest.Split(text)
+	if errors := manifest.Check(documents); len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	errors := manifest.RewriteImages(documents, client.Pin)
+	if len(errors) != 1 || !strings.Contains(errors[0].Error(), "11:9: document 1 (apps/v1/Deployment web): container sidecar: image ") ||
+		!strings.HasSuffix(errors[0].Message, "1.0 not found in "+registry.host()+"/team/sidecar") {
+		t.Fatalf("errors %v", errors)
+	}
+	if err := manifest.EncodeModified(documents); err != nil {
+		t.Fatal(err)
+	}
+	want := "image: " + registry.host() + "/team/web:1.0@" + digestOf(manifestBody) + "\n"
+	if got := manifest.Join(documents); !strings.Contains(got, want) || !strings.Contains(got, "image: "+registry.host()+"/team/sidecar:1.0\n") {
+		t.Errorf("RewriteImages =\n%s\nwant %s", got, want)
+	}
+}
+
+func TestBasicChallenge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fake"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digestOf(manifestBody))
+	}))
+	defer server.Close()
+	image := strings.TrimPrefix(server.URL, "http://") + "/web:1.0"
+
+	if _, err := NewClient().Pin(image); err == nil || !strings.Contains(err.Error(), "requires credentials") {
+		t.Errorf("anonymous Pin error %v", err)
+	}
+	client := NewClient()
+	client.Credentials = func(registry string) (string, string) { return "user", "pass" }
+	if got, err := client.Pin(image); err != nil || got != image+"@"+digestOf(manifestBody) {
+		t.Errorf("Pin = %s, %v", got, err)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+registry:
+
+Resolves container image references to the digests their registry
+serves for them, through the docker registry v2 api, so a render can
+pin every image to exactly what its tag names today.
+*/
+
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DockerHub the registry of image names without one
+const DockerHub = "docker.io"
+
+// Reference a parsed image reference
+type Reference struct {
+	// Name as written, without tag or digest
+	Name string
+	// Registry host[:port], docker.io when the name has none
+	Registry string
+	// Repository path inside the registry, library/nginx for nginx
+	Repository string
+	// Tag and Digest, empty when not written
+	Tag    string
+	Digest string
+}
+
+var (
+	repositoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagPattern        = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestPattern     = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-fA-F0-9]{32,}$`)
+)
+
+// ParseReference reads an image reference,
+// [registry[:port]/]repository[:tag][@digest]
+func ParseReference(image string) (reference Reference, err error) {
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, reference.Digest = name[:i], name[i+1:]
+		if !digestPattern.MatchString(reference.Digest) {
+			return reference, fmt.Errorf("image %s: invalid digest %s", image, reference.Digest)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i:], "/") {
+		name, reference.Tag = name[:i], name[i+1:]
+		if !tagPattern.MatchString(reference.Tag) {
+			return reference, fmt.Errorf("image %s: invalid tag %s", image, reference.Tag)
+		}
+	}
+	reference.Name = name
+	reference.Registry, reference.Repository = DockerHub, name
+	if i := strings.Index(name, "/"); i >= 0 {
+		if host := name[:i]; strings.ContainsAny(host, ".:") || host == "localhost" || host != strings.ToLower(host) {
+			reference.Registry, reference.Repository = host, name[i+1:]
+		}
+	}
+	if reference.Registry == DockerHub && !strings.Contains(reference.Repository, "/") {
+		reference.Repository = "library/" + reference.Repository
+	}
+	if !repositoryPattern.MatchString(reference.Repository) {
+		return reference, fmt.Errorf("image %s: invalid repository %s", image, reference.Repository)
+	}
+	return reference, nil
+}
+
+// Version the digest or tag the registry is asked for, latest when the
+// reference names neither
+func (reference Reference) Version() string {
+	switch {
+	case len(reference.Digest) > 0:
+		return reference.Digest
+	case len(reference.Tag) > 0:
+		return reference.Tag
+	}
+	return "latest"
+}
+
+// Canonical the registry and repository, docker.io/library/nginx
+func (reference Reference) Canonical() string {
+	return reference.Registry + "/" + reference.Repository
+}
+
+// String the reference as written with its tag and digest
+func (reference Reference) String() string {
+	text := reference.Name
+	if len(reference.Tag) > 0 {
+		text += ":" + reference.Tag
+	}
+	if len(reference.Digest) > 0 {
+		text += "@" + reference.Digest
+	}
+	return text
+}
+
+// Override rewrites image by the first matching old=new pair. An old
+// image names either one reference exactly, nginx:1.25, or every tag
+// and digest of a repository, nginx; a new image without a tag or
+// digest replacing a repository keeps the tag and digest of image.
+func Override(image string, overrides [][2]string) (string, error) {
+	reference, err := ParseReference(image)
+	if err != nil {
+		return image, err
+	}
+	for _, pair := range overrides {
+		old, err := ParseReference(pair[0])
+		if err != nil {
+			return image, err
+		}
+		if old.Canonical() != reference.Canonical() {
+			continue
+		}
+		if (len(old.Tag) > 0 || len(old.Digest) > 0) && (old.Tag != reference.Tag || old.Digest != reference.Digest) {
+			continue
+		}
+		replacement, err := ParseReference(pair[1])
+		if err != nil {
+			return image, err
+		}
+		if len(replacement.Tag) == 0 && len(replacement.Digest) == 0 {
+			replacement.Tag, replacement.Digest = reference.Tag, reference.Digest
+		}
+		return replacement.String(), nil
+	}
+	return image, nil
+}
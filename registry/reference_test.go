@@ -0,0 +1,63 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("0", 64)
+	tests := []struct {
+		image     string
+		canonical string
+		version   string
+		err       string
+	}{
+		{"nginx", "docker.io/library/nginx", "latest", ""},
+		{"nginx:1.25", "docker.io/library/nginx", "1.25", ""},
+		{"team/web:1.0", "docker.io/team/web", "1.0", ""},
+		{"ghcr.io/team/web:1.0@" + digest, "ghcr.io/team/web", digest, ""},
+		{"localhost:5000/web", "localhost:5000/web", "latest", ""},
+		{"localhost/web", "localhost/web", "latest", ""},
+		{"nginx@sha256:abc", "", "", "invalid digest"},
+		{"nginx:-bad", "", "", "invalid tag"},
+		{"Nginx", "", "", "invalid repository"},
+	}
+	for _, test := range tests {
+		reference, err := ParseReference(test.image)
+		if len(test.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ParseReference(%s) error %v, want %q", test.image, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseReference(%s): %v", test.image, err)
+			continue
+		}
+		if reference.Canonical() != test.canonical || reference.Version() != test.version || reference.String() != test.image {
+			t.Errorf("ParseReference(%s) = %s %s %s", test.image, reference.Canonical(), reference.Version(), reference)
+		}
+	}
+}
+
+func TestOverride(t *testing.T) {
+	overrides := [][2]string{
+		{"nginx:1.25", "mirror.local/nginx:1.25.4"},
+		{"docker.io/library/redis", "mirror.local/redis"},
+		{"team/web", "team/web:pinned"},
+	}
+	tests := []struct{ image, want string }{
+		{"nginx:1.25", "mirror.local/nginx:1.25.4"},
+		{"nginx:1.24", "nginx:1.24"},
+		{"redis:7", "mirror.local/redis:7"},
+		{"redis", "mirror.local/redis"},
+		{"team/web:1.0", "team/web:pinned"},
+		{"other/web:1.0", "other/web:1.0"},
+	}
+	for _, test := range tests {
+		if got, err := Override(test.image, overrides); err != nil || got != test.want {
+			t.Errorf("Override(%s) = %s, %v, want %s", test.image, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/davidwalter0/k8s-template/manifest"
+)
+
+const (
+	refPrefix = "#/components/schemas/"
+	// quantitySchema is a string in the schema, the api server also
+	// accepts numbers
+	quantitySchema = "io.k8s.apimachinery.pkg.api.resource.Quantity"
+)
+
+// Set of schemas indexed by the kind they describe
+type Set struct {
+	// Version of kubernetes the schemas were loaded for
+	Version string
+	// Strict reports a resource of a kind without a schema as an
+	// error rather than a warning
+	Strict  bool
+	schemas map[string]*Schema
+	kinds   map[GVK]*Schema
+}
+
+// NewSet returns an empty set
+func NewSet() *Set {
+	return &Set{schemas: make(map[string]*Schema), kinds: make(map[GVK]*Schema)}
+}
+
+type document struct {
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// Load the OpenAPI v3 documents for kubernetes version from dir, when
+// version is empty the highest version found is used, or dir itself
+// when it holds the json documents directly
+func Load(dir, version string) (*Set, error) {
+	versionDir, version, err := selectVersion(dir, version)
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(versionDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("schema directory %s has no OpenAPI json documents", versionDir)
+	}
+	set := NewSet()
+	set.Version = version
+	for _, file := range files {
+		text, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var doc document
+		if err = json.Unmarshal(text, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		for name, schema := range doc.Components.Schemas {
+			set.schemas[name] = schema
+			for _, gvk := range schema.GroupVersionKind {
+				set.kinds[gvk] = schema
+			}
+		}
+	}
+	if quantity, ok := set.schemas[quantitySchema]; ok {
+		quantity.Format = "quantity"
+	}
+	return set, nil
+}
+
+// selectVersion finds the directory holding the schemas of version
+func selectVersion(dir, version string) (string, string, error) {
+	if len(version) > 0 {
+		for _, name := range []string{"v" + strings.TrimPrefix(version, "v"), strings.TrimPrefix(version, "v")} {
+			if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.IsDir() {
+				return filepath.Join(dir, name), version, nil
+			}
+		}
+		return "", "", fmt.Errorf("schema directory %s has no schemas for kubernetes %s", dir, version)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	var versions []string
+	for _, entry := range entries {
+		if entry.IsDir() && len(versionKey(entry.Name())) > 0 {
+			versions = append(versions, entry.Name())
+		}
+	}
+	if len(versions) == 0 {
+		return dir, "", nil
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		a, b := versionKey(versions[i]), versionKey(versions[j])
+		return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
+	})
+	latest := versions[len(versions)-1]
+	return filepath.Join(dir, latest), strings.TrimPrefix(latest, "v"), nil
+}
+
+// versionKey major and minor of a v1.29 or 1.29 directory name
+func versionKey(name string) []int {
+	parts := strings.Split(strings.TrimPrefix(name, "v"), ".")
+	if len(parts) != 2 {
+		return nil
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	return []int{major, minor}
+}
+
+// AddCRD registers the version schemas of a CustomResourceDefinition,
+// decoded from yaml
+func (set *Set) AddCRD(object interface{}) error {
+	text, err := json.Marshal(manifest.PlainMaps(object))
+	if err != nil {
+		return err
+	}
+	var crd struct {
+		Spec struct {
+			Group string `json:"group"`
+			Names struct {
+				Kind string `json:"kind"`
+			} `json:"names"`
+			Versions []struct {
+				Name   string `json:"name"`
+				Schema struct {
+					OpenAPIV3Schema *Schema `json:"openAPIV3Schema"`
+				} `json:"schema"`
+			} `json:"versions"`
+		} `json:"spec"`
+	}
+	if err = json.Unmarshal(text, &crd); err != nil {
+		return err
+	}
+	if len(crd.Spec.Group) == 0 || len(crd.Spec.Names.Kind) == 0 {
+		return fmt.Errorf("CustomResourceDefinition without spec.group or spec.names.kind")
+	}
+	for _, version := range crd.Spec.Versions {
+		schema := version.Schema.OpenAPIV3Schema
+		if schema == nil {
+			schema = &Schema{Type: "object", PreserveUnknown: true}
+		}
+		// apiVersion, kind and metadata are implied for custom resources
+		schema.EmbeddedResource = true
+		set.kinds[GVK{Group: crd.Spec.Group, Version: version.Name, Kind: crd.Spec.Names.Kind}] = schema
+	}
+	return nil
+}
+
+// AddCRDFile registers every CustomResourceDefinition in a yaml file
+func (set *Set) AddCRDFile(filename string) error {
+	text, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	for _, document := range manifest.Split(string(text)) {
+		if err = document.Parse(); err != nil {
+			return fmt.Errorf("%s:%d: document %d: %v", filename, document.Line, document.Index+1, err)
+		}
+		if document.Kind() == "CustomResourceDefinition" {
+			if err = set.AddCRD(document.Object); err != nil {
+				return fmt.Errorf("%s:%d: document %d: %v", filename, document.Line, document.Index+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup the schema of a kind, nil when unknown
+func (set *Set) Lookup(apiVersion, kind string) *Schema {
+	return set.kinds[ParseGVK(apiVersion, kind)]
+}
+
+// resolve follows a $ref
+func (set *Set) resolve(schema *Schema) (*Schema, error) {
+	for schema != nil && len(schema.Ref) > 0 {
+		name := strings.TrimPrefix(schema.Ref, refPrefix)
+		next, ok := set.schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unresolved schema reference %s", schema.Ref)
+		}
+		schema = next
+	}
+	return schema, nil
+}
@@ -0,0 +1,89 @@
+/*
+schema:
+
+Offline validation of kubernetes resources against OpenAPI v3
+schemas, the documents the api server publishes under /openapi/v3,
+and against the openAPIV3Schema of CustomResourceDefinitions.
+
+A schema directory holds one subdirectory per kubernetes version, v1.29
+or 1.29, each with the json documents of that version, for example
+saved from a cluster with
+
+    kubectl get --raw /openapi/v3/apis/apps/v1 > v1.29/apis__apps__v1_openapi.json
+
+Only the constraints that catch template mistakes are checked: types,
+unknown fields, required fields and enums.
+*/
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Schema the subset of an OpenAPI v3 schema object that is validated
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Additional        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+
+	IntOrString      bool  `json:"x-kubernetes-int-or-string,omitempty"`
+	PreserveUnknown  bool  `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	EmbeddedResource bool  `json:"x-kubernetes-embedded-resource,omitempty"`
+	GroupVersionKind []GVK `json:"x-kubernetes-group-version-kind,omitempty"`
+}
+
+// Additional additionalProperties, either a boolean or a schema
+type Additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+// UnmarshalJSON accepts true, false or a schema
+func (a *Additional) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("true")) || bytes.Equal(data, []byte("false")) {
+		return json.Unmarshal(data, &a.Allowed)
+	}
+	a.Allowed = true
+	return json.Unmarshal(data, &a.Schema)
+}
+
+// GVK group, version and kind a schema describes
+type GVK struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// ParseGVK from an apiVersion and kind
+func ParseGVK(apiVersion, kind string) GVK {
+	gvk := GVK{Version: apiVersion, Kind: kind}
+	if parts := strings.SplitN(apiVersion, "/", 2); len(parts) == 2 {
+		gvk.Group, gvk.Version = parts[0], parts[1]
+	}
+	return gvk
+}
+
+// APIVersion group/version, or version for the core group
+func (gvk GVK) APIVersion() string {
+	if len(gvk.Group) == 0 {
+		return gvk.Version
+	}
+	return gvk.Group + "/" + gvk.Version
+}
+
+func (gvk GVK) String() string {
+	return gvk.APIVersion() + " " + gvk.Kind
+}
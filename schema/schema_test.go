@@ -0,0 +1,267 @@
+package schema
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const openapi = `{
+  "components": {
+    "schemas": {
+      "io.k8s.api.apps.v1.Deployment": {
+        "type": "object",
+        "properties": {
+          "apiVersion": {"type": "string"},
+          "kind": {"type": "string"},
+          "metadata": {"type": "object", "properties": {"name": {"type": "string"}, "labels": {"type": "object", "additionalProperties": {"type": "string"}}}},
+          "spec": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.apps.v1.DeploymentSpec"}]}
+        },
+        "x-kubernetes-group-version-kind": [{"group": "apps", "version": "v1", "kind": "Deployment"}]
+      },
+      "io.k8s.api.apps.v1.DeploymentSpec": {
+        "type": "object",
+        "required": ["selector"],
+        "properties": {
+          "replicas": {"type": "integer"},
+          "selector": {"type": "object"},
+          "strategy": {"type": "object", "properties": {"type": {"type": "string", "enum": ["Recreate", "RollingUpdate"]}, "maxSurge": {"x-kubernetes-int-or-string": true}}},
+          "memory": {"$ref": "#/components/schemas/io.k8s.apimachinery.pkg.api.resource.Quantity"},
+          "paused": {"type": "boolean"},
+          "ports": {"type": "array", "items": {"type": "integer"}}
+        }
+      },
+      "io.k8s.apimachinery.pkg.api.resource.Quantity": {"type": "string"}
+    }
+  }
+}`
+
+const crds = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+  annotations:
+    description: |
+      a block scalar holding a line that is not a separator
+      ----
+spec:
+  group: example.com
+  names:
+    kind: Widget
+  versions:
+  - name: v1
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              size:
+                type: integer
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+`
+
+func testSet(t *testing.T) *Set {
+	dir, err := ioutil.TempDir("", "schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	version := filepath.Join(dir, "v1.29")
+	if err = os.Mkdir(version, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(version, "apis__apps__v1_openapi.json"), []byte(openapi), 0644); err != nil {
+		t.Fatal(err)
+	}
+	crdFile := filepath.Join(dir, "crds.yaml")
+	if err = ioutil.WriteFile(crdFile, []byte(crds), 0644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := Load(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Version != "1.29" {
+		t.Fatalf("Version %q, want 1.29", set.Version)
+	}
+	if err = set.AddCRDFile(crdFile); err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestValidate(t *testing.T) {
+	set := testSet(t)
+	tests := []struct {
+		name   string
+		text   string
+		errors []string
+	}{
+		{"valid", `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web, labels: {app: web}}
+spec:
+  replicas: 2
+  selector: {}
+  strategy: {type: Recreate, maxSurge: 25%}
+  memory: 1Gi
+  paused: false
+  ports: [80, 443]
+`, nil},
+		{"numeric quantity", `
+apiVersion: apps/v1
+kind: Deployment
+spec: {selector: {}, memory: 2}
+`, nil},
+		{"type mismatch", `
+apiVersion: apps/v1
+kind: Deployment
+spec: {selector: {}, replicas: two, paused: "yes", ports: [80, http]}
+`, []string{
+			`.spec.replicas: expected integer, got string "two"`,
+			`.spec.paused: expected boolean, got string "yes"`,
+			`.spec.ports[1]: expected integer, got string "http"`,
+		}},
+		{"unknown field", `
+apiVersion: apps/v1
+kind: Deployment
+spec: {selector: {}, replica: 2, bogus: 1}
+`, []string{
+			".spec.replica: unknown field, did you mean replicas?",
+			".spec.bogus: unknown field",
+		}},
+		{"required", `
+apiVersion: apps/v1
+kind: Deployment
+spec: {replicas: 1}
+`, []string{".spec.selector: required field is missing"}},
+		{"enum", `
+apiVersion: apps/v1
+kind: Deployment
+spec: {selector: {}, strategy: {type: Rolling}}
+`, []string{".spec.strategy.type: Rolling is not one of Recreate, RollingUpdate"}},
+		{"int or string", `
+apiVersion: apps/v1
+kind: Deployment
+spec: {selector: {}, strategy: {maxSurge: [1]}}
+`, []string{`.spec.strategy.maxSurge: expected integer or string, got array "[1]"`}},
+		{"additional properties", `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {labels: {replicas: 3}}
+spec: {selector: {}}
+`, []string{`.metadata.labels.replicas: expected string, got integer "3"`}},
+		{"custom resource", `
+apiVersion: example.com/v1
+kind: Widget
+metadata: {name: w}
+spec: {size: 3}
+`, nil},
+		{"custom resource mismatch", `
+apiVersion: example.com/v1
+kind: Widget
+spec: {size: large, colour: red}
+`, []string{
+			`.spec.size: expected integer, got string "large"`,
+			".spec.colour: unknown field",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var object yaml.MapSlice
+			if err := yaml.Unmarshal([]byte(test.text), &object); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range set.Validate(object) {
+				if e.Warning {
+					t.Errorf("unexpected warning %v", e)
+				}
+				got = append(got, e.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(test.errors, "\n") {
+				t.Errorf("errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.errors, "\n"))
+			}
+		})
+	}
+}
+
+func TestValidateNoSchema(t *testing.T) {
+	set := testSet(t)
+	object := yaml.MapSlice{{Key: "apiVersion", Value: "v1"}, {Key: "kind", Value: "ConfigMap"}}
+	for _, strict := range []bool{false, true} {
+		set.Strict = strict
+		errors := set.Validate(object)
+		if len(errors) != 1 {
+			t.Fatalf("strict %v: %v, want one error", strict, errors)
+		}
+		if errors[0].Warning == strict {
+			t.Errorf("strict %v: warning %v", strict, errors[0].Warning)
+		}
+		if want := ".: no schema for v1 ConfigMap in kubernetes 1.29"; errors[0].Error() != want {
+			t.Errorf("%q, want %q", errors[0].Error(), want)
+		}
+	}
+}
+
+func TestAddCRDFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"invalid yaml", "kind: ConfigMap\n---\nkind: [\n", ":3: document 2:"},
+		{"no group", "kind: CustomResourceDefinition\nspec:\n  names: {kind: Widget}\n", "without spec.group"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := ioutil.TempFile("", "crds")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(file.Name())
+			file.WriteString(test.text)
+			file.Close()
+			err = NewSet().AddCRDFile(file.Name())
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestSelectVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"v1.9", "1.28", "v1.30", "notes"} {
+		os.Mkdir(filepath.Join(dir, name), 0755)
+	}
+	tests := []struct{ version, dir, want string }{
+		{"", "v1.30", "1.30"},
+		{"1.28", "1.28", "1.28"},
+		{"v1.9", "v1.9", "v1.9"},
+	}
+	for _, test := range tests {
+		got, version, err := selectVersion(dir, test.version)
+		if err != nil || got != filepath.Join(dir, test.dir) || version != test.want {
+			t.Errorf("selectVersion(%q) = %s, %s, %v", test.version, got, version, err)
+		}
+	}
+	if _, _, err = selectVersion(dir, "1.31"); err == nil {
+		t.Error("selectVersion(1.31) succeeded")
+	}
+}
@@ -0,0 +1,265 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Error a constraint violation at Path, .spec.replicas
+type Error struct {
+	Path    string
+	Message string
+	// Warning does not fail validation
+	Warning bool
+}
+
+func (e *Error) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Validate a resource decoded from yaml, reporting a resource of an
+// unknown kind as a warning, or an error when the set is Strict
+func (set *Set) Validate(object yaml.MapSlice) []*Error {
+	apiVersion, kind := fmt.Sprint(lookup(object, "apiVersion")), fmt.Sprint(lookup(object, "kind"))
+	schema := set.Lookup(apiVersion, kind)
+	if schema == nil {
+		message := fmt.Sprintf("no schema for %s %s", apiVersion, kind)
+		if len(set.Version) > 0 {
+			message += " in kubernetes " + set.Version
+		}
+		return []*Error{{Path: ".", Message: message, Warning: !set.Strict}}
+	}
+	var errors []*Error
+	set.validate(object, schema, "", &errors)
+	return errors
+}
+
+func (set *Set) validate(value interface{}, schema *Schema, path string, errors *[]*Error) {
+	schema, err := set.resolve(schema)
+	if err != nil {
+		*errors = append(*errors, &Error{Path: display(path), Message: err.Error()})
+		return
+	}
+	if schema == nil || value == nil {
+		return
+	}
+	for _, part := range schema.AllOf {
+		set.validate(value, part, path, errors)
+	}
+	for _, alternatives := range [][]*Schema{schema.OneOf, schema.AnyOf} {
+		if len(alternatives) > 0 && !set.matchesAny(value, alternatives, path) {
+			var first []*Error
+			set.validate(value, alternatives[0], path, &first)
+			*errors = append(*errors, first...)
+		}
+	}
+	if schema.IntOrString || schema.Format == "int-or-string" {
+		if !isInteger(value) && !isString(value) {
+			*errors = append(*errors, mismatch(path, "integer or string", value))
+		}
+		return
+	}
+	if schema.PreserveUnknown && len(schema.Properties) == 0 {
+		return
+	}
+
+	switch schema.Type {
+	case "":
+		if len(schema.Properties) > 0 {
+			if mapping, ok := value.(yaml.MapSlice); ok {
+				set.object(mapping, schema, path, errors)
+			}
+		}
+	case "object":
+		mapping, ok := value.(yaml.MapSlice)
+		if !ok {
+			*errors = append(*errors, mismatch(path, "object", value))
+			return
+		}
+		set.object(mapping, schema, path, errors)
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			*errors = append(*errors, mismatch(path, "array", value))
+			return
+		}
+		for i, item := range list {
+			set.validate(item, schema.Items, fmt.Sprintf("%s[%d]", path, i), errors)
+		}
+	case "string":
+		if !isString(value) && !(schema.Format == "quantity" && isNumber(value)) {
+			*errors = append(*errors, mismatch(path, "string", value))
+		}
+	case "integer":
+		if !isInteger(value) {
+			*errors = append(*errors, mismatch(path, "integer", value))
+		}
+	case "number":
+		if !isNumber(value) {
+			*errors = append(*errors, mismatch(path, "number", value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			*errors = append(*errors, mismatch(path, "boolean", value))
+		}
+	}
+
+	if len(schema.Enum) > 0 {
+		for _, allowed := range schema.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				return
+			}
+		}
+		var allowed []string
+		for _, x := range schema.Enum {
+			allowed = append(allowed, fmt.Sprint(x))
+		}
+		*errors = append(*errors, &Error{Path: display(path),
+			Message: fmt.Sprintf("%v is not one of %s", value, strings.Join(allowed, ", "))})
+	}
+}
+
+func (set *Set) object(mapping yaml.MapSlice, schema *Schema, path string, errors *[]*Error) {
+	present := make(map[string]bool)
+	for _, item := range mapping {
+		key := fmt.Sprint(item.Key)
+		present[key] = true
+		child := path + "." + key
+		if property, ok := schema.Properties[key]; ok {
+			set.validate(item.Value, property, child, errors)
+			continue
+		}
+		if schema.EmbeddedResource && (key == "apiVersion" || key == "kind" || key == "metadata") {
+			continue
+		}
+		switch {
+		case schema.AdditionalProperties != nil && schema.AdditionalProperties.Schema != nil:
+			set.validate(item.Value, schema.AdditionalProperties.Schema, child, errors)
+		case schema.AdditionalProperties != nil && schema.AdditionalProperties.Allowed:
+		case schema.PreserveUnknown:
+		case len(schema.Properties) == 0 && schema.AdditionalProperties == nil:
+			// a free form object
+		default:
+			*errors = append(*errors, &Error{Path: display(child),
+				Message: "unknown field" + suggest(key, schema.Properties)})
+		}
+	}
+	for _, name := range schema.Required {
+		if !present[name] {
+			*errors = append(*errors, &Error{Path: display(path + "." + name), Message: "required field is missing"})
+		}
+	}
+}
+
+// matchesAny reports if value validates against one of alternatives
+func (set *Set) matchesAny(value interface{}, alternatives []*Schema, path string) bool {
+	for _, alternative := range alternatives {
+		var errors []*Error
+		set.validate(value, alternative, path, &errors)
+		if len(errors) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest the property closest to a misspelled key
+func suggest(key string, properties map[string]*Schema) string {
+	var names []string
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.EqualFold(name, key) || distance(name, key) <= 2 {
+			return ", did you mean " + name + "?"
+		}
+	}
+	return ""
+}
+
+// distance the levenshtein edit distance of a and b
+func distance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func mismatch(path, expected string, value interface{}) *Error {
+	return &Error{Path: display(path), Message: fmt.Sprintf("expected %s, got %s %q", expected, typeName(value), fmt.Sprint(value))}
+}
+
+func display(path string) string {
+	if len(path) == 0 {
+		return "."
+	}
+	return path
+}
+
+func lookup(object yaml.MapSlice, key string) interface{} {
+	for _, item := range object {
+		if fmt.Sprint(item.Key) == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+func isString(value interface{}) bool {
+	_, ok := value.(string)
+	return ok
+}
+
+func isInteger(value interface{}) bool {
+	switch v := value.(type) {
+	case int, int64, uint64:
+		return true
+	case float64:
+		return v == math.Trunc(v)
+	}
+	return false
+}
+
+func isNumber(value interface{}) bool {
+	switch value.(type) {
+	case int, int64, uint64, float64:
+		return true
+	}
+	return false
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case yaml.MapSlice:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,400 @@
+/*
+sshkey:
+
+Generate ssh key pairs and derive authorized_keys lines and
+fingerprints from private keys.
+
+Private keys are read in the OpenSSH format or PEM encoded PKCS#1,
+SEC 1 or PKCS#8, and written in the unencrypted OpenSSH format that
+ssh-keygen produces. Encrypted private keys are not supported.
+*/
+
+package sshkey
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/davidwalter0/k8s-template/certs"
+)
+
+const opensshMagic = "openssh-key-v1\x00"
+
+// KeyPair an OpenSSH private key and its authorized_keys line
+type KeyPair struct {
+	PrivateKey  string
+	PublicKey   string
+	Fingerprint string
+}
+
+// Generate a key pair: rsa, rsa:4096, ecdsa, ecdsa:384, ed25519
+func Generate(keyType, comment string) (*KeyPair, error) {
+	opts, err := certs.ParseKeyType(keyType)
+	if err != nil {
+		return nil, err
+	}
+	if opts.KeyType == certs.RSA && opts.KeySize < 3072 {
+		opts.KeySize = 3072
+	}
+	signer, err := certs.GenerateKey(opts)
+	if err != nil {
+		return nil, err
+	}
+	private, err := marshalPrivate(signer, comment)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyPair(string(private), comment)
+}
+
+// NewKeyPair derives the public half and fingerprint of privateKey
+func NewKeyPair(privateKey, comment string) (*KeyPair, error) {
+	signer, err := ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	public, err := marshalPublic(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{
+		PrivateKey:  privateKey,
+		PublicKey:   authorizedKey(public, comment),
+		Fingerprint: fingerprint(public),
+	}, nil
+}
+
+// PublicKey returns the authorized_keys line for privateKey
+func PublicKey(privateKey string) (string, error) {
+	pair, err := NewKeyPair(privateKey, "")
+	if err != nil {
+		return "", err
+	}
+	return pair.PublicKey, nil
+}
+
+// Fingerprint returns the SHA256 fingerprint, as ssh-keygen -l prints
+// it, of an authorized_keys line or a private key
+func Fingerprint(key string) (string, error) {
+	if public, err := parseAuthorizedKey(key); err == nil {
+		return fingerprint(public), nil
+	}
+	pair, err := NewKeyPair(key, "")
+	if err != nil {
+		return "", err
+	}
+	return pair.Fingerprint, nil
+}
+
+func authorizedKey(public []byte, comment string) string {
+	line := keyType(public) + " " + base64.StdEncoding.EncodeToString(public)
+	if len(comment) > 0 {
+		line += " " + comment
+	}
+	return line
+}
+
+func fingerprint(public []byte) string {
+	sum := sha256.Sum256(public)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// parseAuthorizedKey returns the wire format of "type base64 [comment]"
+func parseAuthorizedKey(line string) ([]byte, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, errors.New("not an authorized_keys line")
+	}
+	public, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	if keyType(public) != fields[0] {
+		return nil, fmt.Errorf("authorized key type %s does not match its data", fields[0])
+	}
+	return public, nil
+}
+
+// keyType reads the leading type string of a wire format key
+func keyType(public []byte) string {
+	r := reader{data: public}
+	return string(r.bytes())
+}
+
+// ParsePrivateKey reads an OpenSSH or PEM encoded private key
+func ParsePrivateKey(text string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(text))
+	if block == nil {
+		return nil, errors.New("ssh private key: no PEM block found")
+	}
+	if len(block.Headers) > 0 || strings.Contains(block.Type, "ENCRYPTED") {
+		return nil, errors.New("ssh private key: encrypted keys are not supported")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		return parseOpenSSH(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("ssh private key: unsupported PEM type %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("ssh private key: unsupported key %T", key)
+	}
+	return signer, nil
+}
+
+func curveName(curve elliptic.Curve) (string, error) {
+	switch curve {
+	case elliptic.P256():
+		return "nistp256", nil
+	case elliptic.P384():
+		return "nistp384", nil
+	case elliptic.P521():
+		return "nistp521", nil
+	}
+	return "", fmt.Errorf("unsupported ecdsa curve %s", curve.Params().Name)
+}
+
+func curveByName(name string) (elliptic.Curve, error) {
+	switch name {
+	case "nistp256":
+		return elliptic.P256(), nil
+	case "nistp384":
+		return elliptic.P384(), nil
+	case "nistp521":
+		return elliptic.P521(), nil
+	}
+	return nil, fmt.Errorf("unsupported ecdsa curve %s", name)
+}
+
+// marshalPublic returns the ssh wire format of a public key
+func marshalPublic(key crypto.PublicKey) ([]byte, error) {
+	var w writer
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		w.string([]byte("ssh-ed25519"))
+		w.string(k)
+	case *rsa.PublicKey:
+		w.string([]byte("ssh-rsa"))
+		w.mpint(big.NewInt(int64(k.E)))
+		w.mpint(k.N)
+	case *ecdsa.PublicKey:
+		curve, err := curveName(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		point, err := k.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		w.string([]byte("ecdsa-sha2-" + curve))
+		w.string([]byte(curve))
+		w.string(point.Bytes())
+	default:
+		return nil, fmt.Errorf("unsupported public key %T", key)
+	}
+	return w.Bytes(), nil
+}
+
+// marshalPrivate encodes signer in the unencrypted openssh-key-v1 format
+func marshalPrivate(signer crypto.Signer, comment string) ([]byte, error) {
+	public, err := marshalPublic(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	var check [4]byte
+	if _, err = rand.Read(check[:]); err != nil {
+		return nil, err
+	}
+	var private writer
+	private.Write(check[:])
+	private.Write(check[:])
+	switch k := signer.(type) {
+	case ed25519.PrivateKey:
+		private.string([]byte("ssh-ed25519"))
+		private.string(k.Public().(ed25519.PublicKey))
+		private.string(k)
+	case *rsa.PrivateKey:
+		k.Precompute()
+		private.string([]byte("ssh-rsa"))
+		private.mpint(k.N)
+		private.mpint(big.NewInt(int64(k.E)))
+		private.mpint(k.D)
+		private.mpint(k.Precomputed.Qinv)
+		private.mpint(k.Primes[0])
+		private.mpint(k.Primes[1])
+	case *ecdsa.PrivateKey:
+		// the public wire format already holds type, curve and point
+		private.Write(public)
+		private.mpint(k.D)
+	default:
+		return nil, fmt.Errorf("unsupported private key %T", signer)
+	}
+	private.string([]byte(comment))
+	for i := byte(1); private.Len()%8 != 0; i++ {
+		private.WriteByte(i)
+	}
+
+	var w writer
+	w.WriteString(opensshMagic)
+	w.string([]byte("none"))
+	w.string([]byte("none"))
+	w.string(nil)
+	w.uint32(1)
+	w.string(public)
+	w.string(private.Bytes())
+	return pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: w.Bytes()}), nil
+}
+
+// parseOpenSSH decodes an unencrypted openssh-key-v1 private key
+func parseOpenSSH(data []byte) (crypto.Signer, error) {
+	if !bytes.HasPrefix(data, []byte(opensshMagic)) {
+		return nil, errors.New("ssh private key: missing openssh-key-v1 header")
+	}
+	r := reader{data: data[len(opensshMagic):]}
+	cipher, kdf := string(r.bytes()), string(r.bytes())
+	r.bytes() // kdf options
+	if cipher != "none" || kdf != "none" {
+		return nil, errors.New("ssh private key: encrypted keys are not supported")
+	}
+	if n := r.uint32(); n != 1 {
+		return nil, fmt.Errorf("ssh private key: expected one key, found %d", n)
+	}
+	r.bytes() // public key
+	p := reader{data: r.bytes()}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if p.uint32() != p.uint32() {
+		return nil, errors.New("ssh private key: check bytes differ, encrypted or corrupt")
+	}
+
+	var signer crypto.Signer
+	switch name := string(p.bytes()); {
+	case name == "ssh-ed25519":
+		p.bytes()
+		key := p.bytes()
+		if p.err == nil && len(key) != ed25519.PrivateKeySize {
+			return nil, errors.New("ssh private key: bad ed25519 key length")
+		}
+		signer = ed25519.PrivateKey(key)
+	case name == "ssh-rsa":
+		k := &rsa.PrivateKey{}
+		k.N = p.mpint()
+		k.E = int(p.mpint().Int64())
+		k.D = p.mpint()
+		p.mpint() // iqmp, recomputed
+		k.Primes = []*big.Int{p.mpint(), p.mpint()}
+		if p.err != nil {
+			break
+		}
+		if err := k.Validate(); err != nil {
+			return nil, err
+		}
+		k.Precompute()
+		signer = k
+	case strings.HasPrefix(name, "ecdsa-sha2-"):
+		curve, err := curveByName(string(p.bytes()))
+		if err != nil {
+			return nil, err
+		}
+		p.bytes() // public point, derived from d
+		d := p.mpint()
+		if p.err != nil {
+			break
+		}
+		k, err := ecdsa.ParseRawPrivateKey(curve, d.FillBytes(make([]byte, (curve.Params().BitSize+7)/8)))
+		if err != nil {
+			return nil, err
+		}
+		signer = k
+	default:
+		return nil, fmt.Errorf("ssh private key: unsupported key type %s", name)
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return signer, nil
+}
+
+// writer of the ssh wire encoding, rfc4251
+type writer struct {
+	bytes.Buffer
+}
+
+func (w *writer) uint32(n uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], n)
+	w.Write(b[:])
+}
+
+func (w *writer) string(s []byte) {
+	w.uint32(uint32(len(s)))
+	w.Write(s)
+}
+
+func (w *writer) mpint(n *big.Int) {
+	b := n.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	w.string(b)
+}
+
+// reader of the ssh wire encoding, the first error sticks
+type reader struct {
+	data []byte
+	err  error
+}
+
+var errShort = errors.New("ssh key: truncated data")
+
+func (r *reader) uint32() uint32 {
+	if r.err != nil || len(r.data) < 4 {
+		r.err = errShort
+		return 0
+	}
+	n := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return n
+}
+
+func (r *reader) bytes() []byte {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.data)) < n {
+		r.err = errShort
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) mpint() *big.Int {
+	return new(big.Int).SetBytes(r.bytes())
+}
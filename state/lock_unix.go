@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package state
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile opens and exclusively locks filename, blocking until any
+// other holder releases it
+func lockFile(filename string) (*os.File, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func unlockFile(f *os.File) error {
+	defer f.Close()
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
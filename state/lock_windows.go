@@ -0,0 +1,54 @@
+//go:build windows
+// +build windows
+
+package state
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+// lockfileExclusiveLock LOCKFILE_EXCLUSIVE_LOCK, without
+// LOCKFILE_FAIL_IMMEDIATELY the call waits for the lock
+const lockfileExclusiveLock = 0x2
+
+// lockFile opens and exclusively locks filename, blocking until any
+// other holder releases it
+func lockFile(filename string) (*os.File, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = call(procLockFileEx, f.Fd(), lockfileExclusiveLock, 0, 1, 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %v", filename, err)
+	}
+	return f, nil
+}
+
+func unlockFile(f *os.File) error {
+	defer f.Close()
+	return call(procUnlockFileEx, f.Fd(), 0, 1, 0)
+}
+
+// call LockFileEx or UnlockFileEx with args, the first byte of the file
+// being locked, followed by an OVERLAPPED at offset 0
+func call(proc *syscall.LazyProc, args ...uintptr) error {
+	if err := proc.Find(); err != nil {
+		return err
+	}
+	var overlapped syscall.Overlapped
+	r, _, err := proc.Call(append(args, uintptr(unsafe.Pointer(&overlapped)))...)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package state
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// PasswordAlphabet is safe to place unquoted in yaml, urls and shell
+const PasswordAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// Password returns length characters chosen uniformly from
+// PasswordAlphabet using crypto/rand
+func Password(length int) (string, error) {
+	if length < 1 {
+		return "", fmt.Errorf("password length must be positive, got %d", length)
+	}
+	max := big.NewInt(int64(len(PasswordAlphabet)))
+	text := make([]byte, length)
+	for i := range text {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		text[i] = PasswordAlphabet[n.Int64()]
+	}
+	return string(text), nil
+}
@@ -0,0 +1,258 @@
+/*
+state:
+
+Keeps values generated during template replacement -- passwords, keys,
+certificates -- so that every later render of a template sees the
+same value the first render produced.
+
+The store is a single file encrypted with AES-256-GCM. The key is
+either read from a key file, created on first use with mode 0600, or
+derived from a passphrase. A lock file next to the store serializes
+concurrent runs.
+
+Entries are keyed by profile and name.
+*/
+
+package state
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/davidwalter0/k8s-template/atomicfile"
+)
+
+const (
+	keySize        = 32
+	saltSize       = 16
+	pbkdf2Rounds   = 600000
+	envelopeFormat = 1
+)
+
+// Entry is one generated value
+type Entry struct {
+	Profile string    `json:"profile"`
+	Name    string    `json:"name"`
+	Kind    string    `json:"kind"`
+	Value   string    `json:"value"`
+	Created time.Time `json:"created"`
+}
+
+// Store of generated values, held open and locked until Close
+type Store struct {
+	path    string
+	key     []byte
+	salt    []byte
+	lock    *os.File
+	entries map[string]Entry
+}
+
+// envelope is the on disk format, the entries are only present
+// encrypted in Data
+type envelope struct {
+	Version int    `json:"version"`
+	Kdf     string `json:"kdf"`
+	Salt    []byte `json:"salt,omitempty"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Open the store at path, creating it when missing. If passphrase is
+// set the key is derived from it, otherwise the key is read from
+// keyFile which is created with a random key when missing.
+func Open(path, keyFile, passphrase string) (store *Store, err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	store = &Store{path: path, entries: make(map[string]Entry)}
+	if store.lock, err = lockFile(path + ".lock"); err != nil {
+		return nil, err
+	}
+	lock := store.lock
+	defer func() {
+		if err != nil {
+			unlockFile(lock)
+			store = nil
+		}
+	}()
+
+	var env envelope
+	text, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		err = nil
+	case err != nil:
+		return
+	default:
+		if err = json.Unmarshal(text, &env); err != nil {
+			return nil, fmt.Errorf("state %s: %v", path, err)
+		}
+		if env.Version != envelopeFormat {
+			return nil, fmt.Errorf("state %s: unsupported format version %d", path, env.Version)
+		}
+	}
+
+	if len(passphrase) > 0 {
+		if env.Data != nil && env.Kdf != "pbkdf2-sha256" {
+			return nil, fmt.Errorf("state %s: was encrypted with a key file, not a passphrase", path)
+		}
+		store.salt = env.Salt
+		if store.salt == nil {
+			store.salt = make([]byte, saltSize)
+			if _, err = rand.Read(store.salt); err != nil {
+				return
+			}
+		}
+		store.key, err = pbkdf2.Key(sha256.New, passphrase, store.salt, pbkdf2Rounds, keySize)
+	} else {
+		if env.Data != nil && env.Kdf != "keyfile" {
+			return nil, fmt.Errorf("state %s: was encrypted with a passphrase, not a key file", path)
+		}
+		store.key, err = loadKey(keyFile)
+	}
+	if err != nil {
+		return
+	}
+
+	if env.Data != nil {
+		var plain []byte
+		if plain, err = store.open(env.Nonce, env.Data); err != nil {
+			return nil, fmt.Errorf("state %s: %v", path, err)
+		}
+		var entries []Entry
+		if err = json.Unmarshal(plain, &entries); err != nil {
+			return nil, fmt.Errorf("state %s: %v", path, err)
+		}
+		for _, entry := range entries {
+			store.entries[id(entry.Profile, entry.Name)] = entry
+		}
+	}
+	return
+}
+
+// Close releases the lock held on the store
+func (store *Store) Close() error {
+	if store.lock == nil {
+		return nil
+	}
+	err := unlockFile(store.lock)
+	store.lock = nil
+	return err
+}
+
+// Get the entry stored for profile and name
+func (store *Store) Get(profile, name string) (entry Entry, ok bool) {
+	entry, ok = store.entries[id(profile, name)]
+	return
+}
+
+// Put an entry and write the store through to disk so a value is
+// never handed out without having been saved
+func (store *Store) Put(entry Entry) error {
+	if entry.Created.IsZero() {
+		entry.Created = time.Now().UTC()
+	}
+	store.entries[id(entry.Profile, entry.Name)] = entry
+	return store.save()
+}
+
+// List the entries ordered by profile and name
+func (store *Store) List() (entries []Entry) {
+	for _, entry := range store.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Profile != entries[j].Profile {
+			return entries[i].Profile < entries[j].Profile
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return
+}
+
+func (store *Store) save() error {
+	plain, err := json.Marshal(store.List())
+	if err != nil {
+		return err
+	}
+	env := envelope{Version: envelopeFormat, Kdf: "keyfile"}
+	if store.salt != nil {
+		env.Kdf = "pbkdf2-sha256"
+		env.Salt = store.salt
+	}
+	if env.Nonce, env.Data, err = store.seal(plain); err != nil {
+		return err
+	}
+	text, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(store.path, text, 0600)
+}
+
+func (store *Store) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(store.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (store *Store) seal(plain []byte) (nonce, data []byte, err error) {
+	aead, err := store.aead()
+	if err != nil {
+		return
+	}
+	nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	data = aead.Seal(nil, nonce, plain, nil)
+	return
+}
+
+func (store *Store) open(nonce, data []byte) ([]byte, error) {
+	aead, err := store.aead()
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, errors.New("decryption failed, wrong key or passphrase?")
+	}
+	return plain, nil
+}
+
+// loadKey reads a key file, creating it with a random key if missing
+func loadKey(keyFile string) ([]byte, error) {
+	key, err := ioutil.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		key = make([]byte, keySize)
+		if _, err = rand.Read(key); err != nil {
+			return nil, err
+		}
+		return key, atomicfile.WriteFile(keyFile, key, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("state key %s: expected %d bytes got %d", keyFile, keySize, len(key))
+	}
+	return key, nil
+}
+
+func id(profile, name string) string {
+	return profile + "/" + name
+}
@@ -0,0 +1,132 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		passphrase string
+		reopen     string
+		err        string
+	}{
+		{name: "key file"},
+		{name: "passphrase", passphrase: "correct horse", reopen: "correct horse"},
+		{name: "wrong passphrase", passphrase: "correct horse", reopen: "battery staple", err: "decryption failed"},
+		{name: "passphrase for a key file store", reopen: "correct horse", err: "was encrypted with a key file"},
+		{name: "key file for a passphrase store", passphrase: "correct horse", err: "was encrypted with a passphrase"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "state")
+			store, err := Open(path, path+".key", test.passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = store.Put(Entry{Profile: "prod", Name: "db", Kind: "password", Value: "s3cret"}); err != nil {
+				t.Fatal(err)
+			}
+			store.Close()
+
+			text, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(text), "s3cret") {
+				t.Fatalf("store holds the value in clear: %s", text)
+			}
+			if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+				t.Errorf("store mode %v, want 0600", info.Mode().Perm())
+			}
+
+			store, err = Open(path, path+".key", test.reopen)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Open error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			entry, ok := store.Get("prod", "db")
+			if !ok || entry.Value != "s3cret" || entry.Kind != "password" || entry.Created.IsZero() {
+				t.Errorf("Get = %+v, %v", entry, ok)
+			}
+			if _, ok = store.Get("default", "db"); ok {
+				t.Errorf("entry of profile prod found in profile default")
+			}
+		})
+	}
+}
+
+func TestStoreLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	store, err := Open(path, path+".key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := make(chan *Store)
+	go func() {
+		second, err := Open(path, path+".key", "")
+		if err != nil {
+			t.Error(err)
+		}
+		opened <- second
+	}()
+	select {
+	case <-opened:
+		t.Fatal("a second Open did not wait for the lock")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if err = store.Put(Entry{Profile: "default", Name: "a", Kind: "password", Value: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	select {
+	case second := <-opened:
+		defer second.Close()
+		if _, ok := second.Get("default", "a"); !ok {
+			t.Error("the second Open does not see the value written before the lock was released")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a second Open did not get the lock once released")
+	}
+}
+
+func TestPassword(t *testing.T) {
+	tests := []struct {
+		length int
+		err    bool
+	}{
+		{length: 1},
+		{length: 32},
+		{length: 256},
+		{length: 0, err: true},
+		{length: -1, err: true},
+	}
+	for _, test := range tests {
+		text, err := Password(test.length)
+		if (err != nil) != test.err {
+			t.Errorf("Password(%d) error %v", test.length, err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if len(text) != test.length {
+			t.Errorf("Password(%d) has length %d", test.length, len(text))
+		}
+		if strings.Trim(text, PasswordAlphabet) != "" {
+			t.Errorf("Password(%d) = %q holds characters outside the alphabet", test.length, text)
+		}
+	}
+}